@@ -1,24 +1,34 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/gob"
 	"fmt"
 	"log"
 	"net/http"
-	"net/smtp"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/marif226/bookings/internal/config"
 	"github.com/marif226/bookings/internal/driver"
+	"github.com/marif226/bookings/internal/emails"
 	"github.com/marif226/bookings/internal/handlers"
 	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/mailer"
 	"github.com/marif226/bookings/internal/models"
 	"github.com/marif226/bookings/internal/render"
+	"github.com/marif226/bookings/internal/signer"
 )
 
-const portNumber = ":8080"
+const shutdownTimeout = 30 * time.Second
+const mailDrainTimeout = 30 * time.Second
+const pathToEmailTemplates = "./email-templates"
+
 var app 		config.AppConfig
 var session 	*scs.SessionManager
 var infoLog 	*log.Logger
@@ -26,37 +36,97 @@ var errorLog 	*log.Logger
 
 // Main application function
 func main() {
-	db, err := run()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := migrateCommand(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	err := config.Load(&app, os.Args[1:])
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	defer db.SQL.Close()
+	db, err := run()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	defer close(app.MailChan)
+	mailTransport, err := mailer.New(app.Mail, infoLog)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	fmt.Println("Starting mail lestener...")
-	listenToMail()
+	emailTemplates, err := emails.Load(pathToEmailTemplates)
+	if err != nil {
+		log.Fatal("Cannot parse email templates: ", err)
+	}
 
-	fmt.Printf("Starting application on port %s\n", portNumber)
+	fmt.Println("Starting mail workers...")
+	stopMail, mailDone := startMail(mailTransport, emailTemplates)
 
-	from := "me@here.com"
-	auth := smtp.PlainAuth("", from, "", "localhost")
-	err = smtp.SendMail("localhost:1025", auth, from, []string{"you@there.com"}, []byte("Hello, world!"))
-	if err != nil {
-		log.Println(err)
-	}	
+	fmt.Printf("Starting application on port %d\n", app.Port)
 
 	serv := &http.Server{
-		Addr: portNumber,
+		Addr: fmt.Sprintf(":%d", app.Port),
 		Handler: routes(&app),
 	}
 
-	
-	err = serv.ListenAndServe()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- serv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		if err != http.ErrServerClosed {
+			errorLog.Println(err)
+		}
+	case sig := <-stop:
+		infoLog.Printf("Received %s, shutting down...", sig)
+	}
+
+	shutdown(serv, db, mailTransport, stopMail, mailDone)
+}
+
+// shutdown stops accepting connections, waits for in-flight requests and emails being sent,
+// and closes the database pool. Queued emails stay in the outbox for the next start
+func shutdown(serv *http.Server, db *driver.DB, mailTransport mailer.Mailer, stopMail context.CancelFunc, mailDone <-chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := serv.Shutdown(ctx)
 	if err != nil {
-		log.Fatal(err)
+		errorLog.Println("Requests did not finish in time:", err)
+	}
+
+	stopMail()
+
+	select {
+	case <-mailDone:
+		infoLog.Println("Mail workers stopped")
+	case <-time.After(mailDrainTimeout):
+		errorLog.Println("Mail workers did not stop in time, unfinished emails are sent again after restart")
+	}
+
+	err = mailTransport.Close()
+	if err != nil {
+		errorLog.Println(err)
+	}
+
+	if db != nil {
+		err = db.SQL.Close()
+		if err != nil {
+			errorLog.Println(err)
+		}
 	}
+
+	infoLog.Println("Shutdown complete")
 }
 
 func run() (*driver.DB, error) {
@@ -66,13 +136,7 @@ func run() (*driver.DB, error) {
 	gob.Register(models.User{})
 	gob.Register(models.Room{})
 	gob.Register(models.Restriction{})
-
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
-
-
-	// change to true when in production
-	app.InProduction = false
+	gob.Register(map[string]int{})
 
 	// set up loggers
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
@@ -89,14 +153,7 @@ func run() (*driver.DB, error) {
 
 	app.Session = session
 
-	// connect to database
-	log.Println("Connecting to database...")
-	db, err := driver.ConnectSQL("host=localhost port=5432 dbname=bookings user=postgres password=minecraft132")
-	if err != nil {
-		log.Fatal("Cannot connect to database! Dying...")
-	}
-
-	log.Println("Connected to database!")
+	app.Signer = signer.New([]byte(app.Secret))
 
 	// create template cache
 	templateCache, err := render.CreateTemplateCache()
@@ -107,10 +164,41 @@ func run() (*driver.DB, error) {
 
 	// store template cache in application
 	app.TemplateCache = templateCache
-	app.UseCache = false
 
-	// create new repository that holds app config
-	repo := handlers.NewRepo(&app, db)
+	var db *driver.DB
+	var repo *handlers.Repository
+
+	switch app.Database.Driver {
+	case "memory":
+		log.Println("Using in-memory database, all data is lost on shutdown!")
+		repo = handlers.NewMemoryRepo(&app)
+
+		err = seedMemoryAdmin(repo)
+		if err != nil {
+			return nil, err
+		}
+	case "sqlite":
+		log.Printf("Opening SQLite database %s...", app.Database.Path)
+		db, err = driver.ConnectSQLite(app.Database.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		repo = handlers.NewSQLiteRepo(&app, db)
+	default:
+		// connect to database
+		log.Println("Connecting to database...")
+		db, err = driver.ConnectSQL(app.Database.DSN())
+		if err != nil {
+			log.Fatal("Cannot connect to database! Dying...")
+		}
+
+		log.Println("Connected to database!")
+
+		// create new repository that holds app config
+		repo = handlers.NewRepo(&app, db)
+	}
+
 	// set this repository for handlers package
 	handlers.NewHandlers(repo)
 
@@ -120,4 +208,26 @@ func run() (*driver.DB, error) {
 	helpers.NewHelpers(&app)
 
 	return db, nil
-}
\ No newline at end of file
+}
+
+// seedMemoryAdmin creates an owner account in an empty in-memory database, so that the admin pages can be used
+func seedMemoryAdmin(repo *handlers.Repository) error {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	password := hex.EncodeToString(b)
+
+	_, err := repo.DB.InsertUser(context.Background(), models.User{
+		FirstName: "Admin",
+		LastName: "User",
+		Email: "admin@example.com",
+		AccessLevel: models.AccessOwner,
+	}, password)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Log in as admin@example.com with password %s", password)
+	return nil
+}
@@ -1,10 +1,21 @@
 package main
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/marif226/bookings/internal/handlers"
+)
 
 func TestRun(t *testing.T) {
+	repo := handlers.Repo
+	t.Cleanup(func() {
+		handlers.NewHandlers(repo)
+	})
+
+	app.Database.Driver = "memory"
+
 	_, err := run()
 	if err != nil {
 		t.Error("Failed run")
 	}
-}
\ No newline at end of file
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/justinas/nosurf"
+	"github.com/marif226/bookings/internal/handlers"
 	"github.com/marif226/bookings/internal/helpers"
 )
 
@@ -16,6 +22,18 @@ func NoSurf(next http.Handler) http.Handler {
 		Secure: app.InProduction,
 		SameSite: http.SameSiteLaxMode,
 	})
+	// clients of the JSON API never see a CSRF token. Only API requests riding on a session cookie
+	// still need one, a cross-site page cannot set an Authorization header
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			return false
+		}
+		if _, ok := helpers.BearerToken(r); ok {
+			return true
+		}
+		_, err := r.Cookie(session.Cookie.Name)
+		return err != nil
+	})
 
 	return csrfHandler
 }
@@ -25,6 +43,7 @@ func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
 
+// Auth makes sure a user is logged in
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !helpers.IsAuthenticated(r) {
@@ -34,4 +53,143 @@ func Auth(next http.Handler) http.Handler {
 		}
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+// RequireRole makes sure the logged in user has at least the given access level
+func RequireRole(level int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !helpers.IsAuthenticated(r) {
+				session.Put(r.Context(), "error", "Log in first")
+				http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+				return
+			}
+
+			r, active, err := reloadUser(r)
+			if err != nil {
+				helpers.ServerError(w, err)
+				return
+			} else if !active {
+				session.Put(r.Context(), "error", "Log in first")
+				http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+				return
+			}
+
+			if !helpers.HasAccess(r, level) {
+				helpers.ClientError(w, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// reloadedUserKey marks requests whose user was already reloaded by reloadUser
+type reloadedUserKey struct{}
+
+// reloadUser reloads the logged in user, so that deactivating, demoting or deleting a user takes
+// effect on their next request instead of when their session expires. Users that are gone or
+// inactive are logged out, the others get their current access level put in the session. It
+// reports whether the user is still logged in, and returns r marked so that nested RequireRole
+// middleware does not load the user again
+func reloadUser(r *http.Request) (*http.Request, bool, error) {
+	if r.Context().Value(reloadedUserKey{}) != nil {
+		return r, true, nil
+	}
+
+	u, err := handlers.Repo.DB.GetUserByID(r.Context(), session.GetInt(r.Context(), "user_id"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !u.Active) {
+		session.Remove(r.Context(), "user_id")
+		session.Remove(r.Context(), "access_level")
+		_ = session.RenewToken(r.Context())
+		return r, false, nil
+	} else if err != nil {
+		return r, false, err
+	}
+
+	session.Put(r.Context(), "access_level", u.AccessLevel)
+	return r.WithContext(context.WithValue(r.Context(), reloadedUserKey{}, true)), true, nil
+}
+
+// APIToken authenticates requests carrying an Authorization: Bearer header, others pass through untouched
+func APIToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := helpers.BearerToken(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if token == "" {
+			helpers.ClientErrorJSON(w, http.StatusUnauthorized, "malformed Authorization header")
+			return
+		}
+
+		t, err := handlers.Repo.DB.GetAPITokenByHash(r.Context(), helpers.HashAPIToken(token))
+		if errors.Is(err, sql.ErrNoRows) {
+			helpers.ClientErrorJSON(w, http.StatusUnauthorized, "invalid API token")
+			return
+		} else if err != nil {
+			helpers.ServerErrorJSON(w, err)
+			return
+		}
+
+		if t.Revoked() || !t.User.Active {
+			helpers.ClientErrorJSON(w, http.StatusUnauthorized, "invalid API token")
+			return
+		}
+
+		err = handlers.Repo.DB.UpdateAPITokenLastUsed(r.Context(), t.ID)
+		if err != nil {
+			// not worth failing the request over
+			app.ErrorLog.Println(err)
+		}
+
+		next.ServeHTTP(w, r.WithContext(helpers.WithAPIToken(r.Context(), t)))
+	})
+}
+
+// RequireRoleJSON is RequireRole for the JSON API, answering with an error envelope instead of redirecting.
+// Requests authenticated with an API token also need the given scope
+func RequireRoleJSON(level int, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if t, ok := helpers.APITokenFromContext(r.Context()); ok {
+				if !t.HasScope(scope) {
+					helpers.ClientErrorJSON(w, http.StatusForbidden, fmt.Sprintf("API token lacks the %s scope", scope))
+					return
+				}
+
+				if t.User.AccessLevel < level {
+					helpers.ClientErrorJSON(w, http.StatusForbidden, "insufficient access level")
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !helpers.IsAuthenticated(r) {
+				helpers.ClientErrorJSON(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+
+			r, active, err := reloadUser(r)
+			if err != nil {
+				helpers.ServerErrorJSON(w, err)
+				return
+			} else if !active {
+				helpers.ClientErrorJSON(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+
+			if !helpers.HasAccess(r, level) {
+				helpers.ClientErrorJSON(w, http.StatusForbidden, "insufficient access level")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/models"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -28,4 +32,193 @@ func TestSessionLoad(t *testing.T) {
 	default:
 		t.Error(fmt.Sprintf("Type is not http.Handler but is %T", v))
 	}
-}
\ No newline at end of file
+}
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name				string
+		userID				int
+		// the access level the session was logged in with
+		accessLevel			int
+		fail				bool
+		expectedStatusCode	int
+	}{
+		{"not logged in", 0, 0, false, http.StatusSeeOther},
+		{"staff", staffUser, models.AccessStaff, false, http.StatusForbidden},
+		{"manager", managerUser, models.AccessManager, false, http.StatusOK},
+		{"demoted", staffUser, models.AccessManager, false, http.StatusForbidden},
+		{"promoted", managerUser, models.AccessStaff, false, http.StatusOK},
+		{"deactivated", inactiveUser, models.AccessManager, false, http.StatusSeeOther},
+		{"deleted", 99, models.AccessManager, false, http.StatusSeeOther},
+		{"database error", managerUser, models.AccessManager, true, http.StatusInternalServerError},
+	}
+
+	memoryRepo(t)
+	var myH myHandler
+	// nested like the admin routes, the user is loaded once
+	h := RequireRole(models.AccessStaff)(RequireRole(models.AccessManager)(&myH))
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/reservations-calendar", nil)
+		ctx, _ := session.Load(req.Context(), "")
+		req = req.WithContext(ctx)
+
+		if e.userID != 0 {
+			session.Put(ctx, "user_id", e.userID)
+			session.Put(ctx, "access_level", e.accessLevel)
+		}
+
+		failRepo = e.fail
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		failRepo = false
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if rr.Code == http.StatusSeeOther && session.Exists(ctx, "user_id") {
+			t.Errorf("for %s expected the user to be logged out", e.name)
+		}
+	}
+}
+
+func TestRequireRoleJSON(t *testing.T) {
+	tests := []struct {
+		name				string
+		userID				int
+		fail				bool
+		token				*models.APIToken
+		expectedStatusCode	int
+	}{
+		{"not logged in", 0, false, nil, http.StatusUnauthorized},
+		{"staff", staffUser, false, nil, http.StatusOK},
+		{"deactivated", inactiveUser, false, nil, http.StatusUnauthorized},
+		{"deleted", 99, false, nil, http.StatusUnauthorized},
+		{"database error", staffUser, true, nil, http.StatusInternalServerError},
+		{"token with scope", 0, false, &models.APIToken{Scopes: []string{models.ScopeReservationsRead}, User: models.User{AccessLevel: models.AccessStaff}}, http.StatusOK},
+		{"token without scope", 0, false, &models.APIToken{User: models.User{AccessLevel: models.AccessStaff}}, http.StatusForbidden},
+		{"token of guest", 0, false, &models.APIToken{Scopes: []string{models.ScopeReservationsRead}, User: models.User{AccessLevel: models.AccessGuest}}, http.StatusForbidden},
+	}
+
+	memoryRepo(t)
+	var myH myHandler
+	h := RequireRoleJSON(models.AccessStaff, models.ScopeReservationsRead)(&myH)
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/api/v1/reservations/1", nil)
+		ctx, _ := session.Load(req.Context(), "")
+
+		if e.userID != 0 {
+			session.Put(ctx, "user_id", e.userID)
+			session.Put(ctx, "access_level", models.AccessStaff)
+		}
+		if e.token != nil {
+			ctx = helpers.WithAPIToken(ctx, *e.token)
+		}
+		req = req.WithContext(ctx)
+
+		failRepo = e.fail
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		failRepo = false
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if rr.Code != http.StatusOK && rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("for %s expected a JSON error but got content type %q", e.name, rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+// tokenHandler records the API token it was called with
+type tokenHandler struct {
+	token	models.APIToken
+	called	bool
+}
+
+func (th *tokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	th.called = true
+	th.token, _ = helpers.APITokenFromContext(r.Context())
+}
+
+func TestAPIToken(t *testing.T) {
+	tests := []struct {
+		name				string
+		header				string
+		expectedStatusCode	int
+		expectedToken		bool
+	}{
+		{"no header", "", http.StatusOK, false},
+		{"valid", "Bearer bk_valid", http.StatusOK, true},
+		{"lower case scheme", "bearer bk_valid", http.StatusOK, true},
+		{"basic auth", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, false},
+		{"unknown", "Bearer bk_unknown", http.StatusUnauthorized, false},
+		{"revoked", "Bearer bk_revoked", http.StatusUnauthorized, false},
+		{"inactive user", "Bearer bk_inactive", http.StatusUnauthorized, false},
+		{"database error", "Bearer bk_fail", http.StatusInternalServerError, false},
+	}
+
+	for _, e := range tests {
+		var th tokenHandler
+		h := APIToken(&th)
+
+		req, _ := http.NewRequest("GET", "/api/v1/reservations/1", nil)
+		if e.header != "" {
+			req.Header.Set("Authorization", e.header)
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if th.called != (e.expectedStatusCode == http.StatusOK) {
+			t.Errorf("for %s next handler called: %t", e.name, th.called)
+		}
+
+		if e.expectedToken && th.token.ID == 0 {
+			t.Errorf("for %s expected the token in the request context", e.name)
+		}
+	}
+}
+
+func TestNoSurf_API(t *testing.T) {
+	var myH myHandler
+	h := NoSurf(&myH)
+
+	tests := []struct {
+		name				string
+		url					string
+		header				string
+		cookie				bool
+		expectedStatusCode	int
+	}{
+		{"admin form", "/admin/reservations-calendar", "", false, http.StatusBadRequest},
+		// a session cookie still rides along with any Authorization header
+		{"admin form with a bearer token", "/admin/reservations-calendar", "Bearer bk_valid", true, http.StatusBadRequest},
+		{"api", "/api/v1/reservations", "Bearer bk_valid", false, http.StatusOK},
+		{"api with a session cookie and a bearer token", "/api/v1/reservations", "Bearer bk_valid", true, http.StatusOK},
+		{"api without credentials", "/api/v1/reservations", "", false, http.StatusOK},
+		{"api with a session cookie", "/api/v1/reservations", "", true, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		if e.header != "" {
+			req.Header.Set("Authorization", e.header)
+		}
+		if e.cookie {
+			req.AddCookie(&http.Cookie{Name: session.Cookie.Name, Value: "some session"})
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
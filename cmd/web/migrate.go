@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/marif226/bookings/internal/config"
+	"github.com/marif226/bookings/internal/driver"
+	"github.com/marif226/bookings/internal/migrate"
+	"github.com/marif226/bookings/migrations"
+)
+
+const migrateUsage = `usage:
+  bookings migrate up [config flags]
+  bookings migrate down [steps] [config flags]
+  bookings migrate status [config flags]
+  bookings migrate create [-dir migrations/postgres] <name>
+
+every migration needs a file in both migrations/postgres and migrations/sqlite`
+
+// migrateTimeout bounds a whole migrate run, migrations may take much longer than a single query
+const migrateTimeout = 10 * time.Minute
+
+// migrateCommand runs the migrate subcommand with the arguments following "migrate"
+func migrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	action, args := args[0], args[1:]
+
+	if action == "create" {
+		fs := flag.NewFlagSet("migrate create", flag.ContinueOnError)
+		dir := fs.String("dir", "migrations/postgres", "directory to write the migration to")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if fs.NArg() != 1 {
+			return errors.New(migrateUsage)
+		}
+
+		up, down, err := migrate.Create(*dir, fs.Arg(0), time.Now())
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Created", up)
+		fmt.Println("Created", down)
+		return nil
+	}
+
+	steps := 1
+	if action == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n < 1 {
+				return errors.New("steps must be at least 1")
+			}
+			steps = n
+			args = args[1:]
+		}
+	}
+
+	if action != "up" && action != "down" && action != "status" {
+		return errors.New(migrateUsage)
+	}
+
+	err := config.Load(&app, args)
+	if err != nil {
+		return err
+	}
+
+	var db *driver.DB
+
+	switch app.Database.Driver {
+	case "postgres":
+		db, err = driver.ConnectSQL(app.Database.DSN())
+	case "sqlite":
+		db, err = driver.ConnectSQLite(app.Database.Path)
+	default:
+		return fmt.Errorf("the %s driver has no schema to migrate", app.Database.Driver)
+	}
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	// the migrations of each driver live in the directory named after it
+	list, err := migrate.Load(migrations.FS, app.Database.Driver)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	m := migrate.New(db.SQL, list)
+
+	switch action {
+	case "up":
+		done, err := m.Up(ctx)
+		for _, migration := range done {
+			fmt.Printf("Applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("Database is up to date")
+		}
+
+	case "down":
+		done, err := m.Down(ctx, steps)
+		for _, migration := range done {
+			fmt.Printf("Rolled back %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		tw.Flush()
+	}
+
+	return nil
+}
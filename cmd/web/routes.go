@@ -7,6 +7,7 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/marif226/bookings/internal/config"
 	"github.com/marif226/bookings/internal/handlers"
+	"github.com/marif226/bookings/internal/models"
 )
 
 func routes(app *config.AppConfig) http.Handler {
@@ -18,8 +19,11 @@ func routes(app *config.AppConfig) http.Handler {
 
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-	mux.Get("/majors-suite", handlers.Repo.Majors)
+	mux.Get("/rooms", handlers.Repo.Rooms)
+	mux.Get("/rooms/{slug}", handlers.Repo.Room)
+	// the room pages used to live at the top level
+	mux.Handle("/generals-quarters", http.RedirectHandler("/rooms/generals-quarters", http.StatusMovedPermanently))
+	mux.Handle("/majors-suite", http.RedirectHandler("/rooms/majors-suite", http.StatusMovedPermanently))
 	mux.Get("/contact", handlers.Repo.Contact)
 
 	mux.Get("/search-availability", handlers.Repo.Availability)
@@ -32,23 +36,77 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Post("/make-reservation", handlers.Repo.PostReservation)
 	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
 
+	mux.Get("/manage-booking", handlers.Repo.ShowManageBooking)
+	mux.Post("/manage-booking/dates", handlers.Repo.PostManageBookingDates)
+	mux.Post("/manage-booking/cancel", handlers.Repo.PostManageBookingCancel)
+
+	// synced by the booking sites the rooms are listed on
+	mux.Get("/ical/rooms/{id}.ics", handlers.Repo.RoomICalFeed)
+
 	mux.Get("/user/login", handlers.Repo.ShowLogin)
 	mux.Post("/user/login", handlers.Repo.PostShowLogin)
 	mux.Get("/user/logout", handlers.Repo.Logout)
+	mux.Get("/user/forgot-password", handlers.Repo.ShowForgotPassword)
+	mux.Post("/user/forgot-password", handlers.Repo.PostForgotPassword)
+	mux.Get("/user/reset-password", handlers.Repo.ShowResetPassword)
+	mux.Post("/user/reset-password", handlers.Repo.PostResetPassword)
+
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Use(APIToken)
+		mux.Get("/rooms", handlers.Repo.APIRooms)
+		mux.Get("/rooms/{id}/availability", handlers.Repo.APIRoomAvailability)
+		mux.Post("/reservations", handlers.Repo.APIPostReservation)
+		mux.With(RequireRoleJSON(models.AccessStaff, models.ScopeReservationsRead)).Get("/reservations/{id}", handlers.Repo.APIReservation)
+	})
 
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	mux.Route("/admin", func(mux chi.Router) {
-		// mux.Use(Auth)
+		mux.Use(RequireRole(models.AccessStaff))
 		mux.Get("/dashboard", handlers.Repo.AdminDashBoard)
 
 		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
 		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
 		mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
+		mux.With(RequireRole(models.AccessManager)).Post("/reservations-calendar", handlers.Repo.AdminPostReservationsCalendar)
 
 		mux.Get("/reservations/{src}/{id}", handlers.Repo.AdminShowReservation)
 		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+		mux.Post("/reservation-status/{src}/{id}/{status}", handlers.Repo.AdminReservationStatus)
+		mux.With(RequireRole(models.AccessManager)).Post("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
+
+		mux.Get("/api-tokens", handlers.Repo.AdminAPITokens)
+		mux.Post("/api-tokens", handlers.Repo.AdminPostAPIToken)
+		mux.Post("/revoke-api-token/{id}", handlers.Repo.AdminRevokeAPIToken)
+
+		mux.Get("/mail", handlers.Repo.AdminMail)
+		mux.Post("/resend-mail/{id}", handlers.Repo.AdminResendMail)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(RequireRole(models.AccessManager))
+			mux.Get("/users", handlers.Repo.AdminUsers)
+			mux.Get("/users/new", handlers.Repo.AdminShowUser)
+			mux.Post("/users/new", handlers.Repo.AdminPostShowUser)
+			mux.Get("/users/{id}", handlers.Repo.AdminShowUser)
+			mux.Post("/users/{id}", handlers.Repo.AdminPostShowUser)
+			mux.Post("/activate-user/{id}", handlers.Repo.AdminActivateUser)
+			mux.Post("/deactivate-user/{id}", handlers.Repo.AdminDeactivateUser)
+			mux.With(RequireRole(models.AccessOwner)).Post("/delete-user/{id}", handlers.Repo.AdminDeleteUser)
+
+			mux.Get("/rooms", handlers.Repo.AdminRooms)
+			mux.Get("/rooms/new", handlers.Repo.AdminShowRoom)
+			mux.Post("/rooms/new", handlers.Repo.AdminPostShowRoom)
+			mux.Get("/rooms/{id}", handlers.Repo.AdminShowRoom)
+			mux.Post("/rooms/{id}", handlers.Repo.AdminPostShowRoom)
+			mux.Get("/rooms/{id}/rates", handlers.Repo.AdminShowRatePlan)
+			mux.Post("/rooms/{id}/rates", handlers.Repo.AdminPostRatePlan)
+			mux.Get("/rooms/{id}/stay-rules", handlers.Repo.AdminShowStayRules)
+			mux.Post("/rooms/{id}/stay-rules", handlers.Repo.AdminPostStayRules)
+			mux.Post("/rooms/{id}/new-ical-link", handlers.Repo.AdminNewRoomICalLink)
+			mux.Post("/rooms/{id}/disable-ical-link", handlers.Repo.AdminDisableRoomICalLink)
+			mux.With(RequireRole(models.AccessOwner)).Post("/delete-room/{id}", handlers.Repo.AdminDeleteRoom)
+		})
 	})
 
 	return mux
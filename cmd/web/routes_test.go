@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/go-chi/chi"
@@ -18,4 +19,38 @@ func TestRoutes(t *testing.T) {
 	default:
 		t.Error(fmt.Sprintf("type is not *chi.Mux, type is %T", v))
 	}
-}
\ No newline at end of file
+}
+
+func TestRoutes_StateChangesArePosts(t *testing.T) {
+	var app config.AppConfig
+	mux := routes(&app).(*chi.Mux)
+
+	// admin actions that change data, so that they are covered by the CSRF check
+	posts := []string{
+		"/admin/activate-user/{id}",
+		"/admin/deactivate-user/{id}",
+		"/admin/delete-user/{id}",
+		"/admin/delete-reservation/{src}/{id}",
+		"/admin/reservation-status/{src}/{id}/{status}",
+		"/admin/revoke-api-token/{id}",
+		"/admin/resend-mail/{id}",
+		"/admin/delete-room/{id}",
+		"/admin/rooms/{id}/new-ical-link",
+		"/admin/rooms/{id}/disable-ical-link",
+	}
+
+	methods := map[string][]string{}
+	err := chi.Walk(mux, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		methods[route] = append(methods[route], method)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range posts {
+		if fmt.Sprint(methods[route]) != "[POST]" {
+			t.Errorf("expected %s to only accept POST, got %v", route, methods[route])
+		}
+	}
+}
@@ -1,58 +1,64 @@
 package main
 
 import (
-	"fmt"
-	"io/ioutil"
-	"log"
-	"strings"
+	"context"
 	"time"
 
+	"github.com/marif226/bookings/internal/emails"
+	"github.com/marif226/bookings/internal/handlers"
+	"github.com/marif226/bookings/internal/mailer"
 	"github.com/marif226/bookings/internal/models"
-	mail "github.com/xhit/go-simple-mail/v2"
+	"github.com/marif226/bookings/internal/outbox"
 )
 
-func listenToMail() {
+// mailPollInterval is how often idle mail workers look for new emails in the outbox
+const mailPollInterval = 2 * time.Second
+
+// startMail starts the workers rendering the emails queued in the database with templates and
+// sending them through m until the returned function is called, then closes the returned channel
+// once the emails being sent are dealt with
+func startMail(m mailer.Mailer, templates *emails.Templates) (context.CancelFunc, <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	sender := &outbox.Sender{
+		Store: handlers.Repo.DB,
+		Send: func(msg models.MailData) error {
+			return sendMsg(m, templates, msg)
+		},
+		Workers: app.Mail.Workers,
+		MaxAttempts: app.Mail.MaxAttempts,
+		RetryDelay: app.Mail.RetryDelay,
+		PollInterval: mailPollInterval,
+		ErrorLog: app.ErrorLog,
+	}
+
 	go func() {
-		for {
-			msg := <-app.MailChan
-			sendMsg(msg)
-		}
+		defer close(done)
+		sender.Run(ctx)
 	}()
-}
 
-func sendMsg(m models.MailData) {
-	server := mail.NewSMTPClient()
-	server.Host = "localhost"
-	server.Port = 1025
-	server.KeepAlive = false
-	server.ConnectTimeout = 10 * time.Second
-	server.SendTimeout = 10 * time.Second
-
-	client, err := server.Connect()
-	if err != nil {
-		errorLog.Println(err)
-	}
+	return cancel, done
+}
 
-	email := mail.NewMSG()
-	email.SetFrom(m.From).AddTo(m.To).SetSubject(m.Subject)
-	if m.Template == "" {
-		email.SetBody(mail.TextHTML, string(m.Content))
-	} else {
-		data, err := ioutil.ReadFile(fmt.Sprintf("./email-templates/%s", m.Template))
+// sendMsg renders msg with its template and delivers it through m. Emails queued as html before
+// templates are delivered as they are
+func sendMsg(m mailer.Mailer, templates *emails.Templates, msg models.MailData) error {
+	html, text := msg.Content, ""
+	if html == "" {
+		var err error
+		html, text, err = templates.Render(msg)
 		if err != nil {
-			app.ErrorLog.Println(err)
+			return err
 		}
-
-		mailTemplate := string(data)
-		msgToSend := strings.Replace(mailTemplate, "[%body%]", m.Content, 1)
-		email.SetBody(mail.TextHTML, msgToSend)
 	}
-	
 
-	err = email.Send(client)
-	if err != nil {
-		log.Println(err)
-	} else {
-		log.Println("Email sent")
-	}
-}
\ No newline at end of file
+	return m.Send(mailer.Message{
+		From: msg.From,
+		To: msg.To,
+		Subject: msg.Subject,
+		HTML: html,
+		Text: text,
+		Attachments: msg.Attachments,
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marif226/bookings/internal/emails"
+	"github.com/marif226/bookings/internal/mailer"
+	"github.com/marif226/bookings/internal/models"
+)
+
+func TestStartMail(t *testing.T) {
+	app.Mail.Workers = 2
+	app.Mail.MaxAttempts = 1
+	app.Mail.RetryDelay = time.Minute
+
+	stop, done := startMail(mailer.NewLog(app.InfoLog), &emails.Templates{})
+
+	stop()
+
+	select {
+	case <-done:
+		// workers stopped once they were told to
+	case <-time.After(time.Second):
+		t.Error("mail workers did not stop in time")
+	}
+}
+
+func TestSendMsg(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := mailer.NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := emails.Load("./../../email-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := emails.Message("john@smith.com", "me@here.com", "Password Reset", emails.PasswordReset{FirstName: "John", Link: "http://localhost:8080/reset"})
+	err = sendMsg(m, templates, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sendMsg(m, templates, models.MailData{To: "john@smith.com", From: "me@here.com", Template: "basic.html"})
+	if err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+
+	// emails queued as html before templates
+	err = sendMsg(m, templates, models.MailData{To: "john@smith.com", From: "me@here.com", Subject: "Reservation Confirmation", Template: "basic.html", Content: "<strong>Reservation Confirmation</strong>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected two saved emails, got %d, %v", len(files), err)
+	}
+
+	var saved []string
+	for _, f := range files {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		saved = append(saved, string(data))
+	}
+	all := strings.Join(saved, "\n")
+
+	if !strings.Contains(all, "Subject: Password Reset") || !strings.Contains(all, "Dear John") {
+		t.Errorf("expected the password reset email, got:\n%s", all)
+	}
+	if !strings.Contains(all, "<strong>Reservation Confirmation</strong>") {
+		t.Errorf("expected the html queued before templates to be sent as it is, got:\n%s", all)
+	}
+}
@@ -1,21 +1,91 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/marif226/bookings/internal/handlers"
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/repository/dbrepo"
 )
 
 func TestMain(m *testing.M) {
+	session = scs.New()
+	session.Lifetime = 24 * time.Hour
+	app.Session = session
+
+	app.InfoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	app.ErrorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
+	helpers.NewHelpers(&app)
+	handlers.NewHandlers(handlers.NewTestRepo(&app))
 
 	os.Exit(m.Run())
 }
 
+// failRepo makes every call to the repository of memoryRepo fail while it is set
+var failRepo bool
+
+// ids of the users memoryRepo adds
+const (
+	managerUser		= 1
+	inactiveUser	= 2
+	staffUser		= 3
+)
+
+// memoryRepo gives the handlers an in-memory repository with an active manager, an inactive staff user
+// and an active staff user until the end of the test, for the tests that need users to change
+func memoryRepo(t *testing.T) {
+	t.Helper()
+	handlers.NewHandlers(&handlers.Repository{
+		App: &app,
+		DB: dbrepo.NewMemoryRepo(&app, func(method string) error {
+			if failRepo {
+				return errors.New("some error")
+			}
+			return nil
+		}),
+	})
+	t.Cleanup(func() {
+		handlers.NewHandlers(handlers.NewTestRepo(&app))
+	})
+
+	db := handlers.Repo.DB
+	ctx := context.Background()
+	users := []models.User{
+		{FirstName: "Manny", LastName: "Manager", Email: "manager@here.com", AccessLevel: models.AccessManager, Active: true},
+		{FirstName: "Old", LastName: "Staff", Email: "staff@here.com", AccessLevel: models.AccessStaff},
+		{FirstName: "Sam", LastName: "Staff", Email: "sam@here.com", AccessLevel: models.AccessStaff, Active: true},
+	}
+
+	for i, u := range users {
+		id, err := db.InsertUser(ctx, u, "password")
+		if err != nil {
+			t.Fatal(err)
+		} else if id != i+1 {
+			t.Fatalf("expected user %d, got %d", i+1, id)
+		}
+
+		if !u.Active {
+			err = db.SetUserActive(ctx, id, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
 type myHandler struct {
 	
 }
 
 func (mh *myHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-}
\ No newline at end of file
+}
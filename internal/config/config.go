@@ -3,9 +3,10 @@ package config
 import (
 	"html/template"
 	"log"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
-	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/signer"
 )
 
 // AppConfig holds the application config
@@ -16,5 +17,64 @@ type AppConfig struct {
 	ErrorLog		*log.Logger
 	InProduction 	bool
 	Session			*scs.SessionManager
-	MailChan		chan models.MailData
-}
\ No newline at end of file
+	Port			int
+	URL				string
+	Secret			string
+	Signer			*signer.Signer
+	Database		DatabaseConfig
+	Mail			MailConfig
+	Booking			BookingConfig
+}
+
+// DatabaseConfig holds the database connection settings
+type DatabaseConfig struct {
+	Driver			string			`yaml:"driver"`
+	Host			string			`yaml:"host"`
+	Port			int				`yaml:"port"`
+	Name			string			`yaml:"name"`
+	User			string			`yaml:"user"`
+	Password		string			`yaml:"password"`
+	SSLMode			string			`yaml:"sslmode"`
+	QueryTimeout	time.Duration	`yaml:"query_timeout"`
+	Path			string			`yaml:"path"`
+}
+
+// Mail transports, chosen with MailConfig.Transport
+const (
+	MailTransportSMTP	= "smtp"
+	MailTransportFile	= "file"
+	MailTransportLog	= "log"
+)
+
+// Encryption of the connection to the SMTP relay, chosen with MailConfig.Encryption
+const (
+	MailEncryptionNone		= "none"
+	MailEncryptionSTARTTLS	= "starttls"
+	MailEncryptionTLS		= "tls"
+)
+
+// MailConfig holds the mail transport settings and how queued emails are sent
+type MailConfig struct {
+	Transport	string			`yaml:"transport"`
+	Host		string			`yaml:"host"`
+	Port		int				`yaml:"port"`
+	Username	string			`yaml:"username"`
+	Password	string			`yaml:"password"`
+	Encryption	string			`yaml:"encryption"`
+	// Dir is where the file transport saves emails
+	Dir			string			`yaml:"dir"`
+	Workers		int				`yaml:"workers"`
+	MaxAttempts	int				`yaml:"max_attempts"`
+	// RetryDelay is the wait after the first failed attempt, doubled after every further one
+	RetryDelay	time.Duration	`yaml:"retry_delay"`
+	// From is the sender of every email and the organizer of the calendar events sent to guests
+	From		string			`yaml:"from"`
+	// Owner receives the notifications about bookings
+	Owner		string			`yaml:"owner"`
+}
+
+// BookingConfig holds the policy for guests managing their own bookings
+type BookingConfig struct {
+	// CancellationWindow is how long before arrival guests can no longer change or cancel online
+	CancellationWindow	time.Duration	`yaml:"cancellation_window"`
+}
@@ -0,0 +1,438 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is prepended to the name of every environment variable read by Load
+const envPrefix = "BOOKINGS_"
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+var dbDrivers = []string{"postgres", "sqlite", "memory"}
+
+var mailTransports = []string{MailTransportSMTP, MailTransportFile, MailTransportLog}
+
+var mailEncryptions = []string{MailEncryptionNone, MailEncryptionSTARTTLS, MailEncryptionTLS}
+
+// fileConfig mirrors the layout of the optional YAML config file
+type fileConfig struct {
+	Port			*int			`yaml:"port"`
+	URL				*string			`yaml:"url"`
+	Secret			*string			`yaml:"secret"`
+	InProduction	*bool			`yaml:"in_production"`
+	UseCache		*bool			`yaml:"use_cache"`
+	Database		DatabaseConfig	`yaml:"database"`
+	Mail			MailConfig		`yaml:"mail"`
+	Booking			BookingConfig	`yaml:"booking"`
+}
+
+// Load fills the deployment settings of a from defaults, an optional YAML file,
+// environment variables and command-line flags, in that order of precedence
+func Load(a *AppConfig, args []string) error {
+	setDefaults(a)
+
+	fs := flag.NewFlagSet("bookings", flag.ContinueOnError)
+
+	configFile := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "path to YAML config file")
+	port := fs.Int("port", 0, "port to listen on")
+	siteURL := fs.String("url", "", "public URL of the site, used in links sent by email")
+	secret := fs.String("secret", "", "key used to sign tokens, at least 32 characters")
+	inProduction := fs.Bool("production", false, "application is in production")
+	useCache := fs.Bool("cache", false, "use template cache")
+	dbDriver := fs.String("dbdriver", "", "database driver (postgres, sqlite, memory)")
+	dbHost := fs.String("dbhost", "", "database host")
+	dbPort := fs.Int("dbport", 0, "database port")
+	dbName := fs.String("dbname", "", "database name")
+	dbUser := fs.String("dbuser", "", "database user")
+	dbPass := fs.String("dbpass", "", "database password")
+	dbSSL := fs.String("dbssl", "", "database ssl settings (disable, prefer, require)")
+	dbTimeout := fs.Duration("dbtimeout", 0, "default timeout of a database query, e.g. 3s")
+	dbPath := fs.String("dbpath", "", "path to the SQLite database file")
+	mailTransport := fs.String("mailtransport", "", "how emails are delivered (smtp, file, log)")
+	mailHost := fs.String("mailhost", "", "mail server host")
+	mailPort := fs.Int("mailport", 0, "mail server port")
+	mailUser := fs.String("mailuser", "", "mail server user")
+	mailPass := fs.String("mailpass", "", "mail server password")
+	mailEncryption := fs.String("mailencryption", "", "mail server encryption (none, starttls, tls)")
+	mailDir := fs.String("maildir", "", "directory the file transport saves emails in")
+	mailWorkers := fs.Int("mailworkers", 0, "number of workers sending queued emails")
+	mailAttempts := fs.Int("mailattempts", 0, "attempts to send an email before giving up")
+	mailRetry := fs.Duration("mailretry", 0, "wait after the first failed attempt to send an email, e.g. 1m")
+	mailFrom := fs.String("mailfrom", "", "address emails are sent from")
+	mailOwner := fs.String("mailowner", "", "address notified about bookings")
+	cancelWindow := fs.Duration("cancelwindow", 0, "how long before arrival guests can no longer change or cancel, e.g. 48h")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var problems []string
+
+	if *configFile != "" {
+		if err := loadFile(a, *configFile); err != nil {
+			return err
+		}
+	}
+
+	problems = append(problems, loadEnv(a)...)
+
+	// only flags given explicitly on the command line override file and environment values
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			a.Port = *port
+		case "url":
+			a.URL = *siteURL
+		case "secret":
+			a.Secret = *secret
+		case "production":
+			a.InProduction = *inProduction
+		case "cache":
+			a.UseCache = *useCache
+		case "dbdriver":
+			a.Database.Driver = *dbDriver
+		case "dbhost":
+			a.Database.Host = *dbHost
+		case "dbport":
+			a.Database.Port = *dbPort
+		case "dbname":
+			a.Database.Name = *dbName
+		case "dbuser":
+			a.Database.User = *dbUser
+		case "dbpass":
+			a.Database.Password = *dbPass
+		case "dbssl":
+			a.Database.SSLMode = *dbSSL
+		case "dbtimeout":
+			a.Database.QueryTimeout = *dbTimeout
+		case "dbpath":
+			a.Database.Path = *dbPath
+		case "mailtransport":
+			a.Mail.Transport = *mailTransport
+		case "mailhost":
+			a.Mail.Host = *mailHost
+		case "mailport":
+			a.Mail.Port = *mailPort
+		case "mailuser":
+			a.Mail.Username = *mailUser
+		case "mailpass":
+			a.Mail.Password = *mailPass
+		case "mailencryption":
+			a.Mail.Encryption = *mailEncryption
+		case "maildir":
+			a.Mail.Dir = *mailDir
+		case "mailworkers":
+			a.Mail.Workers = *mailWorkers
+		case "mailattempts":
+			a.Mail.MaxAttempts = *mailAttempts
+		case "mailretry":
+			a.Mail.RetryDelay = *mailRetry
+		case "mailfrom":
+			a.Mail.From = *mailFrom
+		case "mailowner":
+			a.Mail.Owner = *mailOwner
+		case "cancelwindow":
+			a.Booking.CancellationWindow = *cancelWindow
+		}
+	})
+
+	problems = append(problems, validate(a)...)
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  - " + strings.Join(problems, "\n  - "))
+	}
+
+	if a.URL == "" {
+		a.URL = fmt.Sprintf("http://localhost:%d", a.Port)
+	}
+
+	if a.Secret == "" {
+		// tokens signed with a random key do not survive a restart, which is fine for development
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		a.Secret = hex.EncodeToString(key)
+	}
+
+	return nil
+}
+
+// DSN returns the connection string for the database
+func (d DatabaseConfig) DSN() string {
+	dsn := fmt.Sprintf("host=%s port=%d dbname=%s user=%s sslmode=%s",
+		dsnValue(d.Host), d.Port, dsnValue(d.Name), dsnValue(d.User), dsnValue(d.SSLMode))
+	if d.Password != "" {
+		dsn = fmt.Sprintf("%s password=%s", dsn, dsnValue(d.Password))
+	}
+
+	return dsn
+}
+
+// dsnValue quotes a value of the connection string the way libpq expects, when it is empty or holds
+// spaces, quotes or backslashes
+func dsnValue(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\r'\\") {
+		return s
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// setDefaults sets the values used when a setting is not given anywhere
+func setDefaults(a *AppConfig) {
+	a.Port = 8080
+	a.URL = ""
+	a.Secret = ""
+	a.InProduction = false
+	a.UseCache = false
+	a.Database = DatabaseConfig{
+		Driver: "postgres",
+		Host: "localhost",
+		Port: 5432,
+		SSLMode: "disable",
+		QueryTimeout: 3 * time.Second,
+		Path: "bookings.db",
+	}
+	a.Mail = MailConfig{
+		Transport: MailTransportSMTP,
+		Host: "localhost",
+		Port: 1025,
+		Encryption: MailEncryptionNone,
+		Dir: "mail",
+		Workers: 2,
+		MaxAttempts: 8,
+		RetryDelay: time.Minute,
+		From: "me@here.com",
+		Owner: "me@here.com",
+	}
+	a.Booking = BookingConfig{
+		CancellationWindow: 48 * time.Hour,
+	}
+}
+
+// loadFile reads settings from the YAML file at path
+func loadFile(a *AppConfig, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	fc := fileConfig{
+		Database: a.Database,
+		Mail: a.Mail,
+		Booking: a.Booking,
+	}
+
+	err = yaml.Unmarshal(data, &fc)
+	if err != nil {
+		return fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+
+	if fc.Port != nil {
+		a.Port = *fc.Port
+	}
+	if fc.URL != nil {
+		a.URL = *fc.URL
+	}
+	if fc.Secret != nil {
+		a.Secret = *fc.Secret
+	}
+	if fc.InProduction != nil {
+		a.InProduction = *fc.InProduction
+	}
+	if fc.UseCache != nil {
+		a.UseCache = *fc.UseCache
+	}
+	a.Database = fc.Database
+	a.Mail = fc.Mail
+	a.Booking = fc.Booking
+
+	return nil
+}
+
+// loadEnv reads settings from BOOKINGS_* environment variables and returns any values it cannot parse
+func loadEnv(a *AppConfig) []string {
+	var problems []string
+
+	envString := func(name string, target *string) {
+		if v, ok := os.LookupEnv(envPrefix + name); ok {
+			*target = v
+		}
+	}
+
+	envInt := func(name string, target *int) {
+		if v, ok := os.LookupEnv(envPrefix + name); ok {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s%s must be a number, got %q", envPrefix, name, v))
+				return
+			}
+			*target = i
+		}
+	}
+
+	envBool := func(name string, target *bool) {
+		if v, ok := os.LookupEnv(envPrefix + name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s%s must be true or false, got %q", envPrefix, name, v))
+				return
+			}
+			*target = b
+		}
+	}
+
+	envDuration := func(name string, target *time.Duration) {
+		if v, ok := os.LookupEnv(envPrefix + name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s%s must be a duration such as 3s, got %q", envPrefix, name, v))
+				return
+			}
+			*target = d
+		}
+	}
+
+	envInt("PORT", &a.Port)
+	envString("URL", &a.URL)
+	envString("SECRET", &a.Secret)
+	envBool("IN_PRODUCTION", &a.InProduction)
+	envBool("USE_CACHE", &a.UseCache)
+	envString("DB_DRIVER", &a.Database.Driver)
+	envString("DB_HOST", &a.Database.Host)
+	envInt("DB_PORT", &a.Database.Port)
+	envString("DB_NAME", &a.Database.Name)
+	envString("DB_USER", &a.Database.User)
+	envString("DB_PASSWORD", &a.Database.Password)
+	envString("DB_SSLMODE", &a.Database.SSLMode)
+	envDuration("DB_QUERY_TIMEOUT", &a.Database.QueryTimeout)
+	envString("DB_PATH", &a.Database.Path)
+	envString("MAIL_TRANSPORT", &a.Mail.Transport)
+	envString("MAIL_HOST", &a.Mail.Host)
+	envInt("MAIL_PORT", &a.Mail.Port)
+	envString("MAIL_USER", &a.Mail.Username)
+	envString("MAIL_PASSWORD", &a.Mail.Password)
+	envString("MAIL_ENCRYPTION", &a.Mail.Encryption)
+	envString("MAIL_DIR", &a.Mail.Dir)
+	envInt("MAIL_WORKERS", &a.Mail.Workers)
+	envInt("MAIL_MAX_ATTEMPTS", &a.Mail.MaxAttempts)
+	envDuration("MAIL_RETRY_DELAY", &a.Mail.RetryDelay)
+	envString("MAIL_FROM", &a.Mail.From)
+	envString("MAIL_OWNER", &a.Mail.Owner)
+	envDuration("CANCELLATION_WINDOW", &a.Booking.CancellationWindow)
+
+	return problems
+}
+
+// validate checks that all required settings are present and sane
+func validate(a *AppConfig) []string {
+	var problems []string
+
+	if a.Port < 1 || a.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port must be between 1 and 65535, got %d", a.Port))
+	}
+
+	if a.URL != "" {
+		u, err := url.Parse(a.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("url must be an absolute http or https URL, got %q", a.URL))
+		}
+	}
+
+	if a.Secret == "" && a.InProduction {
+		problems = append(problems, "secret is required in production (-secret or BOOKINGS_SECRET)")
+	} else if a.Secret != "" && len(a.Secret) < 32 {
+		problems = append(problems, "secret must be at least 32 characters long")
+	}
+
+	if !contains(dbDrivers, a.Database.Driver) {
+		problems = append(problems, fmt.Sprintf("database driver must be one of %s, got %q", strings.Join(dbDrivers, ", "), a.Database.Driver))
+	}
+	// only postgres needs connection settings, sqlite needs a file and memory keeps everything in the process
+	if a.Database.Driver == "sqlite" && a.Database.Path == "" {
+		problems = append(problems, "database path is required for sqlite (-dbpath or BOOKINGS_DB_PATH)")
+	}
+	if a.Database.Driver == "postgres" {
+		if a.Database.Host == "" {
+			problems = append(problems, "database host is required (-dbhost or BOOKINGS_DB_HOST)")
+		}
+		if a.Database.Port < 1 || a.Database.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("database port must be between 1 and 65535, got %d", a.Database.Port))
+		}
+		if a.Database.Name == "" {
+			problems = append(problems, "database name is required (-dbname or BOOKINGS_DB_NAME)")
+		}
+		if a.Database.User == "" {
+			problems = append(problems, "database user is required (-dbuser or BOOKINGS_DB_USER)")
+		}
+		if !contains(sslModes, a.Database.SSLMode) {
+			problems = append(problems, fmt.Sprintf("database sslmode must be one of %s, got %q", strings.Join(sslModes, ", "), a.Database.SSLMode))
+		}
+	}
+	if a.Database.QueryTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("database query timeout must be positive, got %s", a.Database.QueryTimeout))
+	}
+
+	if !contains(mailTransports, a.Mail.Transport) {
+		problems = append(problems, fmt.Sprintf("mail transport must be one of %s, got %q", strings.Join(mailTransports, ", "), a.Mail.Transport))
+	}
+	// only smtp needs a mail server, file needs a directory and log sends nothing
+	if a.Mail.Transport == MailTransportSMTP {
+		if a.Mail.Host == "" {
+			problems = append(problems, "mail host is required (-mailhost or BOOKINGS_MAIL_HOST)")
+		}
+		if a.Mail.Port < 1 || a.Mail.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("mail port must be between 1 and 65535, got %d", a.Mail.Port))
+		}
+		if !contains(mailEncryptions, a.Mail.Encryption) {
+			problems = append(problems, fmt.Sprintf("mail encryption must be one of %s, got %q", strings.Join(mailEncryptions, ", "), a.Mail.Encryption))
+		}
+	}
+	if a.Mail.Transport == MailTransportFile && a.Mail.Dir == "" {
+		problems = append(problems, "mail directory is required for the file transport (-maildir or BOOKINGS_MAIL_DIR)")
+	}
+	if a.Mail.Workers < 1 {
+		problems = append(problems, fmt.Sprintf("mail workers must be at least 1, got %d", a.Mail.Workers))
+	}
+	if a.Mail.MaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("mail max attempts must be at least 1, got %d", a.Mail.MaxAttempts))
+	}
+	if a.Mail.RetryDelay <= 0 {
+		problems = append(problems, fmt.Sprintf("mail retry delay must be positive, got %s", a.Mail.RetryDelay))
+	}
+	if _, err := mail.ParseAddress(a.Mail.From); err != nil {
+		problems = append(problems, fmt.Sprintf("mail from must be an email address, got %q", a.Mail.From))
+	}
+	if _, err := mail.ParseAddress(a.Mail.Owner); err != nil {
+		problems = append(problems, fmt.Sprintf("mail owner must be an email address, got %q", a.Mail.Owner))
+	}
+
+	if a.Booking.CancellationWindow < 0 {
+		problems = append(problems, fmt.Sprintf("cancellation window cannot be negative, got %s", a.Booking.CancellationWindow))
+	}
+
+	return problems
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
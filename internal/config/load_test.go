@@ -0,0 +1,246 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	var a AppConfig
+
+	err := Load(&a, []string{"-dbname=bookings", "-dbuser=postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Port != 8080 {
+		t.Errorf("expected default port 8080, got %d", a.Port)
+	}
+
+	if a.Mail.Host != "localhost" || a.Mail.Port != 1025 {
+		t.Errorf("expected default mail server localhost:1025, got %s:%d", a.Mail.Host, a.Mail.Port)
+	}
+
+	if a.Mail.Workers != 2 || a.Mail.MaxAttempts != 8 || a.Mail.RetryDelay != time.Minute {
+		t.Errorf("unexpected default mail queue settings %+v", a.Mail)
+	}
+
+	if a.Mail.From != "me@here.com" || a.Mail.Owner != "me@here.com" {
+		t.Errorf("unexpected default mail addresses %s and %s", a.Mail.From, a.Mail.Owner)
+	}
+
+	if a.URL != "http://localhost:8080" {
+		t.Errorf("expected default url http://localhost:8080, got %s", a.URL)
+	}
+
+	if len(a.Secret) < 32 {
+		t.Errorf("expected a random secret in development, got %q", a.Secret)
+	}
+
+	if a.Database.QueryTimeout != 3*time.Second {
+		t.Errorf("expected default query timeout 3s, got %s", a.Database.QueryTimeout)
+	}
+
+	if a.Booking.CancellationWindow != 48*time.Hour {
+		t.Errorf("expected default cancellation window 48h, got %s", a.Booking.CancellationWindow)
+	}
+
+	dsn := a.Database.DSN()
+	if dsn != "host=localhost port=5432 dbname=bookings user=postgres sslmode=disable" {
+		t.Errorf("unexpected dsn %q", dsn)
+	}
+}
+
+func TestDatabaseConfig_DSN(t *testing.T) {
+	tests := []struct {
+		name		string
+		config		DatabaseConfig
+		expected	string
+	}{
+		{"plain", DatabaseConfig{Host: "localhost", Port: 5432, Name: "bookings", User: "postgres", SSLMode: "disable", Password: "secret"},
+			"host=localhost port=5432 dbname=bookings user=postgres sslmode=disable password=secret"},
+		{"spaces and quotes", DatabaseConfig{Host: "localhost", Port: 5432, Name: "my bookings", User: "postgres", SSLMode: "disable", Password: `it's a \secret`},
+			`host=localhost port=5432 dbname='my bookings' user=postgres sslmode=disable password='it\'s a \\secret'`},
+		{"empty", DatabaseConfig{Port: 5432, Name: "bookings", User: "postgres", SSLMode: "disable"},
+			"host='' port=5432 dbname=bookings user=postgres sslmode=disable"},
+	}
+
+	for _, e := range tests {
+		if dsn := e.config.DSN(); dsn != e.expected {
+			t.Errorf("%s: expected dsn %q, got %q", e.name, e.expected, dsn)
+		}
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookings.yml")
+	content := `
+port: 9000
+in_production: true
+secret: 0123456789abcdef0123456789abcdef
+database:
+  host: db.internal
+  name: fromfile
+  user: fileuser
+  query_timeout: 10s
+mail:
+  host: relay.internal
+  max_attempts: 5
+  from: bookings@fromfile.com
+  owner: owner@fromfile.com
+booking:
+  cancellation_window: 24h
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("BOOKINGS_DB_NAME", "fromenv")
+	t.Setenv("BOOKINGS_MAIL_PORT", "2525")
+	t.Setenv("BOOKINGS_MAIL_RETRY_DELAY", "30s")
+	t.Setenv("BOOKINGS_MAIL_OWNER", "owner@fromenv.com")
+
+	var a AppConfig
+	err := Load(&a, []string{"-config", path, "-port", "9100", "-mailworkers", "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Port != 9100 {
+		t.Errorf("flag should override file port, got %d", a.Port)
+	}
+
+	if !a.InProduction {
+		t.Error("in_production from file was not applied")
+	}
+
+	if a.Database.Host != "db.internal" {
+		t.Errorf("expected database host from file, got %s", a.Database.Host)
+	}
+
+	if a.Database.Port != 5432 {
+		t.Errorf("default database port should survive file load, got %d", a.Database.Port)
+	}
+
+	if a.Database.QueryTimeout != 10*time.Second {
+		t.Errorf("expected database query timeout from file, got %s", a.Database.QueryTimeout)
+	}
+
+	if a.Database.Name != "fromenv" {
+		t.Errorf("environment should override file database name, got %s", a.Database.Name)
+	}
+
+	if a.Mail.Host != "relay.internal" || a.Mail.Port != 2525 {
+		t.Errorf("unexpected mail server %s:%d", a.Mail.Host, a.Mail.Port)
+	}
+
+	if a.Mail.Workers != 4 || a.Mail.MaxAttempts != 5 || a.Mail.RetryDelay != 30*time.Second {
+		t.Errorf("unexpected mail queue settings %+v", a.Mail)
+	}
+
+	if a.Mail.From != "bookings@fromfile.com" || a.Mail.Owner != "owner@fromenv.com" {
+		t.Errorf("unexpected mail addresses %s and %s", a.Mail.From, a.Mail.Owner)
+	}
+
+	if a.Booking.CancellationWindow != 24*time.Hour {
+		t.Errorf("expected cancellation window from file, got %s", a.Booking.CancellationWindow)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	t.Setenv("BOOKINGS_MAIL_PORT", "smtp")
+	t.Setenv("BOOKINGS_DB_QUERY_TIMEOUT", "soon")
+
+	var a AppConfig
+	err := Load(&a, []string{"-dbssl=sometimes", "-port=0", "-production", "-url=localhost", "-cancelwindow=-1h", "-mailworkers=0"})
+	if err == nil {
+		t.Fatal("expected error for invalid configuration")
+	}
+
+	for _, want := range []string{"BOOKINGS_MAIL_PORT", "BOOKINGS_DB_QUERY_TIMEOUT", "port must be between", "database name is required", "database user is required", "sslmode", "secret is required", "url must be", "cancellation window", "mail workers"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got:\n%s", want, err)
+		}
+	}
+}
+
+func TestLoad_MemoryDriver(t *testing.T) {
+	var a AppConfig
+	err := Load(&a, []string{"-dbdriver=memory", "-dbssl=sometimes"})
+	if err != nil {
+		t.Fatalf("memory driver should not need database connection settings: %s", err)
+	}
+
+	if a.Database.Driver != "memory" {
+		t.Errorf("expected memory driver, got %s", a.Database.Driver)
+	}
+
+	err = Load(&a, []string{"-dbdriver=mysql", "-dbname=bookings", "-dbuser=postgres"})
+	if err == nil || !strings.Contains(err.Error(), "database driver must be one of") {
+		t.Errorf("expected error for unknown driver, got %v", err)
+	}
+}
+
+func TestLoad_SQLiteDriver(t *testing.T) {
+	t.Setenv("BOOKINGS_DB_DRIVER", "sqlite")
+
+	var a AppConfig
+	err := Load(&a, nil)
+	if err != nil {
+		t.Fatalf("sqlite driver should not need database connection settings: %s", err)
+	}
+
+	if a.Database.Path != "bookings.db" {
+		t.Errorf("expected default database path bookings.db, got %s", a.Database.Path)
+	}
+
+	err = Load(&a, []string{"-dbpath="})
+	if err == nil || !strings.Contains(err.Error(), "database path is required") {
+		t.Errorf("expected error for empty path, got %v", err)
+	}
+}
+
+func TestLoad_MailTransport(t *testing.T) {
+	var a AppConfig
+	err := Load(&a, []string{"-dbdriver=memory", "-mailtransport=file", "-mailhost=", "-mailencryption=maybe"})
+	if err != nil {
+		t.Fatalf("file transport should not need mail server settings: %s", err)
+	}
+
+	if a.Mail.Transport != MailTransportFile || a.Mail.Dir != "mail" {
+		t.Errorf("expected file transport saving to mail, got %s %s", a.Mail.Transport, a.Mail.Dir)
+	}
+
+	t.Setenv("BOOKINGS_MAIL_ENCRYPTION", "starttls")
+	t.Setenv("BOOKINGS_MAIL_USER", "bookings")
+
+	err = Load(&a, []string{"-dbdriver=memory", "-mailpass=secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Mail.Transport != MailTransportSMTP || a.Mail.Encryption != MailEncryptionSTARTTLS || a.Mail.Username != "bookings" || a.Mail.Password != "secret" {
+		t.Errorf("unexpected smtp settings %+v", a.Mail)
+	}
+
+	tests := []struct {
+		args	[]string
+		want	string
+	}{
+		{[]string{"-mailtransport=pigeon"}, "mail transport must be one of"},
+		{[]string{"-mailencryption=maybe"}, "mail encryption must be one of"},
+		{[]string{"-mailtransport=file", "-maildir="}, "mail directory is required"},
+		{[]string{"-mailfrom=bookings"}, "mail from must be an email address"},
+		{[]string{"-mailowner="}, "mail owner must be an email address"},
+	}
+
+	for _, e := range tests {
+		err = Load(&a, append([]string{"-dbdriver=memory"}, e.args...))
+		if err == nil || !strings.Contains(err.Error(), e.want) {
+			t.Errorf("%v: expected error to mention %q, got %v", e.args, e.want, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package driver
+
+import (
+	"database/sql"
+	"net/url"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqlitePragmas are applied to every SQLite connection
+var sqlitePragmas = []string{
+	"foreign_keys(1)",
+	"busy_timeout(5000)",
+	"journal_mode(WAL)",
+}
+
+// ConnectSQLite opens the SQLite database file at path, creating it if it does not exist
+func ConnectSQLite(path string) (*DB, error) {
+	q := url.Values{}
+	q.Set("_time_format", "sqlite")
+	for _, p := range sqlitePragmas {
+		q.Add("_pragma", p)
+	}
+
+	d, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows one writer at a time, a single connection serializes transactions
+	// instead of failing them with SQLITE_BUSY
+	d.SetMaxOpenConns(1)
+	d.SetConnMaxLifetime(0)
+
+	err = testDB(d)
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return &DB{SQL: d}, nil
+}
@@ -0,0 +1,138 @@
+// Package emails holds the typed data of every email the site sends and renders it with the html
+// and plain text templates in email-templates
+package emails
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/pricing"
+)
+
+// Names of the email templates, each with a .page.html and a .page.txt file
+const (
+	TemplateConfirmation		= "reservation-confirmation"
+	TemplateDatesChanged		= "reservation-changed"
+	TemplateCancellation		= "reservation-cancelled"
+	TemplateReminder			= "reservation-reminder"
+	TemplateOwnerNotification	= "owner-notification"
+	TemplatePasswordReset		= "password-reset"
+)
+
+// Events the owner is notified about
+const (
+	EventBooked		= "booked"
+	EventMoved		= "moved"
+	EventCancelled	= "cancelled"
+)
+
+// Data is the data of one of the email templates
+type Data interface {
+	template() string
+}
+
+// dataTypes returns an empty value of the data type of every template, to decode queued emails into
+var dataTypes = map[string]func() Data{
+	TemplateConfirmation: func() Data { return &Confirmation{} },
+	TemplateDatesChanged: func() Data { return &DatesChanged{} },
+	TemplateCancellation: func() Data { return &Cancellation{} },
+	TemplateReminder: func() Data { return &Reminder{} },
+	TemplateOwnerNotification: func() Data { return &OwnerNotification{} },
+	TemplatePasswordReset: func() Data { return &PasswordReset{} },
+}
+
+// Stay describes a reservation in emails
+type Stay struct {
+	ReservationID	int
+	FirstName		string
+	LastName		string
+	Email			string
+	RoomName		string
+	StartDate		time.Time
+	EndDate			time.Time
+	Adults			int
+	Children		int
+	// Price is the quoted total, empty when the price is on request
+	Price			string
+}
+
+// NewStay returns the Stay of res
+func NewStay(res models.Reservation) Stay {
+	s := Stay{
+		ReservationID: res.ID,
+		FirstName: res.FirstName,
+		LastName: res.LastName,
+		Email: res.Email,
+		RoomName: res.Room.RoomName,
+		StartDate: res.StartDate,
+		EndDate: res.EndDate,
+		Adults: res.Adults,
+		Children: res.Children,
+	}
+
+	if !res.Quote.IsZero() {
+		s.Price = pricing.FormatMoney(res.Quote.Total, res.Quote.Currency)
+	}
+
+	return s
+}
+
+// Confirmation is sent to a guest who has just booked
+type Confirmation struct {
+	Stay
+	ManageLink	string
+}
+
+// DatesChanged is sent to a guest who has moved a reservation to other dates
+type DatesChanged struct {
+	Stay
+	ManageLink	string
+}
+
+// Cancellation is sent to a guest whose reservation has been cancelled
+type Cancellation struct {
+	Stay
+}
+
+// Reminder is sent to a guest shortly before arrival
+type Reminder struct {
+	Stay
+	ManageLink	string
+}
+
+// OwnerNotification tells the owner that a reservation was booked, moved or cancelled. The previous
+// dates are only set for moved reservations
+type OwnerNotification struct {
+	Event				string
+	Stay
+	PreviousStartDate	time.Time
+	PreviousEndDate		time.Time
+}
+
+// PasswordReset is sent to a user who asked to reset their password
+type PasswordReset struct {
+	FirstName	string
+	Link		string
+}
+
+func (Confirmation) template() string { return TemplateConfirmation }
+func (DatesChanged) template() string { return TemplateDatesChanged }
+func (Cancellation) template() string { return TemplateCancellation }
+func (Reminder) template() string { return TemplateReminder }
+func (OwnerNotification) template() string { return TemplateOwnerNotification }
+func (PasswordReset) template() string { return TemplatePasswordReset }
+
+// Message returns the email to to, rendered from data when it is sent
+func Message(to, from, subject string, data Data) models.MailData {
+	// the data types only hold strings, numbers and times, which always encode
+	raw, _ := json.Marshal(data)
+
+	return models.MailData{
+		To: to,
+		From: from,
+		Subject: subject,
+		Template: data.template(),
+		Data: raw,
+	}
+}
@@ -0,0 +1,92 @@
+package emails
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"path/filepath"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+)
+
+var functions = map[string]interface{}{
+	"humanDate": humanDate,
+}
+
+// humanDate returns t in dd-mm-yyyy format
+func humanDate(t time.Time) string {
+	return t.Format("02-01-2006")
+}
+
+// Templates holds the parsed html and plain text email templates
+type Templates struct {
+	html	map[string]*htmltemplate.Template
+	text	map[string]*texttemplate.Template
+}
+
+// Load parses the email templates in dir: for every template name a <name>.page.html and a
+// <name>.page.txt, sharing the *.layout.html and *.layout.txt files
+func Load(dir string) (*Templates, error) {
+	t := &Templates{
+		html: make(map[string]*htmltemplate.Template),
+		text: make(map[string]*texttemplate.Template),
+	}
+
+	for name := range dataTypes {
+		page := filepath.Join(dir, name+".page.html")
+		html, err := htmltemplate.New(filepath.Base(page)).Funcs(functions).ParseFiles(page)
+		if err != nil {
+			return nil, err
+		}
+		html, err = html.ParseGlob(filepath.Join(dir, "*.layout.html"))
+		if err != nil {
+			return nil, err
+		}
+
+		page = filepath.Join(dir, name+".page.txt")
+		text, err := texttemplate.New(filepath.Base(page)).Funcs(functions).ParseFiles(page)
+		if err != nil {
+			return nil, err
+		}
+		text, err = text.ParseGlob(filepath.Join(dir, "*.layout.txt"))
+		if err != nil {
+			return nil, err
+		}
+
+		t.html[name] = html
+		t.text[name] = text
+	}
+
+	return t, nil
+}
+
+// Render returns the html and plain text bodies of msg
+func (t *Templates) Render(msg models.MailData) (string, string, error) {
+	newData, ok := dataTypes[msg.Template]
+	if !ok {
+		return "", "", fmt.Errorf("unknown email template %q", msg.Template)
+	}
+
+	data := newData()
+	err := json.Unmarshal(msg.Data, data)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot decode data of %s email: %w", msg.Template, err)
+	}
+
+	var html, text bytes.Buffer
+
+	err = t.html[msg.Template].Execute(&html, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = t.text[msg.Template].Execute(&text, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	return html.String(), text.String(), nil
+}
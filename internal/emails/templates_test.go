@@ -0,0 +1,125 @@
+package emails
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+)
+
+const pathToTemplates = "./../../email-templates"
+
+func testStay() Stay {
+	return NewStay(models.Reservation{
+		ID: 7,
+		FirstName: "<b>John</b>",
+		LastName: "Smith",
+		Email: "john@smith.com",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Adults: 2,
+		Room: models.Room{RoomName: "General's Quarters"},
+		Quote: models.Quote{Currency: "USD", Total: 22000},
+	})
+}
+
+func TestRender(t *testing.T) {
+	templates, err := Load(pathToTemplates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stay := testStay()
+	link := "http://localhost:8080/manage-booking?token=a&b"
+
+	tests := []struct {
+		name		string
+		data		Data
+		expected	[]string
+	}{
+		{"confirmation", Confirmation{Stay: stay, ManageLink: link}, []string{"Reservation Confirmation", "01-01-2050 to 03-01-2050", "USD 220.00"}},
+		{"dates changed", DatesChanged{Stay: stay, ManageLink: link}, []string{"is now from 01-01-2050 to 03-01-2050", "New total: USD 220.00"}},
+		{"cancellation", Cancellation{Stay: stay}, []string{"has been cancelled"}},
+		{"reminder", Reminder{Stay: stay, ManageLink: link}, []string{"starts on 01-01-2050"}},
+		{"booked", OwnerNotification{Event: EventBooked, Stay: stay}, []string{"john@smith.com", "for 2 adults and 0 children"}},
+		{"moved", OwnerNotification{Event: EventMoved, Stay: stay, PreviousStartDate: stay.StartDate.AddDate(0, 0, -7), PreviousEndDate: stay.EndDate.AddDate(0, 0, -7)},
+			[]string{"moved reservation 7", "25-12-2049 - 27-12-2049", "01-01-2050 - 03-01-2050"}},
+		{"cancelled", OwnerNotification{Event: EventCancelled, Stay: stay}, []string{"cancelled reservation 7"}},
+		{"password reset", PasswordReset{FirstName: "John", Link: link}, []string{"within an hour"}},
+	}
+
+	for _, e := range tests {
+		msg := Message("john@smith.com", "me@here.com", "Subject", e.data)
+
+		html, text, err := templates.Render(msg)
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+
+		for _, want := range e.expected {
+			if !strings.Contains(html, want) || !strings.Contains(text, want) {
+				t.Errorf("%s: expected both bodies to contain %q, got\n%s\n%s", e.name, want, html, text)
+			}
+		}
+
+		if strings.Contains(html, "<b>John</b>") {
+			t.Errorf("%s: guest name was not escaped in the html body", e.name)
+		}
+
+		if strings.Contains(text, "&lt;") || strings.Contains(text, "<p>") {
+			t.Errorf("%s: unexpected html in the text body:\n%s", e.name, text)
+		}
+
+		if strings.Contains(msg.Template, "confirmation") && !strings.Contains(html, `href="http://localhost:8080/manage-booking?token=a&amp;b"`) {
+			t.Errorf("%s: expected the manage link in the html body, got\n%s", e.name, html)
+		}
+	}
+}
+
+func TestRender_Invalid(t *testing.T) {
+	templates, err := Load(pathToTemplates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name	string
+		msg		models.MailData
+	}{
+		{"unknown template", models.MailData{Template: "basic.html", Data: json.RawMessage(`{}`)}},
+		{"invalid data", models.MailData{Template: TemplateConfirmation, Data: json.RawMessage(`{"StartDate": "soon"}`)}},
+	}
+
+	for _, e := range tests {
+		_, _, err := templates.Render(e.msg)
+		if err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestLoad_MissingTemplate(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"base.layout.html", "base.layout.txt", "password-reset.page.html"} {
+		data, err := ioutil.ReadFile(filepath.Join(pathToTemplates, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(filepath.Join(dir, name), data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := Load(dir)
+	if err == nil {
+		t.Error("expected an error when templates are missing")
+	}
+}
@@ -3,6 +3,7 @@ package forms
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/asaskevich/govalidator"
@@ -63,4 +64,14 @@ func (f *Form) IsEmail(field string) bool {
 		return false
 	}
 	return true
-}
\ No newline at end of file
+}
+
+// MinInt checks that a field is a whole number of at least min
+func (f *Form) MinInt(field string, min int) bool {
+	n, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil || n < min {
+		f.Errors.Add(field, fmt.Sprintf("This field must be a whole number of at least %d!", min))
+		return false
+	}
+	return true
+}
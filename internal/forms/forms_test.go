@@ -125,4 +125,28 @@ func TestForm_IsEmail(t *testing.T) {
 	if form.Valid() {
 		t.Error("got valid for invalid email address")
 	}
-}
\ No newline at end of file
+}
+
+func TestForm_MinInt(t *testing.T) {
+	tests := []struct {
+		value	string
+		valid	bool
+	}{
+		{"2", true},
+		{" 1 ", true},
+		{"0", false},
+		{"-3", false},
+		{"two", false},
+		{"", false},
+	}
+
+	for _, e := range tests {
+		postedValues := url.Values{}
+		postedValues.Add("adults", e.value)
+		form := New(postedValues)
+
+		if form.MinInt("adults", 1) != e.valid || form.Valid() != e.valid {
+			t.Errorf("for %q expected valid to be %t", e.value, e.valid)
+		}
+	}
+}
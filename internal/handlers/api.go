@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/marif226/bookings/internal/forms"
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/pricing"
+	"github.com/marif226/bookings/internal/repository"
+	"github.com/marif226/bookings/internal/stayrules"
+)
+
+// apiDateLayout is the date format accepted and returned by the JSON API
+const apiDateLayout = "2006-01-02"
+
+// maxAPIBodySize limits the size of JSON request bodies
+const maxAPIBodySize = 1 << 20
+
+// apiEnvelope wraps every successful JSON API response
+type apiEnvelope struct {
+	Data	interface{}	`json:"data"`
+}
+
+// apiRoom is the JSON API representation of a room
+type apiRoom struct {
+	ID		int		`json:"id"`
+	Name	string	`json:"name"`
+}
+
+// apiAvailability is the JSON API representation of a room availability search
+type apiAvailability struct {
+	RoomID		int		`json:"room_id"`
+	StartDate	string	`json:"start_date"`
+	EndDate		string	`json:"end_date"`
+	Available	bool	`json:"available"`
+}
+
+// apiReservation is the JSON API representation of a reservation
+type apiReservation struct {
+	ID			int		`json:"id"`
+	FirstName	string	`json:"first_name"`
+	LastName	string	`json:"last_name"`
+	Email		string	`json:"email"`
+	Phone		string	`json:"phone"`
+	StartDate	string	`json:"start_date"`
+	EndDate		string	`json:"end_date"`
+	Adults		int		`json:"adults"`
+	Children	int		`json:"children"`
+	Room		apiRoom	`json:"room"`
+	Status		string	`json:"status"`
+	Currency	string	`json:"currency,omitempty"`
+	TotalPrice	string	`json:"total_price,omitempty"`
+}
+
+// apiReservationRequest is the body accepted by APIPostReservation
+type apiReservationRequest struct {
+	FirstName	string	`json:"first_name"`
+	LastName	string	`json:"last_name"`
+	Email		string	`json:"email"`
+	Phone		string	`json:"phone"`
+	StartDate	string	`json:"start_date"`
+	EndDate		string	`json:"end_date"`
+	RoomID		int		`json:"room_id"`
+	Adults		int		`json:"adults"`
+	Children	int		`json:"children"`
+}
+
+func newAPIRoom(room models.Room) apiRoom {
+	return apiRoom{
+		ID: room.ID,
+		Name: room.RoomName,
+	}
+}
+
+func newAPIReservation(res models.Reservation) apiReservation {
+	apiRes := apiReservation{
+		ID: res.ID,
+		FirstName: res.FirstName,
+		LastName: res.LastName,
+		Email: res.Email,
+		Phone: res.Phone,
+		StartDate: res.StartDate.Format(apiDateLayout),
+		EndDate: res.EndDate.Format(apiDateLayout),
+		Adults: res.Adults,
+		Children: res.Children,
+		Room: newAPIRoom(res.Room),
+		Status: string(res.Status),
+	}
+
+	// reservations made before rates were introduced have no price
+	if !res.Quote.IsZero() {
+		apiRes.Currency = res.Quote.Currency
+		apiRes.TotalPrice = pricing.FormatAmount(res.Quote.Total)
+	}
+
+	return apiRes
+}
+
+// APIRooms returns all rooms
+func (m *Repository) APIRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerErrorJSON(w, err)
+		return
+	}
+
+	data := []apiRoom{}
+	for _, room := range rooms {
+		data = append(data, newAPIRoom(room))
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, apiEnvelope{Data: data})
+}
+
+// APIRoomAvailability reports whether a room is free between the start and end query parameters
+func (m *Repository) APIRoomAvailability(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.apiRoomByID(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	startDate, err := time.Parse(apiDateLayout, r.URL.Query().Get("start"))
+	if err != nil {
+		helpers.ClientErrorJSON(w, http.StatusBadRequest, "start must be a date in YYYY-MM-DD format")
+		return
+	}
+
+	endDate, err := time.Parse(apiDateLayout, r.URL.Query().Get("end"))
+	if err != nil {
+		helpers.ClientErrorJSON(w, http.StatusBadRequest, "end must be a date in YYYY-MM-DD format")
+		return
+	}
+
+	if !endDate.After(startDate) {
+		helpers.ClientErrorJSON(w, http.StatusBadRequest, "end must be after start")
+		return
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(r.Context(), startDate, endDate, room.ID)
+	if err != nil {
+		helpers.ServerErrorJSON(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, apiEnvelope{Data: apiAvailability{
+		RoomID: room.ID,
+		StartDate: startDate.Format(apiDateLayout),
+		EndDate: endDate.Format(apiDateLayout),
+		Available: available,
+	}})
+}
+
+// APIPostReservation books a room from a JSON request body
+func (m *Repository) APIPostReservation(w http.ResponseWriter, r *http.Request) {
+	var req apiReservationRequest
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&req)
+	if err != nil {
+		helpers.ClientErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("cannot parse request body: %s", err))
+		return
+	}
+
+	// a booking without a party size is for one adult
+	if req.Adults == 0 && req.Children == 0 {
+		req.Adults = 1
+	}
+
+	form := forms.New(url.Values{
+		"first_name": {req.FirstName},
+		"last_name": {req.LastName},
+		"email": {req.Email},
+		"phone": {req.Phone},
+		"start_date": {req.StartDate},
+		"end_date": {req.EndDate},
+		"adults": {strconv.Itoa(req.Adults)},
+		"children": {strconv.Itoa(req.Children)},
+	})
+
+	form.Required("first_name", "last_name", "email", "start_date", "end_date")
+	form.MinLength("first_name", 3)
+	form.MinLength("last_name", 3)
+	form.IsEmail("email")
+	partySize(form)
+
+	startDate, err := time.Parse(apiDateLayout, req.StartDate)
+	if err != nil && form.Has("start_date") {
+		form.Errors.Add("start_date", "Must be a date in YYYY-MM-DD format!")
+	}
+
+	endDate, err := time.Parse(apiDateLayout, req.EndDate)
+	if err != nil && form.Has("end_date") {
+		form.Errors.Add("end_date", "Must be a date in YYYY-MM-DD format!")
+	} else if err == nil && !endDate.After(startDate) {
+		form.Errors.Add("end_date", "Must be after the start date!")
+	}
+
+	if req.RoomID < 1 {
+		form.Errors.Add("room_id", "This field cannot be blank!")
+	}
+
+	if !form.Valid() {
+		helpers.ValidationErrorJSON(w, form.Errors)
+		return
+	}
+
+	room, ok := m.apiRoomByID(w, r, strconv.Itoa(req.RoomID))
+	if !ok {
+		return
+	}
+
+	checkOccupancy(form, room, req.Adults+req.Children)
+
+	err = m.checkStayRules(r.Context(), room.ID, startDate, endDate)
+	if v, ok := err.(stayrules.Violation); ok {
+		form.Errors.Add("start_date", v.Error())
+	} else if err != nil {
+		helpers.ServerErrorJSON(w, err)
+		return
+	}
+
+	if !form.Valid() {
+		helpers.ValidationErrorJSON(w, form.Errors)
+		return
+	}
+
+	quote, err := m.quoteStay(r.Context(), room.ID, startDate, endDate, req.Adults+req.Children)
+	if err != nil {
+		helpers.ServerErrorJSON(w, err)
+		return
+	}
+
+	reservation := models.Reservation{
+		FirstName: req.FirstName,
+		LastName: req.LastName,
+		Email: req.Email,
+		Phone: req.Phone,
+		StartDate: startDate,
+		EndDate: endDate,
+		RoomID: room.ID,
+		Adults: req.Adults,
+		Children: req.Children,
+		Room: room,
+		Quote: quote,
+		Status: models.StatusPending,
+	}
+
+	reservation.ID, err = m.DB.InsertReservation(r.Context(), reservation, m.reservationNotifications)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		helpers.ClientErrorJSON(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		helpers.ServerErrorJSON(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/reservations/%d", reservation.ID))
+	helpers.WriteJSON(w, http.StatusCreated, apiEnvelope{Data: newAPIReservation(reservation)})
+}
+
+// APIReservation returns one reservation by id
+func (m *Repository) APIReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientErrorJSON(w, http.StatusNotFound, "reservation not found")
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientErrorJSON(w, http.StatusNotFound, "reservation not found")
+		return
+	} else if err != nil {
+		helpers.ServerErrorJSON(w, err)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, apiEnvelope{Data: newAPIReservation(res)})
+}
+
+// apiRoomByID looks up a room from a path or body id and writes the error response if it cannot
+func (m *Repository) apiRoomByID(w http.ResponseWriter, r *http.Request, param string) (models.Room, bool) {
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		helpers.ClientErrorJSON(w, http.StatusNotFound, "room not found")
+		return models.Room{}, false
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientErrorJSON(w, http.StatusNotFound, "room not found")
+		return room, false
+	} else if err != nil {
+		helpers.ServerErrorJSON(w, err)
+		return room, false
+	}
+
+	return room, true
+}
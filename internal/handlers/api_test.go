@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/marif226/bookings/internal/models"
+)
+
+// apiErrorResponse mirrors the error envelope written by the helpers package
+type apiErrorResponse struct {
+	Error struct {
+		Status	int					`json:"status"`
+		Message	string				`json:"message"`
+		Fields	map[string][]string	`json:"fields"`
+	} `json:"error"`
+}
+
+func TestRepository_APIRooms(t *testing.T) {
+	req := adminRequest("GET", "/api/v1/rooms", "", nil)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.APIRooms).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("APIRooms returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	var body struct {
+		Data []apiRoom `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal("failed to parse json:", err)
+	}
+
+	if len(body.Data) != 2 {
+		t.Errorf("expected 2 rooms, got %d", len(body.Data))
+	}
+}
+
+func TestRepository_APIRoomAvailability(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		query				string
+		expectedStatusCode	int
+		expectedAvailable	bool
+	}{
+		{"available", "1", "start=2050-01-01&end=2050-01-02", http.StatusOK, true},
+		{"not available", "2", "start=2050-01-01&end=2050-01-02", http.StatusOK, false},
+		{"missing room", "3", "start=2050-01-01&end=2050-01-02", http.StatusNotFound, false},
+		{"invalid room", "x", "start=2050-01-01&end=2050-01-02", http.StatusNotFound, false},
+		{"bad start", "1", "start=01-01-2050&end=2050-01-02", http.StatusBadRequest, false},
+		{"missing end", "1", "start=2050-01-01", http.StatusBadRequest, false},
+		{"end before start", "1", "start=2050-01-02&end=2050-01-01", http.StatusBadRequest, false},
+		{"database error", "1000", "start=2050-01-01&end=2050-01-02", http.StatusInternalServerError, false},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("GET", "/api/v1/rooms/"+e.id+"/availability?"+e.query, e.id, nil)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.APIRoomAvailability).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+			continue
+		}
+
+		if rr.Code == http.StatusOK {
+			var body struct {
+				Data apiAvailability `json:"data"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Errorf("%s: failed to parse json: %s", e.name, err)
+				continue
+			}
+			if body.Data.Available != e.expectedAvailable {
+				t.Errorf("%s: expected available %t but got %t", e.name, e.expectedAvailable, body.Data.Available)
+			}
+		} else {
+			var body apiErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Error.Status != rr.Code {
+				t.Errorf("%s: expected an error envelope but got %s", e.name, rr.Body.String())
+			}
+		}
+	}
+}
+
+func TestRepository_APIPostReservation(t *testing.T) {
+	tests := []struct {
+		name				string
+		body				string
+		expectedStatusCode	int
+		expectedFields		[]string
+	}{
+		{"valid", `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-01","end_date":"2050-01-02","room_id":1}`, http.StatusCreated, nil},
+		{"malformed", `{"first_name":`, http.StatusBadRequest, nil},
+		{"unknown field", `{"first_name":"John","nights":2}`, http.StatusBadRequest, nil},
+		{"invalid", `{"first_name":"J","email":"john","start_date":"01-01-2050","end_date":"2050-01-02"}`, http.StatusUnprocessableEntity, []string{"first_name", "last_name", "email", "start_date", "room_id"}},
+		{"end before start", `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-02","end_date":"2050-01-01","room_id":1}`, http.StatusUnprocessableEntity, []string{"end_date"}},
+		{"missing room", `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-01","end_date":"2050-01-02","room_id":3}`, http.StatusNotFound, nil},
+		{"too short over christmas", `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-12-24","end_date":"2050-12-25","room_id":1}`, http.StatusUnprocessableEntity, []string{"start_date"}},
+		{"in the past", `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2000-01-10","end_date":"2000-01-11","room_id":1}`, http.StatusUnprocessableEntity, []string{"start_date"}},
+		{"too long", `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-10","end_date":"3050-01-11","room_id":1}`, http.StatusUnprocessableEntity, []string{"start_date"}},
+		{"too many guests", `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-01","end_date":"2050-01-02","room_id":1,"adults":2,"children":3}`, http.StatusUnprocessableEntity, []string{"adults"}},
+		{"no adults", `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-01","end_date":"2050-01-02","room_id":1,"adults":0,"children":1}`, http.StatusUnprocessableEntity, []string{"adults"}},
+		{"not available", `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-01","end_date":"2050-01-02","room_id":2}`, http.StatusConflict, nil},
+		{"database error", `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-01","end_date":"2050-01-02","room_id":1000}`, http.StatusInternalServerError, nil},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/api/v1/reservations", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.APIPostReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d: %s", e.name, e.expectedStatusCode, rr.Code, rr.Body.String())
+			continue
+		}
+
+		if rr.Code == http.StatusCreated {
+			if rr.Header().Get("Location") != "/api/v1/reservations/1" {
+				t.Errorf("%s: unexpected location %q", e.name, rr.Header().Get("Location"))
+			}
+
+			var body struct {
+				Data apiReservation `json:"data"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Data.Status != string(models.StatusPending) {
+				t.Errorf("%s: expected a pending reservation but got %s", e.name, rr.Body.String())
+			}
+			continue
+		}
+
+		var body apiErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: expected an error envelope but got %s", e.name, rr.Body.String())
+			continue
+		}
+		for _, field := range e.expectedFields {
+			if len(body.Error.Fields[field]) == 0 {
+				t.Errorf("%s: expected an error for %s but got %v", e.name, field, body.Error.Fields)
+			}
+		}
+	}
+}
+
+func TestRepository_APIReservation(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		expectedStatusCode	int
+	}{
+		{"found", "1", http.StatusOK},
+		{"invalid id", "x", http.StatusNotFound},
+		{"not found", "1001", http.StatusNotFound},
+		{"database error", "1000", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("GET", "/api/v1/reservations/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.APIReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+			continue
+		}
+
+		if rr.Code == http.StatusOK {
+			var body struct {
+				Data apiReservation `json:"data"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Errorf("%s: failed to parse json: %s", e.name, err)
+			} else if body.Data.StartDate != "2050-01-01" || body.Data.Room.ID != 1 {
+				t.Errorf("%s: unexpected reservation %+v", e.name, body.Data)
+			}
+		}
+	}
+}
+
+func TestRepository_APIPostReservation_Memory(t *testing.T) {
+	repo := NewMemoryRepo(&app)
+	body := `{"first_name":"John","last_name":"Smith","email":"john@smith.com","start_date":"2050-01-01","end_date":"2050-01-03","room_id":1}`
+
+	tests := []struct {
+		name				string
+		body				string
+		expectedStatusCode	int
+	}{
+		{"booked", body, http.StatusCreated},
+		{"same dates", body, http.StatusConflict},
+		{"overlapping", strings.Replace(body, "2050-01-01", "2050-01-02", 1), http.StatusConflict},
+		{"next guest", strings.NewReplacer("2050-01-01", "2050-01-03", "2050-01-03", "2050-01-05").Replace(body), http.StatusCreated},
+		{"other room", strings.Replace(body, `"room_id":1`, `"room_id":2`, 1), http.StatusCreated},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/api/v1/reservations", "", nil)
+		req.Body = io.NopCloser(strings.NewReader(e.body))
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(repo.APIPostReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: returned wrong response code: got %d, wanted %d: %s", e.name, rr.Code, e.expectedStatusCode, rr.Body.String())
+		}
+	}
+
+	req := adminRequest("GET", "/api/v1/rooms/1/availability?start=2050-01-04&end=2050-01-06", "1", nil)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(repo.APIRoomAvailability).ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), `"available":false`) {
+		t.Errorf("expected room 1 to be booked on 2050-01-04, got %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/marif226/bookings/internal/forms"
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/render"
+)
+
+// AdminAPITokens lists API tokens, managers see every token and everyone else only their own
+func (m *Repository) AdminAPITokens(w http.ResponseWriter, r *http.Request) {
+	m.renderAPITokens(w, r, forms.New(nil))
+}
+
+// AdminPostAPIToken creates an API token for the logged in user
+func (m *Repository) AdminPostAPIToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+
+	scopes := r.Form["scopes"]
+	for _, scope := range scopes {
+		if !contains(models.APIScopes, scope) {
+			form.Errors.Add("scopes", "Unknown scope!")
+			break
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAPITokens(w, r, form)
+		return
+	}
+
+	token, err := helpers.NewAPIToken()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_, err = m.DB.InsertAPIToken(r.Context(), models.APIToken{
+		UserID: m.App.Session.GetInt(r.Context(), "user_id"),
+		Name: form.Get("name"),
+		TokenHash: helpers.HashAPIToken(token),
+		Scopes: scopes,
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// the token itself is never stored, so this is the only time it can be shown
+	m.App.Session.Put(r.Context(), "api_token", token)
+	m.App.Session.Put(r.Context(), "flash", "API token created")
+	http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+}
+
+// AdminRevokeAPIToken revokes an API token, managers may revoke anyone's token
+func (m *Repository) AdminRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	t, err := m.DB.GetAPITokenByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if t.UserID != m.App.Session.GetInt(r.Context(), "user_id") && !helpers.HasAccess(r, models.AccessManager) {
+		helpers.ClientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = m.DB.RevokeAPIToken(r.Context(), t.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "API token revoked")
+	http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+}
+
+// renderAPITokens renders the API token page with the given new token form
+func (m *Repository) renderAPITokens(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	tokens, err := m.DB.AllAPITokens(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if !helpers.HasAccess(r, models.AccessManager) {
+		userID := m.App.Session.GetInt(r.Context(), "user_id")
+		var own []models.APIToken
+		for _, t := range tokens {
+			if t.UserID == userID {
+				own = append(own, t)
+			}
+		}
+		tokens = own
+	}
+
+	data := make(map[string]interface{})
+	data["tokens"] = tokens
+	data["scopes"] = models.APIScopes
+
+	stringMap := make(map[string]string)
+	stringMap["api_token"] = m.App.Session.PopString(r.Context(), "api_token")
+
+	render.Template(w, r, "admin-api-tokens.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data: data,
+		Form: form,
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
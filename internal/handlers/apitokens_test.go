@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/marif226/bookings/internal/models"
+)
+
+func TestRepository_AdminAPITokens(t *testing.T) {
+	req := adminRequest("GET", "/admin/api-tokens", "", nil)
+	session.Put(req.Context(), "api_token", "bk_shown_once")
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminAPITokens).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("AdminAPITokens returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	body := rr.Body.String()
+	for _, want := range []string{"bk_shown_once", "Channel manager", "Old script"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected page to contain %q", want)
+		}
+	}
+
+	// staff only see their own tokens
+	req = adminRequest("GET", "/admin/api-tokens", "", nil)
+	session.Put(req.Context(), "access_level", models.AccessStaff)
+	rr = httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminAPITokens).ServeHTTP(rr, req)
+
+	if strings.Contains(rr.Body.String(), "Old script") {
+		t.Error("staff should not see tokens of other users")
+	}
+}
+
+func TestRepository_AdminPostAPIToken(t *testing.T) {
+	tests := []struct {
+		name				string
+		postedData			url.Values
+		expectedStatusCode	int
+		expectedToken		bool
+	}{
+		{"valid", url.Values{"name": {"Channel manager"}, "scopes": {models.ScopeReservationsRead}}, http.StatusSeeOther, true},
+		{"no scopes", url.Values{"name": {"Read nothing"}}, http.StatusSeeOther, true},
+		{"missing name", url.Values{"scopes": {models.ScopeReservationsRead}}, http.StatusOK, false},
+		{"unknown scope", url.Values{"name": {"Greedy"}, "scopes": {"everything"}}, http.StatusOK, false},
+		{"database error", url.Values{"name": {"fail"}}, http.StatusInternalServerError, false},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/api-tokens", "", e.postedData)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostAPIToken).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		token := session.GetString(req.Context(), "api_token")
+		if e.expectedToken && !strings.HasPrefix(token, "bk_") {
+			t.Errorf("%s: expected the new token in the session, got %q", e.name, token)
+		} else if !e.expectedToken && token != "" {
+			t.Errorf("%s: did not expect a token, got %q", e.name, token)
+		}
+	}
+}
+
+func TestRepository_AdminRevokeAPIToken(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		accessLevel			int
+		expectedStatusCode	int
+	}{
+		{"own token", "1", models.AccessStaff, http.StatusSeeOther},
+		{"other user as manager", "2", models.AccessManager, http.StatusSeeOther},
+		{"other user as staff", "2", models.AccessStaff, http.StatusForbidden},
+		{"invalid id", "x", models.AccessManager, http.StatusNotFound},
+		{"not found", "1001", models.AccessManager, http.StatusNotFound},
+		{"database error", "1000", models.AccessManager, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/revoke-api-token/"+e.id, e.id, nil)
+		session.Put(req.Context(), "access_level", e.accessLevel)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminRevokeAPIToken).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
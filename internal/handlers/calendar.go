@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/ical"
+	"github.com/marif226/bookings/internal/models"
+)
+
+// roomFeedDaysPast and roomFeedYearsAhead bound the dates exported in the iCal feed of a room, recent
+// stays are kept so that sites syncing the feed do not drop a booking on the day it starts
+const (
+	roomFeedDaysPast	= 30
+	roomFeedYearsAhead	= 3
+)
+
+// calendarSequenceEpoch is where the sequence numbers of updated calendar events start. Counting
+// the seconds since then gives every update a higher sequence without storing one per reservation
+var calendarSequenceEpoch = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// calendarSequence returns the sequence number of a calendar event updated now
+func calendarSequence() int {
+	return int(time.Since(calendarSequenceEpoch) / time.Second)
+}
+
+// calendarHost returns the host name of the site, used to make calendar UIDs unique
+func (m *Repository) calendarHost() string {
+	if u, err := url.Parse(m.App.URL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "localhost"
+}
+
+// reservationUID returns the calendar UID of a reservation, the same for every update of it
+func (m *Repository) reservationUID(res models.Reservation) string {
+	return fmt.Sprintf("reservation-%d@%s", res.ID, m.calendarHost())
+}
+
+// stayAttachment returns the calendar event of the stay of res to attach to emails to the guest,
+// from the day of arrival to the day of departure, the same dates as in the feed of the room. It asks to add or update the
+// event, or to remove it for a cancelled reservation; sequence is 0 for a new reservation and
+// calendarSequence() for an update
+func (m *Repository) stayAttachment(res models.Reservation, cancelled bool, sequence int) models.Attachment {
+	event := ical.Event{
+		UID: m.reservationUID(res),
+		Sequence: sequence,
+		Status: ical.StatusConfirmed,
+		Start: res.StartDate,
+		End: res.EndDate,
+		Summary: fmt.Sprintf("Stay in %s", res.Room.RoomName),
+		Description: fmt.Sprintf("Reservation %d for %d adults and %d children, checking out on %s.",
+			res.ID, res.Adults, res.Children, res.EndDate.Format("02-01-2006")),
+		Location: res.Room.RoomName,
+		Organizer: m.App.Mail.From,
+		Attendee: res.Email,
+	}
+
+	// the sender may have a display name, which goes into the organizer's common name
+	if from, err := mail.ParseAddress(m.App.Mail.From); err == nil {
+		event.Organizer = from.Address
+		event.OrganizerName = from.Name
+	}
+
+	cal := ical.Calendar{Method: ical.MethodRequest}
+
+	if cancelled {
+		cal.Method = ical.MethodCancel
+		event.Status = ical.StatusCancelled
+	} else {
+		event.URL = m.manageBookingLink(res)
+	}
+
+	cal.Events = []ical.Event{event}
+
+	return models.Attachment{
+		Name: "reservation.ics",
+		ContentType: cal.ContentType(),
+		Data: cal.Bytes(),
+	}
+}
+
+// newICalToken returns a new random token for the iCal feed of a room
+func newICalToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// roomFeedURL returns the link of the iCal feed of a room, given to the sites the room is listed on
+func (m *Repository) roomFeedURL(roomID int, token string) string {
+	return fmt.Sprintf("%s/ical/rooms/%d.ics?token=%s", m.App.URL, roomID, url.QueryEscape(token))
+}
+
+// roomFeedEvent returns the event of a reservation or owner block in the iCal feed of a room. It
+// holds nothing about the guest, and the end date is the day of departure, when the room is free
+// for the next arrival
+func (m *Repository) roomFeedEvent(r models.RoomRestriction) ical.Event {
+	event := ical.Event{
+		UID: fmt.Sprintf("block-%d@%s", r.ID, m.calendarHost()),
+		Status: ical.StatusConfirmed,
+		Start: r.StartDate,
+		End: r.EndDate,
+		Summary: "Blocked",
+	}
+
+	if r.ReservationID != 0 {
+		// the same UID as the event emailed to the guest
+		event.UID = m.reservationUID(models.Reservation{ID: r.ReservationID})
+		event.Summary = "Reserved"
+	}
+
+	return event
+}
+
+// RoomICalFeed exports the reservations and owner blocks of a room as an iCal feed, for booking sites
+// to sync. It needs the token of the room's feed link and answers 404 without it, or when the feed is off
+func (m *Repository) RoomICalFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	token, err := m.DB.GetRoomICalToken(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	given := r.URL.Query().Get("token")
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(given)) != 1 {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	today := time.Now().Truncate(24 * time.Hour)
+	restrictions, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), id,
+		today.AddDate(0, 0, -roomFeedDaysPast), today.AddDate(roomFeedYearsAhead, 0, 0))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	cal := ical.Calendar{Name: room.RoomName, Method: ical.MethodPublish}
+	for _, rr := range restrictions {
+		cal.Events = append(cal.Events, m.roomFeedEvent(rr))
+	}
+
+	w.Header().Set("Content-Type", cal.ContentType())
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(cal.Bytes())
+}
+
+// AdminNewRoomICalLink gives a room a new iCal feed link, the previous link stops working
+func (m *Repository) AdminNewRoomICalLink(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := newICalToken()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.SetRoomICalToken(r.Context(), room.ID, token)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "New calendar link created, update it on the booking sites")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", room.ID), http.StatusSeeOther)
+}
+
+// AdminDisableRoomICalLink turns the iCal feed of a room off
+func (m *Repository) AdminDisableRoomICalLink(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.DB.SetRoomICalToken(r.Context(), room.ID, "")
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Calendar link turned off")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d", room.ID), http.StatusSeeOther)
+}
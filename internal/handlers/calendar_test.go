@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/marif226/bookings/internal/models"
+)
+
+func TestRepository_StayAttachment(t *testing.T) {
+	res := models.Reservation{
+		ID: 1,
+		Email: "john@smith.com",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Adults: 2,
+		Room: models.Room{RoomName: "General's Quarters"},
+	}
+
+	tests := []struct {
+		name		string
+		cancelled	bool
+		sequence	int
+		expected	[]string
+	}{
+		{"new", false, 0, []string{"METHOD:REQUEST", "SEQUENCE:0", "STATUS:CONFIRMED", "URL:http://localhost:8080/manage-booking?token="}},
+		{"changed", false, calendarSequence(), []string{"METHOD:REQUEST", "STATUS:CONFIRMED"}},
+		{"cancelled", true, calendarSequence(), []string{"METHOD:CANCEL", "STATUS:CANCELLED"}},
+	}
+
+	for _, e := range tests {
+		a := Repo.stayAttachment(res, e.cancelled, e.sequence)
+
+		if a.Name != "reservation.ics" || !strings.HasPrefix(a.ContentType, "text/calendar") {
+			t.Errorf("%s: unexpected attachment %s of type %s", e.name, a.Name, a.ContentType)
+		}
+
+		cal := string(a.Data)
+		// the event is the same across updates and ends on the day of departure, like in the room feed
+		expected := append(e.expected, "UID:reservation-1@localhost", "DTSTART;VALUE=DATE:20500101", "DTEND;VALUE=DATE:20500103",
+			"ORGANIZER:mailto:bookings@here.com", "ATTENDEE;ROLE=REQ-PARTICIPANT:mailto:john@smith.com")
+		for _, want := range expected {
+			if !strings.Contains(cal, want) {
+				t.Errorf("%s: expected calendar to contain %q, got:\n%s", e.name, want, cal)
+			}
+		}
+
+		if e.cancelled && strings.Contains(cal, "URL:") {
+			t.Errorf("%s: a cancelled stay should not link to the booking", e.name)
+		}
+	}
+
+	if calendarSequence() <= 0 {
+		t.Error("expected updates to have a higher sequence than new reservations")
+	}
+}
+
+func TestRepository_StayAttachment_OrganizerName(t *testing.T) {
+	from := app.Mail.From
+	app.Mail.From = "Fort Smythe Bookings <bookings@here.com>"
+	defer func() { app.Mail.From = from }()
+
+	a := Repo.stayAttachment(models.Reservation{ID: 1, Email: "john@smith.com"}, false, 0)
+
+	want := `ORGANIZER;CN="Fort Smythe Bookings":mailto:bookings@here.com`
+	if !strings.Contains(string(a.Data), want) {
+		t.Errorf("expected calendar to contain %q, got:\n%s", want, a.Data)
+	}
+}
+
+func TestRepository_RoomICalFeed(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		token				string
+		expectedStatusCode	int
+	}{
+		{"feed", "1", "feed-token", http.StatusOK},
+		{"wrong token", "1", "other-token", http.StatusNotFound},
+		{"no token", "1", "", http.StatusNotFound},
+		{"feed off", "2", "", http.StatusNotFound},
+		{"missing room", "3", "feed-token", http.StatusNotFound},
+		{"invalid id", "x", "feed-token", http.StatusNotFound},
+		{"database error", "1000", "feed-token", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/ical/rooms/"+e.id+".ics?token="+e.token, nil)
+		ctx := getCtx(req)
+
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("id", e.id)
+		req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, chiCtx))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.RoomICalFeed).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/calendar") {
+			t.Errorf("for %s expected a calendar, got %s", e.name, rr.Header().Get("Content-Type"))
+		}
+
+		cal := rr.Body.String()
+		// the test repo returns a two night reservation from the start of the feed and a block three days later
+		start := time.Now().Truncate(24 * time.Hour).AddDate(0, 0, -roomFeedDaysPast)
+		expected := []string{
+			"METHOD:PUBLISH",
+			"X-WR-CALNAME:Room 1",
+			"UID:reservation-1@localhost",
+			"SUMMARY:Reserved",
+			"DTSTART;VALUE=DATE:" + start.Format("20060102"),
+			"DTEND;VALUE=DATE:" + start.AddDate(0, 0, 2).Format("20060102"),
+			"UID:block-2@localhost",
+			"SUMMARY:Blocked",
+			"DTSTART;VALUE=DATE:" + start.AddDate(0, 0, 3).Format("20060102"),
+			"DTEND;VALUE=DATE:" + start.AddDate(0, 0, 4).Format("20060102"),
+		}
+		for _, want := range expected {
+			if !strings.Contains(cal, want) {
+				t.Errorf("for %s expected feed to contain %q, got:\n%s", e.name, want, cal)
+			}
+		}
+
+		if strings.Contains(cal, "ATTENDEE") || strings.Contains(cal, "John") {
+			t.Errorf("for %s the feed should not hold guest details:\n%s", e.name, cal)
+		}
+	}
+}
+
+func TestRepository_AdminRoomICalLink(t *testing.T) {
+	tests := []struct {
+		name				string
+		handler				http.HandlerFunc
+		id					string
+		expectedStatusCode	int
+	}{
+		{"new link", Repo.AdminNewRoomICalLink, "1", http.StatusSeeOther},
+		{"new link missing room", Repo.AdminNewRoomICalLink, "3", http.StatusNotFound},
+		{"new link database error", Repo.AdminNewRoomICalLink, "1000", http.StatusInternalServerError},
+		{"turn off", Repo.AdminDisableRoomICalLink, "1", http.StatusSeeOther},
+		{"turn off missing room", Repo.AdminDisableRoomICalLink, "3", http.StatusNotFound},
+		{"turn off database error", Repo.AdminDisableRoomICalLink, "1000", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/rooms/"+e.id+"/ical-link", e.id, nil)
+		rr := httptest.NewRecorder()
+
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if rr.Code == http.StatusSeeOther {
+			location, _ := rr.Result().Location()
+			if location.String() != "/admin/rooms/"+e.id {
+				t.Errorf("for %s expected to go back to the room, got %s", e.name, location.String())
+			}
+		}
+	}
+
+	a, _ := newICalToken()
+	b, _ := newICalToken()
+	if len(a) < 32 || a == b {
+		t.Errorf("expected long random tokens, got %q and %q", a, b)
+	}
+}
@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -12,12 +19,15 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/marif226/bookings/internal/config"
 	"github.com/marif226/bookings/internal/driver"
+	"github.com/marif226/bookings/internal/emails"
 	"github.com/marif226/bookings/internal/forms"
 	"github.com/marif226/bookings/internal/helpers"
 	"github.com/marif226/bookings/internal/models"
 	"github.com/marif226/bookings/internal/render"
 	"github.com/marif226/bookings/internal/repository"
 	"github.com/marif226/bookings/internal/repository/dbrepo"
+	"github.com/marif226/bookings/internal/signer"
+	"github.com/marif226/bookings/internal/stayrules"
 )
 
 // Repo the repositpry used by the handlers
@@ -37,6 +47,22 @@ func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
 	}
 }
 
+// NewSQLiteRepo creates a new repository for a SQLite database
+func NewSQLiteRepo(a *config.AppConfig, db *driver.DB) *Repository {
+	return &Repository{
+		App: a,
+		DB: dbrepo.NewSQLiteRepo(db.SQL, a),
+	}
+}
+
+// NewMemoryRepo creates a new repository that keeps all data in memory
+func NewMemoryRepo(a *config.AppConfig) *Repository {
+	return &Repository{
+		App: a,
+		DB: dbrepo.NewMemoryRepo(a, nil),
+	}
+}
+
 // NewTestRepo creates a new repository for test
 func NewTestRepo(a *config.AppConfig) *Repository {
 	return &Repository{
@@ -62,16 +88,6 @@ func (m *Repository) About(w http.ResponseWriter, r *http.Request) {
 	render.Template(w, r, "about.page.html", &models.TemplateData{})
 }
 
-// Generals renders the generals room page
-func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "generals.page.html", &models.TemplateData{})
-}
-
-// Majors renders the majors room page
-func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "majors.page.html", &models.TemplateData{})
-}
-
 // Availability renders the search availability room page
 func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
 	render.Template(w, r, "search-availability.page.html", &models.TemplateData{})
@@ -86,7 +102,7 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(res.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot find room")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
@@ -95,6 +111,13 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 
 	res.Room.RoomName = room.RoomName
 
+	res.Quote, err = m.quoteStay(r.Context(), res.RoomID, res.StartDate, res.EndDate, res.Guests())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot price reservation")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	sd := res.StartDate.Format("02-01-2006")
@@ -151,13 +174,35 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// add this to fix invalid data error
-	room, err := m.DB.GetRoomByID(roomID)
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't find room!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
+	err = m.checkStayRules(r.Context(), roomID, startDate, endDate)
+	if v, ok := err.(stayrules.Violation); ok {
+		m.App.Session.Put(r.Context(), "error", v.Error())
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot check stay rules!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	adults, children := partySize(form)
+
+	// the price is worked out again rather than taken from the page, and kept with the reservation
+	quote, err := m.quoteStay(r.Context(), roomID, startDate, endDate, adults+children)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "cannot price reservation!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
 	reservation := models.Reservation {
 		FirstName: r.Form.Get("first_name"),
 		LastName: r.Form.Get("last_name"),
@@ -166,89 +211,102 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		StartDate: startDate,
 		EndDate: endDate,
 		RoomID: roomID,
+		Adults: adults,
+		Children: children,
 		Room: room,
+		Quote: quote,
 	}
 
-	form := forms.New(r.PostForm)
-
 	form.Required("first_name", "last_name", "email")
 	form.MinLength("first_name", 3)
 	form.MinLength("last_name", 3)
 	form.IsEmail("email")
+	checkOccupancy(form, room, reservation.Guests())
 
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
+
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = sd
+		stringMap["end_date"] = ed
+
 		http.Error(w, "my own error message", http.StatusSeeOther)
 
 		render.Template(w, r, "make-reservation.page.html", &models.TemplateData{
 			Form: form,
 			Data: data,
+			StringMap: stringMap,
 		})
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
-	if err != nil {
+	reservation.ID, err = m.DB.InsertReservation(r.Context(), reservation, m.reservationNotifications)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this room has just been booked for some of those dates. Please search again.")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
 		m.App.Session.Put(r.Context(), "error", "cannot insert reservation into database!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	restriction := models.RoomRestriction{
-		StartDate: startDate,
-		EndDate: endDate,
-		RoomID: roomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
-	}
+	m.App.Session.Put(r.Context(), "reservation", reservation)
 
-	err = m.DB.InsertRoomRestriction(restriction)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "cannot insert room restriction!")
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-		return
-	}
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
 
-	// send notification - to the guest
-	htmlMessage := fmt.Sprintf(`
-		<strong>Reservation Confirmation</strong><br>
-		Dear %s: <br>
-		This is confirm your reservation from %s to %s.
-	`, reservation.FirstName, reservation.StartDate.Format("02-01-2006"), reservation.EndDate.Format("02-01-2006"))
+// partySize reads the adults and children fields of form, adding errors unless there is at least
+// one adult; children may be left blank
+func partySize(form *forms.Form) (int, int) {
+	var adults, children int
 
-	msg := models.MailData {
-		To: reservation.Email,
-		From: "me@here.com",
-		Subject: "Reservation Confirmation",
-		Content: htmlMessage,
-		Template: "basic.html",
+	if form.MinInt("adults", 1) {
+		adults, _ = strconv.Atoi(strings.TrimSpace(form.Get("adults")))
 	}
 
-	m.App.MailChan <- msg
+	if strings.TrimSpace(form.Get("children")) != "" && form.MinInt("children", 0) {
+		children, _ = strconv.Atoi(strings.TrimSpace(form.Get("children")))
+	}
 
-	// send notification - to the owner
-	htmlMessage = fmt.Sprintf(`
-		<strong>Reservation Notification</strong><br>
-		A reservation has been made for %s from %s to %s.
-	`, reservation.FirstName, reservation.StartDate.Format("02-01-2006"), reservation.EndDate.Format("02-01-2006"))
+	return adults, children
+}
 
-	msg = models.MailData {
-		To: "me@here.com",
-		From: "me@here.com",
-		Subject: "Reservation Notification",
-		Content: htmlMessage,
+// checkOccupancy adds an error to form if a party of guests does not fit in room
+func checkOccupancy(form *forms.Form, room models.Room, guests int) {
+	if guests > room.MaxOccupancy {
+		form.Errors.Add("adults", fmt.Sprintf("%s sleeps at most %d guests!", room.RoomName, room.MaxOccupancy))
 	}
+}
 
-	m.App.MailChan <- msg
+// reservationNotifications returns the confirmation to the guest and the notification to the owner
+// for a new reservation, queued together with it
+func (m *Repository) reservationNotifications(reservation models.Reservation) []models.MailData {
+	stay := emails.NewStay(reservation)
 
-	m.App.Session.Put(r.Context(), "reservation", reservation)
+	guest := emails.Message(reservation.Email, m.App.Mail.From, "Reservation Confirmation", emails.Confirmation{
+		Stay: stay,
+		ManageLink: m.manageBookingLink(reservation),
+	})
+	guest.Attachments = []models.Attachment{m.stayAttachment(reservation, false, 0)}
 
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+	owner := emails.Message(m.App.Mail.Owner, m.App.Mail.From, "Reservation Notification", emails.OwnerNotification{
+		Event: emails.EventBooked,
+		Stay: stay,
+	})
+
+	return []models.MailData{guest, owner}
 }
 
 // PostAvailability renders the search availability room page
 func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	start := r.Form.Get("start")
 	end := r.Form.Get("end")
 
@@ -266,25 +324,75 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	if err := stayrules.CheckDates(startDate, endDate, today()); err != nil {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	adults, children := partySize(form)
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Please enter at least one adult and no negative number of children!")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	// only rooms that sleep the whole party are offered
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(r.Context(), startDate, endDate, adults+children)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	if len(rooms) == 0 {
+	// rooms whose stay rules do not allow the stay are left out, if that leaves none the guest is told why
+	var bookable []models.Room
+	var violation error
+	for _, room := range rooms {
+		err = m.checkStayRules(r.Context(), room.ID, startDate, endDate)
+		if v, ok := err.(stayrules.Violation); ok {
+			if violation == nil {
+				violation = v
+			}
+			continue
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		bookable = append(bookable, room)
+	}
+	rooms = bookable
+
+	if len(rooms) == 0 && violation != nil {
+		m.App.Session.Put(r.Context(), "error", violation.Error())
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if len(rooms) == 0 {
 		// no availability
 		m.App.Session.Put(r.Context(), "error", "No availability!")
 		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
-	} 
+	}
+
+	// the price of the stay in every room, by room id
+	quotes := make(map[int]models.Quote)
+	for _, room := range rooms {
+		quotes[room.ID], err = m.quoteStay(r.Context(), room.ID, startDate, endDate, adults+children)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
 
 	data := make(map[string]interface{})
 	data["rooms"] = rooms
+	data["quotes"] = quotes
 
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate: endDate,
+		Adults: adults,
+		Children: children,
 	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
@@ -324,12 +432,39 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 	layout := "02-01-2006"
 
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	startDate, err1 := time.Parse(layout, sd)
+	endDate, err2 := time.Parse(layout, ed)
+	if err1 != nil || err2 != nil {
+		resp := jsonResponse{
+			OK: false,
+			Message: "Cannot parse the dates!",
+		}
+
+		out, _ := json.MarshalIndent(resp, "", "    ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
 
 	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
 
-	available, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+	err = m.checkStayRules(r.Context(), roomID, startDate, endDate)
+	if err != nil {
+		resp := jsonResponse{
+			OK: false,
+			Message: "Error connecting to database",
+		}
+		if v, ok := err.(stayrules.Violation); ok {
+			resp.Message = v.Error()
+		}
+
+		out, _ := json.MarshalIndent(resp, "", "    ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(r.Context(), startDate, endDate, roomID)
 	if err != nil {
 		// cannot parse form, return appropriate json
 		resp := jsonResponse{
@@ -418,22 +553,39 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	sd := r.URL.Query().Get("s")
 	ed := r.URL.Query().Get("e")
 
-	layout := "02-01-2006"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
-
 	var res models.Reservation
 
-	room, err := m.DB.GetRoomByID(roomID)
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	layout := "02-01-2006"
+	startDate, err1 := time.Parse(layout, sd)
+	endDate, err2 := time.Parse(layout, ed)
+	if err1 != nil || err2 != nil {
+		m.App.Session.Put(r.Context(), "error", "Cannot parse the dates!")
+		http.Redirect(w, r, "/rooms/"+room.Slug, http.StatusSeeOther)
+		return
+	}
+
+	err = m.checkStayRules(r.Context(), roomID, startDate, endDate)
+	if v, ok := err.(stayrules.Violation); ok {
+		m.App.Session.Put(r.Context(), "error", v.Error())
+		http.Redirect(w, r, "/rooms/"+room.Slug, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	res.Room.RoomName = room.RoomName
 	res.RoomID = roomID
 	res.StartDate = startDate
 	res.EndDate = endDate
+	// the party size is asked for on the reservation form
+	res.Adults = 1
 
 	m.App.Session.Put(r.Context(),"reservation", res)
 
@@ -469,7 +621,7 @@ func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id, _, err := m.DB.Authenticate(email, password)
+	id, _, err := m.DB.Authenticate(r.Context(), email, password)
 	if err != nil {
 		log.Println(err)
 
@@ -478,7 +630,14 @@ func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "user_id", id)
+	m.App.Session.Put(r.Context(), "access_level", user.AccessLevel)
 	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -491,13 +650,168 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
+// passwordResetPurpose separates password reset tokens from other signed tokens
+const passwordResetPurpose = "password-reset"
+
+// passwordResetTTL is how long a password reset link stays valid
+const passwordResetTTL = time.Hour
+
+// passwordFingerprint identifies the current password of a user, so that a reset
+// token stops working as soon as the password changes
+func passwordFingerprint(u models.User) string {
+	sum := sha256.Sum256([]byte(u.Password))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ShowForgotPassword shows the forgotten password screen
+func (m *Repository) ShowForgotPassword(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "forgot-password.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostForgotPassword emails a password reset link if the address belongs to an active user
+func (m *Repository) PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.IsEmail("email")
+	if !form.Valid() {
+		render.Template(w, r, "forgot-password.page.html", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	user, err := m.DB.GetUserByEmail(r.Context(), form.Get("email"))
+	if err == nil && user.Active {
+		data := fmt.Sprintf("%d:%s", user.ID, passwordFingerprint(user))
+		token := m.App.Signer.Sign(passwordResetPurpose, data, passwordResetTTL)
+		link := fmt.Sprintf("%s/user/reset-password?token=%s", m.App.URL, url.QueryEscape(token))
+
+		msg := emails.Message(user.Email, m.App.Mail.From, "Password Reset", emails.PasswordReset{
+			FirstName: user.FirstName,
+			Link: link,
+		})
+
+		m.queueMail(r.Context(), msg)
+	} else if err != nil && err != sql.ErrNoRows {
+		m.App.ErrorLog.Println(err)
+	}
+
+	// the same answer for known and unknown addresses, so accounts cannot be discovered
+	m.App.Session.Put(r.Context(), "flash", "If the address belongs to an account, a reset link is on its way")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// userForResetToken returns the user a password reset token was issued for,
+// as long as the token is valid and the password has not changed since
+func (m *Repository) userForResetToken(ctx context.Context, token string) (models.User, error) {
+	data, err := m.App.Signer.Verify(passwordResetPurpose, token)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	parts := strings.Split(data, ":")
+	if len(parts) != 2 {
+		return models.User{}, signer.ErrInvalidToken
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return models.User{}, signer.ErrInvalidToken
+	}
+
+	user, err := m.DB.GetUserByID(ctx, id)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if !user.Active || passwordFingerprint(user) != parts[1] {
+		return models.User{}, signer.ErrInvalidToken
+	}
+
+	return user, nil
+}
+
+// ShowResetPassword shows the screen to choose a new password
+func (m *Repository) ShowResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	_, err := m.userForResetToken(r.Context(), token)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "This reset link is invalid or has expired")
+		http.Redirect(w, r, "/user/forgot-password", http.StatusSeeOther)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = token
+
+	render.Template(w, r, "reset-password.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		StringMap: stringMap,
+	})
+}
+
+// PostResetPassword sets a new password for the user a reset token was issued for
+func (m *Repository) PostResetPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token := r.Form.Get("token")
+
+	user, err := m.userForResetToken(r.Context(), token)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "This reset link is invalid or has expired")
+		http.Redirect(w, r, "/user/forgot-password", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("password", "password_confirm")
+	form.MinLength("password", minPasswordLength)
+	if form.Get("password") != form.Get("password_confirm") {
+		form.Errors.Add("password_confirm", "Passwords do not match!")
+	}
+
+	if !form.Valid() {
+		stringMap := make(map[string]string)
+		stringMap["token"] = token
+
+		render.Template(w, r, "reset-password.page.html", &models.TemplateData{
+			Form: form,
+			StringMap: stringMap,
+		})
+		return
+	}
+
+	// the new hash changes the password fingerprint, which invalidates the token
+	err = m.DB.UpdatePassword(r.Context(), user.ID, form.Get("password"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Your password has been changed, please log in")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
 func (m *Repository) AdminDashBoard(w http.ResponseWriter, r *http.Request) {
 	render.Template(w, r, "admin-dashboard.page.html", &models.TemplateData{})
 }
 
 // AdminNewReservations shows all new reservations in admin tool
 func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllNewReservations()
+	reservations, err := m.DB.AllNewReservations(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -511,9 +825,15 @@ func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// AdminNewReservations shows all reservations in admin tool
+// AdminAllReservations shows all reservations in admin tool, or only those in the status given by ?status=
 func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
+	status := models.ReservationStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.Valid() {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	reservations, err := m.DB.AllReservations(r.Context(), status)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -521,28 +841,34 @@ func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request
 
 	data := make(map[string]interface{})
 	data["reservations"] = reservations
+	data["statuses"] = models.ReservationStatuses
+
+	stringMap := make(map[string]string)
+	stringMap["status"] = string(status)
 
 	render.Template(w, r, "admin-all-reservations.page.html", &models.TemplateData{
+		StringMap: stringMap,
 		Data: data,
 	})
 }
 
 // AdminShowReservation shows the reservation in the admin tool
 func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
-	exploded := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(exploded[4])
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	src := exploded[3]
+	src := chi.URLParam(r, "src")
 
 	stringMap := make(map[string]string)
 	stringMap["src"] = src
+	stringMap["year"] = r.URL.Query().Get("y")
+	stringMap["month"] = r.URL.Query().Get("m")
 
 	// get reservation from database
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.DB.GetReservationByID(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -565,19 +891,15 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	exploded := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(exploded[4])
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	src := exploded[3]
-
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
+	src := chi.URLParam(r, "src")
 
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.DB.GetReservationByID(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -588,17 +910,290 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 	res.Email = r.Form.Get("email")
 	res.Phone = r.Form.Get("phone")
 
-	err = m.DB.UpdateReservation(res)
+	err = m.DB.UpdateReservation(r.Context(), res)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
 	m.App.Session.Put(r.Context(), "flash", "Changes saved")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	http.Redirect(w, r, adminReservationsURL(r, src), http.StatusSeeOther)
+}
+
+// AdminReservationStatus moves a reservation to the status in the URL, if its current status allows it
+func (m *Repository) AdminReservationStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	src := chi.URLParam(r, "src")
+
+	status := models.ReservationStatus(chi.URLParam(r, "status"))
+	if !status.Valid() {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.UpdateReservationStatus(r.Context(), id, status)
+	if errors.Is(err, repository.ErrInvalidTransition) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("This reservation cannot be marked as %s!", status))
+		http.Redirect(w, r, adminReservationsURL(r, src), http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if status == models.StatusCancelled {
+		m.sendCancellation(r.Context(), id)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Reservation marked as %s", status))
+	http.Redirect(w, r, adminReservationsURL(r, src), http.StatusSeeOther)
+}
+
+// sendCancellation emails the guest of a reservation cancelled by staff, so that the stay is also
+// removed from their calendar. Failures are only logged, as the reservation is already cancelled
+func (m *Repository) sendCancellation(ctx context.Context, id int) {
+	res, err := m.DB.GetReservationByID(ctx, id)
+	if err != nil {
+		m.App.ErrorLog.Printf("cannot email the cancellation of reservation %d: %s", id, err)
+		return
+	}
+
+	msg := emails.Message(res.Email, m.App.Mail.From, "Reservation Cancelled", emails.Cancellation{Stay: emails.NewStay(res)})
+	msg.Attachments = []models.Attachment{m.stayAttachment(res, true, calendarSequence())}
+
+	m.queueMail(ctx, msg)
+}
+
+// AdminDeleteReservation deletes a reservation and frees its room
+func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	src := chi.URLParam(r, "src")
+
+	err = m.DB.DeleteReservation(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+	http.Redirect(w, r, adminReservationsURL(r, src), http.StatusSeeOther)
+}
+
+// adminReservationsURL returns the admin page a reservation was opened from
+func adminReservationsURL(r *http.Request, src string) string {
+	if src == "cal" {
+		return fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", r.FormValue("y"), r.FormValue("m"))
+	}
+
+	return fmt.Sprintf("/admin/reservations-%s", src)
 }
 
 // AdminReservationCalendar displays the reservation calendar
 func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin-reservations-calendar.page.html", &models.TemplateData{})
+	// assume that there is no month/year specified
+	now := time.Now()
+
+	if r.URL.Query().Get("y") != "" {
+		year, err := strconv.Atoi(r.URL.Query().Get("y"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		month, err := strconv.Atoi(r.URL.Query().Get("m"))
+		if err != nil || month < 1 || month > 12 {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+
+		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	data := make(map[string]interface{})
+	data["now"] = now
+
+	next := now.AddDate(0, 1, 0)
+	last := now.AddDate(0, -1, 0)
+
+	stringMap := make(map[string]string)
+	stringMap["next_month"] = next.Format("01")
+	stringMap["next_month_year"] = next.Format("2006")
+	stringMap["last_month"] = last.Format("01")
+	stringMap["last_month_year"] = last.Format("2006")
+	stringMap["this_month"] = now.Format("01")
+	stringMap["this_month_year"] = now.Format("2006")
+
+	// get the first and last days of the month
+	currentYear, currentMonth, _ := now.Date()
+	currentLocation := now.Location()
+	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	intMap := make(map[string]int)
+	intMap["days_in_month"] = lastOfMonth.Day()
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data["rooms"] = rooms
+
+	for _, x := range rooms {
+		// create maps keyed by day holding reservation ids and owner block ids
+		reservationMap := make(map[string]int)
+		blockMap := make(map[string]int)
+
+		for d := firstOfMonth; !d.After(lastOfMonth); d = d.AddDate(0, 0, 1) {
+			reservationMap[d.Format("2006-01-2")] = 0
+			blockMap[d.Format("2006-01-2")] = 0
+		}
+
+		// get all the restrictions for the current room
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), x.ID, firstOfMonth, lastOfMonth)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		for _, y := range restrictions {
+			// the end date is the departure day, so it is not occupied
+			for d := y.StartDate; d.Before(y.EndDate); d = d.AddDate(0, 0, 1) {
+				key := d.Format("2006-01-2")
+				if _, ok := reservationMap[key]; !ok {
+					continue
+				}
+
+				if y.ReservationID > 0 {
+					reservationMap[key] = y.ReservationID
+				} else {
+					blockMap[key] = y.ID
+				}
+			}
+		}
+
+		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
+		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+
+		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
+	}
+
+	render.Template(w, r, "admin-reservations-calendar.page.html", &models.TemplateData{
+		StringMap: stringMap,
+		Data: data,
+		IntMap: intMap,
+	})
+}
+
+// AdminPostReservationsCalendar handles post of reservation calendar
+func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	year, _ := strconv.Atoi(r.Form.Get("y"))
+	month, _ := strconv.Atoi(r.Form.Get("m"))
+
+	// process blocks
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	// collect the new blocks first, so a block of an unknown room changes nothing
+	known := make(map[int]bool)
+	for _, x := range rooms {
+		known[x.ID] = true
+	}
+
+	type block struct {
+		roomID	int
+		date	time.Time
+	}
+	var blocks []block
+
+	for name := range r.PostForm {
+		if strings.HasPrefix(name, "add_block") {
+			exploded := strings.Split(name, "_")
+			if len(exploded) != 4 {
+				continue
+			}
+
+			roomID, err := strconv.Atoi(exploded[2])
+			if err != nil {
+				continue
+			}
+
+			t, err := time.Parse("2006-01-2", exploded[3])
+			if err != nil {
+				continue
+			}
+
+			if !known[roomID] {
+				m.App.Session.Put(r.Context(), "error", "Cannot block days of an unknown room!")
+				http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
+				return
+			}
+
+			blocks = append(blocks, block{roomID, t})
+		}
+	}
+
+	for _, x := range rooms {
+		// get the block map from the session. Loop through entire map, if we have an entry in the map
+		// that does not exist in our posted data, and if the restriction id > 0, then it is a block we need to remove
+		curMap, ok := m.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", x.ID)).(map[string]int)
+		if !ok {
+			m.App.Session.Put(r.Context(), "error", "Calendar has expired, please try again")
+			http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
+			return
+		}
+
+		for name, value := range curMap {
+			if value > 0 && !form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
+				err := m.DB.DeleteBlockByID(r.Context(), value)
+				if err != nil {
+					helpers.ServerError(w, err)
+					return
+				}
+			}
+		}
+	}
+
+	// now handle new blocks, skipping days that are already booked
+	var booked []string
+	for _, b := range blocks {
+		err := m.DB.InsertBlockForRoom(r.Context(), b.roomID, b.date)
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			booked = append(booked, b.date.Format("2006-01-02"))
+			continue
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if len(booked) > 0 {
+		sort.Strings(booked)
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Booked days cannot be blocked: %s!", strings.Join(booked, ", ")))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
 }
\ No newline at end of file
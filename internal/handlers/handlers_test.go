@@ -3,13 +3,16 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/marif226/bookings/internal/models"
 )
 
@@ -26,8 +29,10 @@ var theTests = []struct {
 } {
 	{"home", "/", "GET", http.StatusOK},
 	{"about", "/about", "GET", http.StatusOK},
-	{"gq", "/generals-quarters", "GET", http.StatusOK},
-	{"ms", "/majors-suite", "GET", http.StatusOK},
+	{"rooms", "/rooms", "GET", http.StatusOK},
+	{"gq", "/rooms/generals-quarters", "GET", http.StatusOK},
+	{"missing room", "/rooms/no-such-room", "GET", http.StatusNotFound},
+	{"room error", "/rooms/fail", "GET", http.StatusInternalServerError},
 	{"contact", "/contact", "GET", http.StatusOK},
 	{"sa", "/search-availability", "GET", http.StatusOK},
 	// {"post-search-availablity-json", "/search-availability", "POST", []postData{
@@ -67,6 +72,8 @@ func TestRepository_Reservation(t *testing.T) {
 			ID: 1,
 			RoomName: "General's Quarters",
 		},
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
 	}
 
 	req, _ := http.NewRequest("GET", "/make-reservation", nil)
@@ -84,6 +91,11 @@ func TestRepository_Reservation(t *testing.T) {
 		t.Errorf("Reservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
 	}
 
+	// a Saturday and a Sunday night of the test rate plan
+	if !strings.Contains(rr.Body.String(), "USD 220.00") {
+		t.Error("Reservation handler should show the price of the stay")
+	}
+
 	// test case where reservation is not in session (reset everything)
 	req, _ = http.NewRequest("GET", "/make-reservation", nil)
 	ctx = getCtx(req)
@@ -107,6 +119,19 @@ func TestRepository_Reservation(t *testing.T) {
 	if rr.Code != http.StatusTemporaryRedirect {
 		t.Errorf("Reservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
 	}
+
+	// test with a rate plan that cannot be loaded
+	req, _ = http.NewRequest("GET", "/make-reservation", nil)
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+	reservation.RoomID = 1001
+	session.Put(ctx, "reservation", reservation)
+
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Errorf("Reservation handler returned wrong response code for a pricing error: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	}
 }
 
 func TestRepository_PostReservation(t *testing.T) {
@@ -118,6 +143,7 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData.Add("email", "john@smith.com")
 	postedData.Add("phone", "555-555-5555")
 	postedData.Add("room_id", "1")
+	postedData.Add("adults", "2")
 
 	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
 	ctx := getCtx(req)
@@ -135,6 +161,12 @@ func TestRepository_PostReservation(t *testing.T) {
 		t.Errorf("PostReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
 	}
 
+	// the booking keeps the price of its Saturday night
+	booked, _ := session.Get(ctx, "reservation").(models.Reservation)
+	if booked.Quote.Total != 12000 || len(booked.Quote.Lines) != 1 {
+		t.Errorf("PostReservation handler should store the quote with the reservation, got %+v", booked.Quote)
+	}
+
 	// test for missing post body
 	req, _ = http.NewRequest("POST", "/make-reservation", nil)
 	ctx = getCtx(req)
@@ -158,6 +190,7 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData.Add("email", "john@smith.com")
 	postedData.Add("phone", "555-555-5555")
 	postedData.Add("room_id", "1")
+	postedData.Add("adults", "2")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
 	ctx = getCtx(req)
@@ -181,6 +214,7 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData.Add("email", "john@smith.com")
 	postedData.Add("phone", "555-555-5555")
 	postedData.Add("room_id", "1")
+	postedData.Add("adults", "2")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
 	ctx = getCtx(req)
@@ -204,6 +238,7 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData.Add("email", "john@smith.com")
 	postedData.Add("phone", "555-555-5555")
 	postedData.Add("room_id", "invalid")
+	postedData.Add("adults", "2")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
 	ctx = getCtx(req)
@@ -227,6 +262,7 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData.Add("email", "john@smith.com")
 	postedData.Add("phone", "555-555-5555")
 	postedData.Add("room_id", "1")
+	postedData.Add("adults", "2")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
 	ctx = getCtx(req)
@@ -241,7 +277,31 @@ func TestRepository_PostReservation(t *testing.T) {
 		t.Errorf("PostReservation handler returned wrong response code for invalid data: got %d, wanted %d", rr.Code, http.StatusSeeOther)
 	}
 
-	// test for failure to insert reservation
+	// test for a party that does not fit in the room
+	postedData = url.Values{}
+	postedData.Add("start_date", "01-01-2050")
+	postedData.Add("end_date", "02-01-2050")
+	postedData.Add("first_name", "John")
+	postedData.Add("last_name", "Smith")
+	postedData.Add("email", "john@smith.com")
+	postedData.Add("phone", "555-555-5555")
+	postedData.Add("room_id", "1")
+	postedData.Add("adults", "2")
+	postedData.Add("children", "3")
+
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+
+	handler = http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), "sleeps at most 2 guests") {
+		t.Error("PostReservation handler should refuse a party larger than the room")
+	}
+
+	// test for room taken in the meantime
 	postedData = url.Values{}
 	postedData.Add("start_date", "01-01-2050")
 	postedData.Add("end_date", "02-01-2050")
@@ -250,6 +310,7 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData.Add("email", "john@smith.com")
 	postedData.Add("phone", "555-555-5555")
 	postedData.Add("room_id", "2")
+	postedData.Add("adults", "2")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
 	ctx = getCtx(req)
@@ -260,11 +321,14 @@ func TestRepository_PostReservation(t *testing.T) {
 	
 	handler = http.HandlerFunc(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("PostReservation handler failed when trying to fail insering reservation: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostReservation handler returned wrong response code for unavailable room: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("PostReservation handler should send the guest back to search for an unavailable room, got %s", rr.Header().Get("Location"))
 	}
 
-	// test for failure to insert restriction
+	// test for failure to insert reservation
 	postedData = url.Values{}
 	postedData.Add("start_date", "01-01-2050")
 	postedData.Add("end_date", "02-01-2050")
@@ -273,6 +337,7 @@ func TestRepository_PostReservation(t *testing.T) {
 	postedData.Add("email", "john@smith.com")
 	postedData.Add("phone", "555-555-5555")
 	postedData.Add("room_id", "1000")
+	postedData.Add("adults", "2")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
 	ctx = getCtx(req)
@@ -284,7 +349,116 @@ func TestRepository_PostReservation(t *testing.T) {
 	handler = http.HandlerFunc(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
 	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("PostReservation handler failed when trying to fail insering restriction: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+		t.Errorf("PostReservation handler failed when trying to fail insering reservation: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	}
+
+	// test for a stay breaking the stay rules of the room
+	postedData.Set("room_id", "1")
+	postedData.Set("start_date", "24-12-2050")
+	postedData.Set("end_date", "25-12-2050")
+
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+
+	handler = http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("PostReservation handler should send the guest back to search for a stay breaking the stay rules, got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if msg := session.GetString(ctx, "error"); !strings.Contains(msg, "at least 3 nights") {
+		t.Errorf("PostReservation handler should tell the guest which stay rule was broken, got %q", msg)
+	}
+
+	// test for failure to load the stay rules
+	postedData.Set("room_id", "1002")
+	postedData.Set("start_date", "01-01-2050")
+	postedData.Set("end_date", "02-01-2050")
+
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+
+	handler = http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Errorf("PostReservation handler returned wrong response code for a stay rules error: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	}
+
+	// test for failure to price the reservation
+	postedData.Set("room_id", "1001")
+
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// Request recorder
+	rr = httptest.NewRecorder()
+
+	handler = http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTemporaryRedirect {
+		t.Errorf("PostReservation handler returned wrong response code for a pricing error: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	}
+}
+
+func TestRepository_PostAvailability(t *testing.T) {
+	tests := []struct {
+		name				string
+		start				string
+		end					string
+		adults				string
+		children			string
+		expectedStatusCode	int
+		expectedError		string
+	}{
+		{"available", "01-01-2050", "03-01-2050", "2", "", http.StatusOK, ""},
+		{"party too large", "01-01-2050", "03-01-2050", "3", "2", http.StatusSeeOther, "No availability!"},
+		{"no adults", "01-01-2050", "03-01-2050", "0", "1", http.StatusSeeOther, "at least one adult"},
+		{"negative children", "01-01-2050", "03-01-2050", "1", "-1", http.StatusSeeOther, "at least one adult"},
+		{"fully booked", "01-01-2051", "03-01-2051", "1", "0", http.StatusSeeOther, "No availability!"},
+		{"end before start", "03-01-2050", "01-01-2050", "1", "0", http.StatusSeeOther, "must be after the arrival"},
+		{"too short over christmas", "24-12-2050", "25-12-2050", "1", "0", http.StatusSeeOther, "at least 3 nights"},
+		{"in the past", "01-01-2000", "03-01-2000", "1", "0", http.StatusSeeOther, "cannot be in the past"},
+		{"too long", "01-01-2050", "01-01-3050", "1", "0", http.StatusSeeOther, "at most 365 nights"},
+		{"database error", "01-01-2050", "03-01-2050", "1000", "0", http.StatusInternalServerError, ""},
+		{"invalid start date", "invalid", "03-01-2050", "1", "0", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("start", e.start)
+		postedData.Add("end", e.end)
+		postedData.Add("adults", e.adults)
+		postedData.Add("children", e.children)
+
+		req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.PostAvailability).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+			continue
+		}
+
+		if msg := session.GetString(ctx, "error"); !strings.Contains(msg, e.expectedError) {
+			t.Errorf("%s: expected the error %q, got %q", e.name, e.expectedError, msg)
+		}
+
+		if rr.Code == http.StatusOK {
+			res, _ := session.Get(ctx, "reservation").(models.Reservation)
+			if res.Adults != 2 || res.Children != 0 {
+				t.Errorf("%s: expected the party to be kept with the search, got %d adults and %d children", e.name, res.Adults, res.Children)
+			}
+		}
 	}
 }
 
@@ -319,6 +493,73 @@ func TestRepository_AvailablityJson(t *testing.T) {
 	if err != nil {
 		t.Error("failed to parse json")
 	}
+
+	// a stay breaking the stay rules of the room is refused with the reason
+	postedData = url.Values{}
+	postedData.Add("start", "24-12-2050")
+	postedData.Add("end", "25-12-2050")
+	postedData.Add("room_id", "1")
+
+	req, _ = http.NewRequest("POST", "/search-availability-json", strings.NewReader(postedData.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	j = jsonResponse{}
+	err = json.Unmarshal([]byte(rr.Body.String()), &j)
+	if err != nil || j.OK || !strings.Contains(j.Message, "at least 3 nights") {
+		t.Errorf("AvailabilityJSON should refuse a stay breaking the stay rules, got %s", rr.Body.String())
+	}
+
+	// dates that cannot be parsed are refused
+	postedData.Set("start", "2050-12-24")
+
+	req, _ = http.NewRequest("POST", "/search-availability-json", strings.NewReader(postedData.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	j = jsonResponse{}
+	err = json.Unmarshal([]byte(rr.Body.String()), &j)
+	if err != nil || j.OK || j.Message != "Cannot parse the dates!" {
+		t.Errorf("AvailabilityJSON should refuse dates it cannot parse, got %s", rr.Body.String())
+	}
+}
+
+func TestRepository_BookRoom(t *testing.T) {
+	tests := []struct {
+		name				string
+		query				string
+		expectedStatusCode	int
+		expectedLocation	string
+	}{
+		{"allowed", "id=1&s=01-01-2050&e=03-01-2050", http.StatusTemporaryRedirect, "/make-reservation"},
+		{"too short over christmas", "id=1&s=24-12-2050&e=25-12-2050", http.StatusSeeOther, "/rooms/room-1"},
+		{"no dates", "id=1", http.StatusSeeOther, "/rooms/room-1"},
+		{"bad date", "id=1&s=2050-01-01&e=03-01-2050", http.StatusSeeOther, "/rooms/room-1"},
+		{"missing room", "id=3&s=01-01-2050&e=03-01-2050", http.StatusInternalServerError, ""},
+		{"stay rules error", "id=1002&s=01-01-2050&e=03-01-2050", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/book-room?"+e.query, nil)
+		req = req.WithContext(getCtx(req))
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.BookRoom).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("%s: expected to be sent to %q, got %q", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+	}
 }
 
 func getCtx(req *http.Request) context.Context {
@@ -328,4 +569,337 @@ func getCtx(req *http.Request) context.Context {
 	}
 
 	return ctx
-}
\ No newline at end of file
+}
+
+var adminReservationActionTests = []struct {
+	name				string
+	handler				func(m *Repository, w http.ResponseWriter, r *http.Request)
+	src					string
+	id					string
+	status				string
+	expectedStatusCode	int
+	expectedLocation	string
+} {
+	{"confirm new", (*Repository).AdminReservationStatus, "new", "1", "confirmed", http.StatusSeeOther, "/admin/reservations-new"},
+	{"cancel all", (*Repository).AdminReservationStatus, "all", "1", "cancelled", http.StatusSeeOther, "/admin/reservations-all"},
+	{"not allowed", (*Repository).AdminReservationStatus, "all", "1", "checked-out", http.StatusSeeOther, "/admin/reservations-all"},
+	{"already cancelled", (*Repository).AdminReservationStatus, "all", "998", "confirmed", http.StatusSeeOther, "/admin/reservations-all"},
+	{"unknown status", (*Repository).AdminReservationStatus, "new", "1", "processed", http.StatusBadRequest, ""},
+	{"status invalid id", (*Repository).AdminReservationStatus, "new", "x", "confirmed", http.StatusInternalServerError, ""},
+	{"status db error", (*Repository).AdminReservationStatus, "new", "1000", "confirmed", http.StatusInternalServerError, ""},
+	{"delete new", (*Repository).AdminDeleteReservation, "new", "1", "", http.StatusSeeOther, "/admin/reservations-new"},
+	{"delete all", (*Repository).AdminDeleteReservation, "all", "1", "", http.StatusSeeOther, "/admin/reservations-all"},
+	{"delete invalid id", (*Repository).AdminDeleteReservation, "all", "x", "", http.StatusInternalServerError, ""},
+	{"delete db error", (*Repository).AdminDeleteReservation, "all", "1000", "", http.StatusInternalServerError, ""},
+}
+
+func TestRepository_AdminReservationActions(t *testing.T) {
+	for _, e := range adminReservationActionTests {
+		req, _ := http.NewRequest("POST", "/admin/reservation-action", nil)
+		ctx := getCtx(req)
+
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("src", e.src)
+		chiCtx.URLParams.Add("id", e.id)
+		chiCtx.URLParams.Add("status", e.status)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			location, _ := rr.Result().Location()
+			if location.String() != e.expectedLocation {
+				t.Errorf("for %s expected location %s but got %s", e.name, e.expectedLocation, location.String())
+			}
+		}
+
+		if e.name == "not allowed" && session.GetString(ctx, "error") != "This reservation cannot be marked as checked-out!" {
+			t.Errorf("for %s expected an error flash, got %q", e.name, session.GetString(ctx, "error"))
+		}
+	}
+}
+
+func TestRepository_AdminShowReservation(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/reservations/new/1", nil)
+	ctx := getCtx(req)
+
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("src", "new")
+	chiCtx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, chiCtx))
+
+	rr := httptest.NewRecorder()
+	Repo.AdminShowReservation(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	// a pending reservation can be confirmed or cancelled, nothing else
+	body := rr.Body.String()
+	if !strings.Contains(body, "Mark as confirmed") || !strings.Contains(body, "Mark as cancelled") || strings.Contains(body, "Mark as checked-in") {
+		t.Error("expected buttons to confirm or cancel the reservation")
+	}
+}
+
+func TestRepository_AdminAllReservations(t *testing.T) {
+	tests := []struct {
+		name				string
+		url					string
+		expectedStatusCode	int
+	}{
+		{"all", "/admin/reservations-all", http.StatusOK},
+		{"by status", "/admin/reservations-all?status=checked-in", http.StatusOK},
+		{"unknown status", "/admin/reservations-all?status=processed", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		req = req.WithContext(getCtx(req))
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminAllReservations)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminReservationsCalendar(t *testing.T) {
+	tests := []struct {
+		name				string
+		url					string
+		expectedStatusCode	int
+	}{
+		{"current month", "/admin/reservations-calendar", http.StatusOK},
+		{"given month", "/admin/reservations-calendar?y=2050&m=01", http.StatusOK},
+		{"invalid year", "/admin/reservations-calendar?y=x&m=01", http.StatusBadRequest},
+		{"invalid month", "/admin/reservations-calendar?y=2050&m=13", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminReservationsCalendar)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if rr.Code != http.StatusOK {
+			continue
+		}
+
+		blockMap, ok := session.Get(ctx, "block_map_1").(map[string]int)
+		if !ok {
+			t.Errorf("for %s block map was not stored in session", e.name)
+			continue
+		}
+
+		if e.url == "/admin/reservations-calendar?y=2050&m=01" && blockMap["2050-01-4"] != 2 {
+			t.Errorf("for %s expected owner block 2 on 2050-01-4, got %d", e.name, blockMap["2050-01-4"])
+		}
+	}
+}
+
+func TestRepository_AdminPostReservationsCalendar(t *testing.T) {
+	tests := []struct {
+		name				string
+		blockMap			map[string]int
+		postedData			url.Values
+		expectedStatusCode	int
+		expectedError		string
+	}{
+		{
+			"keep and add blocks",
+			map[string]int{"2050-01-1": 0, "2050-01-2": 5},
+			url.Values{
+				"y": {"2050"},
+				"m": {"01"},
+				"remove_block_1_2050-01-2": {"5"},
+				"add_block_1_2050-01-3": {"1"},
+			},
+			http.StatusSeeOther,
+			"",
+		},
+		{
+			"remove block",
+			map[string]int{"2050-01-2": 5},
+			url.Values{"y": {"2050"}, "m": {"01"}},
+			http.StatusSeeOther,
+			"",
+		},
+		{
+			"fail removing block",
+			map[string]int{"2050-01-2": 1000},
+			url.Values{"y": {"2050"}, "m": {"01"}},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"fail adding block",
+			map[string]int{},
+			url.Values{"y": {"2050"}, "m": {"01"}, "add_block_1_1000-01-3": {"1"}},
+			http.StatusInternalServerError,
+			"",
+		},
+		{
+			"block booked day",
+			map[string]int{},
+			url.Values{"y": {"2051"}, "m": {"01"}, "add_block_1_2051-01-3": {"1"}, "add_block_2_2050-01-3": {"1"}},
+			http.StatusSeeOther,
+			"Booked days cannot be blocked: 2051-01-03!",
+		},
+		{
+			"block unknown room",
+			map[string]int{"2050-01-2": 1000},
+			url.Values{"y": {"2050"}, "m": {"01"}, "add_block_99_2050-01-3": {"1"}},
+			http.StatusSeeOther,
+			"Cannot block days of an unknown room!",
+		},
+		{
+			"no block map in session",
+			nil,
+			url.Values{"y": {"2050"}, "m": {"01"}},
+			http.StatusSeeOther,
+			"Calendar has expired, please try again",
+		},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/reservations-calendar", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if e.blockMap != nil {
+			session.Put(ctx, "block_map_1", e.blockMap)
+			session.Put(ctx, "block_map_2", map[string]int{})
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostReservationsCalendar)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if msg := session.PopString(ctx, "error"); msg != e.expectedError {
+			t.Errorf("for %s expected error %q but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestRepository_PostForgotPassword(t *testing.T) {
+	tests := []struct {
+		name				string
+		email				string
+		expectedStatusCode	int
+	}{
+		{"known email", "admin@here.com", http.StatusSeeOther},
+		{"unknown email", "nobody@here.com", http.StatusSeeOther},
+		{"invalid email", "nobody", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("email", e.email)
+
+		req, _ := http.NewRequest("POST", "/user/forgot-password", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostForgotPassword)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_ResetPassword(t *testing.T) {
+	user, _ := Repo.DB.GetUserByID(context.Background(), 1)
+	validToken := app.Signer.Sign(passwordResetPurpose, fmt.Sprintf("1:%s", passwordFingerprint(user)), time.Hour)
+	expiredToken := app.Signer.Sign(passwordResetPurpose, fmt.Sprintf("1:%s", passwordFingerprint(user)), -time.Hour)
+	changedToken := app.Signer.Sign(passwordResetPurpose, "1:0000000000000000", time.Hour)
+
+	getTests := []struct {
+		name				string
+		token				string
+		expectedStatusCode	int
+	}{
+		{"valid token", validToken, http.StatusOK},
+		{"expired token", expiredToken, http.StatusSeeOther},
+		{"password changed since", changedToken, http.StatusSeeOther},
+		{"garbage token", "garbage", http.StatusSeeOther},
+	}
+
+	for _, e := range getTests {
+		req, _ := http.NewRequest("GET", "/user/reset-password?token="+url.QueryEscape(e.token), nil)
+		req = req.WithContext(getCtx(req))
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.ShowResetPassword)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for GET %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+
+	postTests := []struct {
+		name				string
+		token				string
+		password			string
+		confirm				string
+		expectedStatusCode	int
+		expectedLocation	string
+	}{
+		{"valid", validToken, "a new password", "a new password", http.StatusSeeOther, "/user/login"},
+		{"mismatch", validToken, "a new password", "another password", http.StatusOK, ""},
+		{"too short", validToken, "short", "short", http.StatusOK, ""},
+		{"expired token", expiredToken, "a new password", "a new password", http.StatusSeeOther, "/user/forgot-password"},
+	}
+
+	for _, e := range postTests {
+		postedData := url.Values{}
+		postedData.Add("token", e.token)
+		postedData.Add("password", e.password)
+		postedData.Add("password_confirm", e.confirm)
+
+		req, _ := http.NewRequest("POST", "/user/reset-password", strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostResetPassword)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for POST %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			location, _ := rr.Result().Location()
+			if location.String() != e.expectedLocation {
+				t.Errorf("for POST %s expected location %s but got %s", e.name, e.expectedLocation, location.String())
+			}
+		}
+	}
+}
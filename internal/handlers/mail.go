@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/render"
+)
+
+// queueMail adds emails to the outbox, from where they are sent in the background. A failure is
+// only logged, as the change the email is about has already been saved
+func (m *Repository) queueMail(ctx context.Context, msgs ...models.MailData) {
+	for _, msg := range msgs {
+		err := m.DB.EnqueueMail(ctx, msg)
+		if err != nil {
+			m.App.ErrorLog.Printf("cannot queue email to %s: %s", msg.To, err)
+		}
+	}
+}
+
+// AdminMail lists the emails that could not be sent after every attempt
+func (m *Repository) AdminMail(w http.ResponseWriter, r *http.Request) {
+	mail, err := m.DB.AllDeadMail(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["mail"] = mail
+
+	render.Template(w, r, "admin-mail.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminResendMail puts an email that could not be sent back into the outbox
+func (m *Repository) AdminResendMail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	err = m.DB.ResendMail(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This email is not waiting to be resent!")
+		http.Redirect(w, r, "/admin/mail", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Email queued to be sent again")
+	http.Redirect(w, r, "/admin/mail", http.StatusSeeOther)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marif226/bookings/internal/emails"
+	"github.com/marif226/bookings/internal/models"
+)
+
+func TestRepository_ReservationNotifications(t *testing.T) {
+	templates, err := emails.Load("./../../email-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := models.Reservation{
+		ID: 1,
+		FirstName: "<John>",
+		LastName: "Smith",
+		Email: "john@smith.com",
+		StartDate: time.Now().AddDate(0, 1, 0),
+		EndDate: time.Now().AddDate(0, 1, 2),
+		RoomID: 1,
+		Room: models.Room{RoomName: "General's Quarters"},
+	}
+
+	msgs := Repo.reservationNotifications(res)
+	if len(msgs) != 2 || msgs[0].To != "john@smith.com" || msgs[1].To != app.Mail.Owner || msgs[1].From != app.Mail.From {
+		t.Fatalf("expected a confirmation to the guest and a notification to the owner, got %+v", msgs)
+	}
+
+	html, text, err := templates.Render(msgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(html, "&lt;John&gt;") || strings.Contains(html, "<John>") {
+		t.Error("expected the guest name to be escaped in the html body")
+	}
+
+	if !strings.Contains(text, "/manage-booking?token=") {
+		t.Errorf("expected the manage booking link in the text body, got\n%s", text)
+	}
+
+	if len(msgs[0].Attachments) != 1 || !strings.Contains(string(msgs[0].Attachments[0].Data), "UID:reservation-1@localhost") {
+		t.Errorf("expected the stay to be attached to the confirmation, got %+v", msgs[0].Attachments)
+	}
+
+	if len(msgs[1].Attachments) != 0 {
+		t.Error("did not expect an attachment for the owner")
+	}
+}
+
+func TestRepository_AdminMail(t *testing.T) {
+	req := adminRequest("GET", "/admin/mail", "", nil)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminMail).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("AdminMail returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	body := rr.Body.String()
+	for _, want := range []string{"john@smith.com", "Reservation Confirmation", "connection refused", "/admin/resend-mail/1"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected page to contain %q", want)
+		}
+	}
+}
+
+func TestRepository_AdminResendMail(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		expectedStatusCode	int
+		expectedFlash		string
+		expectedError		string
+	}{
+		{"resent", "1", http.StatusSeeOther, "Email queued to be sent again", ""},
+		{"not dead", "2", http.StatusSeeOther, "", "This email is not waiting to be resent!"},
+		{"invalid id", "x", http.StatusNotFound, "", ""},
+		{"database error", "1000", http.StatusInternalServerError, "", ""},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/resend-mail/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminResendMail).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if rr.Code == http.StatusSeeOther && rr.Header().Get("Location") != "/admin/mail" {
+			t.Errorf("%s: expected redirect to /admin/mail, got %s", e.name, rr.Header().Get("Location"))
+		}
+
+		if flash := session.GetString(req.Context(), "flash"); flash != e.expectedFlash {
+			t.Errorf("%s: expected flash %q, got %q", e.name, e.expectedFlash, flash)
+		}
+
+		if msg := session.GetString(req.Context(), "error"); msg != e.expectedError {
+			t.Errorf("%s: expected error %q, got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marif226/bookings/internal/emails"
+	"github.com/marif226/bookings/internal/forms"
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/render"
+	"github.com/marif226/bookings/internal/repository"
+	"github.com/marif226/bookings/internal/signer"
+	"github.com/marif226/bookings/internal/stayrules"
+)
+
+// manageBookingPurpose separates manage booking tokens from other signed tokens
+const manageBookingPurpose = "manage-booking"
+
+// manageBookingGrace is how long after departure a manage booking link keeps working
+const manageBookingGrace = 7 * 24 * time.Hour
+
+// bookingFingerprint ties a manage booking token to the email address of the guest, so that a
+// token cannot be used for another reservation
+func bookingFingerprint(res models.Reservation) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(res.Email)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// manageBookingPath returns the path of the page where the guest manages a reservation, signed
+// so that it works without logging in until shortly after departure
+func (m *Repository) manageBookingPath(res models.Reservation) string {
+	data := fmt.Sprintf("%d:%s", res.ID, bookingFingerprint(res))
+	token := m.App.Signer.Sign(manageBookingPurpose, data, time.Until(res.EndDate)+manageBookingGrace)
+	return "/manage-booking?token=" + url.QueryEscape(token)
+}
+
+// manageBookingLink returns the absolute manage booking link sent to guests by email
+func (m *Repository) manageBookingLink(res models.Reservation) string {
+	return m.App.URL + m.manageBookingPath(res)
+}
+
+// reservationForManageToken returns the reservation a manage booking token was issued for
+func (m *Repository) reservationForManageToken(ctx context.Context, token string) (models.Reservation, error) {
+	data, err := m.App.Signer.Verify(manageBookingPurpose, token)
+	if err != nil {
+		return models.Reservation{}, err
+	}
+
+	parts := strings.Split(data, ":")
+	if len(parts) != 2 {
+		return models.Reservation{}, signer.ErrInvalidToken
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return models.Reservation{}, signer.ErrInvalidToken
+	}
+
+	res, err := m.DB.GetReservationByID(ctx, id)
+	if err != nil {
+		return models.Reservation{}, err
+	}
+
+	if bookingFingerprint(res) != parts[1] {
+		return models.Reservation{}, signer.ErrInvalidToken
+	}
+
+	return res, nil
+}
+
+// reservationForManage returns the reservation for token, or sends the guest home with an error
+// when the link is invalid, expired or the reservation no longer exists
+func (m *Repository) reservationForManage(w http.ResponseWriter, r *http.Request, token string) (models.Reservation, bool) {
+	res, err := m.reservationForManageToken(r.Context(), token)
+	if errors.Is(err, signer.ErrInvalidToken) || errors.Is(err, signer.ErrExpiredToken) || errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "error", "This booking link is invalid or has expired")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return res, false
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return res, false
+	}
+
+	return res, true
+}
+
+// changeDeadline returns the last moment a reservation can be changed or cancelled online
+func (m *Repository) changeDeadline(res models.Reservation) time.Time {
+	return res.StartDate.Add(-m.App.Booking.CancellationWindow)
+}
+
+// canChangeOnline reports whether the guest may still change or cancel a reservation themselves
+func (m *Repository) canChangeOnline(res models.Reservation) bool {
+	return res.Status.Open() && time.Now().Before(m.changeDeadline(res))
+}
+
+// ShowManageBooking shows guests their reservation with the options to change its dates or cancel it
+func (m *Repository) ShowManageBooking(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	res, ok := m.reservationForManage(w, r, token)
+	if !ok {
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["can_change"] = m.canChangeOnline(res)
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = token
+	stringMap["start_date"] = res.StartDate.Format("02-01-2006")
+	stringMap["end_date"] = res.EndDate.Format("02-01-2006")
+	stringMap["deadline"] = m.changeDeadline(res).Format("02-01-2006 15:04")
+
+	render.Template(w, r, "manage-booking.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: data,
+		StringMap: stringMap,
+	})
+}
+
+// PostManageBookingDates moves a reservation to the dates chosen by the guest
+func (m *Repository) PostManageBookingDates(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token := r.Form.Get("token")
+	manageURL := "/manage-booking?token=" + url.QueryEscape(token)
+
+	res, ok := m.reservationForManage(w, r, token)
+	if !ok {
+		return
+	}
+
+	if !m.canChangeOnline(res) {
+		m.App.Session.Put(r.Context(), "error", "This booking can no longer be changed online, please contact us.")
+		http.Redirect(w, r, manageURL, http.StatusSeeOther)
+		return
+	}
+
+	layout := "02-01-2006"
+	startDate, err1 := time.Parse(layout, r.Form.Get("start_date"))
+	endDate, err2 := time.Parse(layout, r.Form.Get("end_date"))
+	if err1 != nil || err2 != nil {
+		m.App.Session.Put(r.Context(), "error", "Please choose your new arrival and departure dates!")
+		http.Redirect(w, r, manageURL, http.StatusSeeOther)
+		return
+	}
+
+	changed := res
+	changed.StartDate = startDate
+	changed.EndDate = endDate
+
+	if !time.Now().Before(m.changeDeadline(changed)) {
+		m.App.Session.Put(r.Context(), "error", "The new arrival date is too soon to book online, please contact us.")
+		http.Redirect(w, r, manageURL, http.StatusSeeOther)
+		return
+	}
+
+	err = m.checkStayRules(r.Context(), res.RoomID, startDate, endDate)
+	if v, ok := err.(stayrules.Violation); ok {
+		m.App.Session.Put(r.Context(), "error", v.Error())
+		http.Redirect(w, r, manageURL, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	changed.Quote, err = m.quoteStay(r.Context(), res.RoomID, startDate, endDate, res.Guests())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.ChangeReservationDates(r.Context(), changed)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, the room is not available for those dates.")
+		http.Redirect(w, r, manageURL, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stay := emails.NewStay(changed)
+	guest := emails.Message(changed.Email, m.App.Mail.From, "Reservation Changed", emails.DatesChanged{
+		Stay: stay,
+		ManageLink: m.manageBookingLink(changed),
+	})
+	guest.Attachments = []models.Attachment{m.stayAttachment(changed, false, calendarSequence())}
+
+	m.queueMail(r.Context(), guest,
+		emails.Message(m.App.Mail.Owner, m.App.Mail.From, "Reservation Changed", emails.OwnerNotification{
+			Event: emails.EventMoved,
+			Stay: stay,
+			PreviousStartDate: res.StartDate,
+			PreviousEndDate: res.EndDate,
+		}),
+	)
+
+	m.App.Session.Put(r.Context(), "flash", "Your booking has been changed")
+	// the link is signed again, as it expires after the new departure date
+	http.Redirect(w, r, m.manageBookingPath(changed), http.StatusSeeOther)
+}
+
+// PostManageBookingCancel cancels a reservation for the guest
+func (m *Repository) PostManageBookingCancel(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token := r.Form.Get("token")
+
+	res, ok := m.reservationForManage(w, r, token)
+	if !ok {
+		return
+	}
+
+	if !m.canChangeOnline(res) {
+		m.App.Session.Put(r.Context(), "error", "This booking can no longer be cancelled online, please contact us.")
+		http.Redirect(w, r, "/manage-booking?token="+url.QueryEscape(token), http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.UpdateReservationStatus(r.Context(), res.ID, models.StatusCancelled)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stay := emails.NewStay(res)
+	guest := emails.Message(res.Email, m.App.Mail.From, "Reservation Cancelled", emails.Cancellation{Stay: stay})
+	guest.Attachments = []models.Attachment{m.stayAttachment(res, true, calendarSequence())}
+
+	m.queueMail(r.Context(), guest,
+		emails.Message(m.App.Mail.Owner, m.App.Mail.From, "Reservation Cancelled", emails.OwnerNotification{
+			Event: emails.EventCancelled,
+			Stay: stay,
+		}),
+	)
+
+	m.App.Session.Put(r.Context(), "flash", "Your booking has been cancelled")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+)
+
+// manageToken signs a manage booking token for reservation id of john@smith.com, the guest of the test repo
+func manageToken(id int, ttl time.Duration) string {
+	guest := models.Reservation{Email: "john@smith.com"}
+	return app.Signer.Sign(manageBookingPurpose, fmt.Sprintf("%d:%s", id, bookingFingerprint(guest)), ttl)
+}
+
+func TestRepository_ShowManageBooking(t *testing.T) {
+	tests := []struct {
+		name				string
+		token				string
+		expectedStatusCode	int
+	}{
+		{"valid token", manageToken(1, time.Hour), http.StatusOK},
+		{"cancelled booking", manageToken(998, time.Hour), http.StatusOK},
+		{"expired token", manageToken(1, -time.Hour), http.StatusSeeOther},
+		{"another guest", app.Signer.Sign(manageBookingPurpose, "1:0000000000000000", time.Hour), http.StatusSeeOther},
+		{"reservation gone", manageToken(1001, time.Hour), http.StatusSeeOther},
+		{"database error", manageToken(1000, time.Hour), http.StatusInternalServerError},
+		{"garbage token", "garbage", http.StatusSeeOther},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/manage-booking?token="+url.QueryEscape(e.token), nil)
+		req = req.WithContext(getCtx(req))
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.ShowManageBooking)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostManageBookingDates(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					int
+		start				string
+		end					string
+		expectedStatusCode	int
+		expectedError		string
+	}{
+		{"valid", 1, "01-02-2050", "03-02-2050", http.StatusSeeOther, ""},
+		{"invalid dates", 1, "invalid", "03-02-2050", http.StatusSeeOther, "Please choose your new arrival and departure dates!"},
+		{"in the past", 1, "01-02-2000", "03-02-2000", http.StatusSeeOther, "The new arrival date is too soon to book online, please contact us."},
+		{"too short for christmas", 1, "24-12-2050", "25-12-2050", http.StatusSeeOther, "Stays over Christmas must be at least 3 nights!"},
+		{"room unavailable", 1, "01-02-2051", "03-02-2051", http.StatusSeeOther, "Sorry, the room is not available for those dates."},
+		{"database error", 999, "01-02-2050", "03-02-2050", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("token", manageToken(e.id, time.Hour))
+		postedData.Add("start_date", e.start)
+		postedData.Add("end_date", e.end)
+
+		req, _ := http.NewRequest("POST", "/manage-booking/dates", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostManageBookingDates)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedStatusCode != http.StatusSeeOther {
+			continue
+		}
+
+		location, _ := rr.Result().Location()
+		if !strings.HasPrefix(location.String(), "/manage-booking?token=") {
+			t.Errorf("for %s expected a redirect to the manage booking page, got %s", e.name, location.String())
+		}
+
+		if msg := session.GetString(ctx, "error"); msg != e.expectedError {
+			t.Errorf("for %s expected error %q but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestRepository_PostManageBookingCancel(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					int
+		expectedStatusCode	int
+		expectedLocation	string
+	}{
+		{"valid", 1, http.StatusSeeOther, "/"},
+		{"already cancelled", 998, http.StatusSeeOther, "/manage-booking"},
+		{"database error", 999, http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("token", manageToken(e.id, time.Hour))
+
+		req, _ := http.NewRequest("POST", "/manage-booking/cancel", strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostManageBookingCancel)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			location, _ := rr.Result().Location()
+			if location.Path != e.expectedLocation {
+				t.Errorf("for %s expected location %s but got %s", e.name, e.expectedLocation, location.String())
+			}
+		}
+	}
+}
+
+func TestRepository_ManageBookingAfterDeadline(t *testing.T) {
+	// reservations of the test repo start in 2050, so a window of 30 years has already closed
+	app.Booking.CancellationWindow = 30 * 365 * 24 * time.Hour
+	defer func() {
+		app.Booking.CancellationWindow = 0
+	}()
+
+	token := manageToken(1, time.Hour)
+
+	postedData := url.Values{}
+	postedData.Add("token", token)
+	postedData.Add("start_date", "01-02-2050")
+	postedData.Add("end_date", "03-02-2050")
+
+	for _, handler := range []http.HandlerFunc{Repo.PostManageBookingDates, Repo.PostManageBookingCancel} {
+		req, _ := http.NewRequest("POST", "/manage-booking", strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		location, _ := rr.Result().Location()
+		if rr.Code != http.StatusSeeOther || location.String() != "/manage-booking?token="+url.QueryEscape(token) {
+			t.Errorf("expected a redirect back to the booking, got %d %v", rr.Code, location)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/manage-booking?token="+url.QueryEscape(token), nil)
+	req = req.WithContext(getCtx(req))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.ShowManageBooking).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "contact us") {
+		t.Errorf("expected the booking page to ask the guest to contact us, got %d", rr.Code)
+	}
+}
+
+func TestRepository_PostManageBookingCancel_Memory(t *testing.T) {
+	repo := NewMemoryRepo(&app)
+	ctx := context.Background()
+
+	id, err := repo.DB.InsertReservation(ctx, models.Reservation{
+		FirstName: "John",
+		LastName: "Smith",
+		Email: "john@smith.com",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate: time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		RoomID: 1,
+		Adults: 1,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postedData := url.Values{}
+	postedData.Add("token", manageToken(id, time.Hour))
+
+	req, _ := http.NewRequest("POST", "/manage-booking/cancel", strings.NewReader(postedData.Encode()))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(repo.PostManageBookingCancel).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected the booking to be cancelled, got %d", rr.Code)
+	}
+
+	queued, err := repo.DB.ClaimMail(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notified := false
+	for _, mail := range queued {
+		if mail.Mail.Subject == "Reservation Cancelled" && mail.Mail.To == app.Mail.Owner && mail.Mail.From == app.Mail.From {
+			notified = true
+		}
+	}
+	if !notified {
+		t.Errorf("expected the owner to be notified from the configured address, got %+v", queued)
+	}
+}
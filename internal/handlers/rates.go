@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marif226/bookings/internal/forms"
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/pricing"
+	"github.com/marif226/bookings/internal/render"
+)
+
+// seasonDateLayout is the date format of seasons in the rate plan form
+const seasonDateLayout = "2006-01-02"
+
+// validCurrency matches ISO 4217 currency codes such as USD
+var validCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// quoteStay prices a stay for guests in a room booked today, the quote is zero when the room has no rate plan
+func (m *Repository) quoteStay(ctx context.Context, roomID int, start, end time.Time, guests int) (models.Quote, error) {
+	plan, err := m.DB.GetRatePlanByRoomID(ctx, roomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Quote{}, nil
+	} else if err != nil {
+		return models.Quote{}, err
+	}
+
+	return pricing.Quote(plan, start, end, today(), guests)
+}
+
+// AdminShowRatePlan shows the rate plan of a room
+func (m *Repository) AdminShowRatePlan(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	plan, err := m.DB.GetRatePlanByRoomID(r.Context(), room.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		plan = models.RatePlan{
+			Currency: "USD",
+			IncludedGuests: room.MaxOccupancy,
+		}
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	values := url.Values{}
+	values.Set("currency", plan.Currency)
+	values.Set("included_guests", strconv.Itoa(plan.IncludedGuests))
+	values.Set("seasons", formatSeasons(plan.Seasons))
+
+	if plan.ID != 0 {
+		values.Set("nightly_rate", pricing.FormatAmount(plan.NightlyRate))
+		values.Set("weekend_rate", optionalAmount(plan.WeekendRate))
+		values.Set("extra_guest_rate", optionalAmount(plan.ExtraGuestRate))
+	}
+
+	m.renderRatePlanForm(w, r, room, forms.New(values))
+}
+
+// AdminPostRatePlan saves the rate plan of a room
+func (m *Repository) AdminPostRatePlan(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room, ok := m.roomForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("currency", "nightly_rate", "included_guests")
+
+	plan := models.RatePlan{
+		RoomID: room.ID,
+		Currency: strings.ToUpper(strings.TrimSpace(form.Get("currency"))),
+	}
+
+	if !validCurrency.MatchString(plan.Currency) {
+		form.Errors.Add("currency", "Use a three letter currency code, e.g. USD!")
+	}
+
+	plan.NightlyRate = amountField(form, "nightly_rate")
+	plan.WeekendRate = amountField(form, "weekend_rate")
+	plan.ExtraGuestRate = amountField(form, "extra_guest_rate")
+
+	plan.IncludedGuests, err = strconv.Atoi(form.Get("included_guests"))
+	if err != nil || plan.IncludedGuests < 1 {
+		form.Errors.Add("included_guests", "Must be a whole number of at least 1!")
+	}
+
+	plan.Seasons, err = parseSeasons(form.Get("seasons"))
+	if err != nil {
+		form.Errors.Add("seasons", err.Error())
+	}
+
+	if !form.Valid() {
+		m.renderRatePlanForm(w, r, room, form)
+		return
+	}
+
+	err = m.DB.SaveRatePlan(r.Context(), plan)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Rates saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// renderRatePlanForm renders the rate plan form of a room with the values held by form
+func (m *Repository) renderRatePlanForm(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["room"] = room
+
+	render.Template(w, r, "admin-rooms-rates.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// amountField parses an optional amount field of form into cents, adding an error if it is invalid
+func amountField(form *forms.Form, field string) int {
+	if strings.TrimSpace(form.Get(field)) == "" {
+		return 0
+	}
+
+	cents, err := pricing.ParseAmount(form.Get(field))
+	if err != nil {
+		form.Errors.Add(field, "Must be an amount such as 120 or 120.50!")
+	}
+
+	return cents
+}
+
+// optionalAmount formats an amount for a form field that may be left blank for 0
+func optionalAmount(cents int) string {
+	if cents == 0 {
+		return ""
+	}
+	return pricing.FormatAmount(cents)
+}
+
+// formatSeasons writes seasons one per line in the format read by parseSeasons
+func formatSeasons(seasons []models.RateSeason) string {
+	var lines []string
+	for _, s := range seasons {
+		line := fmt.Sprintf("%s | %s | %s | %s", s.Name, s.StartDate.Format(seasonDateLayout),
+			s.EndDate.Format(seasonDateLayout), pricing.FormatAmount(s.NightlyRate))
+		if s.WeekendRate != 0 {
+			line += " | " + pricing.FormatAmount(s.WeekendRate)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseSeasons reads seasons written one per line as "name | first night | last night | nightly rate"
+// with an optional "| weekend rate" at the end
+func parseSeasons(s string) ([]models.RateSeason, error) {
+	var seasons []models.RateSeason
+
+	for i, line := range lines(s) {
+		fields := strings.Split(line, "|")
+		if len(fields) < 4 || len(fields) > 5 {
+			return nil, fmt.Errorf("Line %d must have 4 or 5 parts separated by |!", i+1)
+		}
+
+		for j := range fields {
+			fields[j] = strings.TrimSpace(fields[j])
+		}
+
+		season := models.RateSeason{
+			Name: fields[0],
+		}
+
+		var err error
+
+		season.StartDate, err = time.Parse(seasonDateLayout, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: the first night must be a date in YYYY-MM-DD format!", i+1)
+		}
+
+		season.EndDate, err = time.Parse(seasonDateLayout, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: the last night must be a date in YYYY-MM-DD format!", i+1)
+		}
+
+		if season.EndDate.Before(season.StartDate) {
+			return nil, fmt.Errorf("Line %d: the last night cannot be before the first night!", i+1)
+		}
+
+		season.NightlyRate, err = pricing.ParseAmount(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: the nightly rate must be an amount such as 120.50!", i+1)
+		}
+
+		if len(fields) == 5 && fields[4] != "" {
+			season.WeekendRate, err = pricing.ParseAmount(fields[4])
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: the weekend rate must be an amount such as 120.50!", i+1)
+			}
+		}
+
+		seasons = append(seasons, season)
+	}
+
+	return seasons, nil
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRepository_AdminShowRatePlan(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		expectedStatusCode	int
+		expectedBody		string
+	}{
+		{"existing plan", "1", http.StatusOK, "Holidays | 2050-12-20 | 2051-01-02 | 150.00"},
+		{"no plan yet", "2", http.StatusOK, `value="USD"`},
+		{"missing room", "3", http.StatusNotFound, ""},
+		{"database error", "1001", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("GET", "/admin/rooms/"+e.id+"/rates", e.id, nil)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminShowRatePlan).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedBody != "" && !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("for %s expected the form to contain %q", e.name, e.expectedBody)
+		}
+	}
+}
+
+func TestRepository_AdminPostRatePlan(t *testing.T) {
+	valid := func(changes map[string]string) url.Values {
+		postedData := url.Values{}
+		postedData.Add("currency", "usd")
+		postedData.Add("nightly_rate", "120")
+		postedData.Add("weekend_rate", "140.50")
+		postedData.Add("included_guests", "2")
+		postedData.Add("extra_guest_rate", "")
+		postedData.Add("seasons", "Holidays | 2050-12-20 | 2051-01-02 | 150.00 | 180\n\n | 2050-07-01 | 2050-08-31 | 130")
+		for k, v := range changes {
+			postedData.Set(k, v)
+		}
+		return postedData
+	}
+
+	tests := []struct {
+		name				string
+		id					string
+		postedData			url.Values
+		expectedStatusCode	int
+		expectedError		string
+	}{
+		{"save", "1", valid(nil), http.StatusSeeOther, ""},
+		{"invalid currency", "1", valid(map[string]string{"currency": "dollars"}), http.StatusOK, "three letter currency"},
+		{"missing nightly rate", "1", valid(map[string]string{"nightly_rate": ""}), http.StatusOK, "cannot be blank"},
+		{"invalid weekend rate", "1", valid(map[string]string{"weekend_rate": "1,50"}), http.StatusOK, "amount such as"},
+		{"no guests included", "1", valid(map[string]string{"included_guests": "0"}), http.StatusOK, "at least 1"},
+		{"invalid season", "1", valid(map[string]string{"seasons": "Holidays | 2050-12-20 | 150.00"}), http.StatusOK, "Line 1 must have"},
+		{"missing room", "3", valid(nil), http.StatusNotFound, ""},
+		{"database error", "1000", valid(nil), http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/rooms/"+e.id+"/rates", e.id, e.postedData)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostRatePlan).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedError != "" && !strings.Contains(rr.Body.String(), e.expectedError) {
+			t.Errorf("for %s expected the form to show %q", e.name, e.expectedError)
+		}
+	}
+}
+
+func TestParseSeasons(t *testing.T) {
+	seasons, err := parseSeasons("Holidays | 2050-12-20 | 2051-01-02 | 150 | 180.50\n\n | 2050-07-01 | 2050-08-31 | 130 |")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seasons) != 2 {
+		t.Fatalf("expected 2 seasons, got %d", len(seasons))
+	}
+
+	if seasons[0].Name != "Holidays" || seasons[0].NightlyRate != 15000 || seasons[0].WeekendRate != 18050 || seasons[0].EndDate.Year() != 2051 {
+		t.Errorf("unexpected first season %+v", seasons[0])
+	}
+
+	if seasons[1].Name != "" || seasons[1].NightlyRate != 13000 || seasons[1].WeekendRate != 0 {
+		t.Errorf("unexpected second season %+v", seasons[1])
+	}
+
+	for _, invalid := range []string{
+		"Holidays | 2050-12-20",
+		"Holidays | 20-12-2050 | 2051-01-02 | 150",
+		"Holidays | 2050-12-20 | 2050-12-19 | 150",
+		"Holidays | 2050-12-20 | 2051-01-02 | free",
+		"Holidays | 2050-12-20 | 2051-01-02 | 150 | -1",
+	} {
+		_, err := parseSeasons(invalid)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
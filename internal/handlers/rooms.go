@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/marif226/bookings/internal/forms"
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/render"
+	"github.com/marif226/bookings/internal/repository"
+)
+
+// validSlug matches lower case words joined by single dashes, e.g. generals-quarters
+var validSlug = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Rooms renders the list of all rooms
+func (m *Repository) Rooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.Template(w, r, "rooms.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// Room renders the page of the room with the slug in the URL
+func (m *Repository) Room(w http.ResponseWriter, r *http.Request) {
+	room, err := m.DB.GetRoomBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+
+	render.Template(w, r, "room.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminRooms shows all rooms in admin tool
+func (m *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-rooms.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowRoom shows the form to create a new room or edit an existing one
+func (m *Repository) AdminShowRoom(w http.ResponseWriter, r *http.Request) {
+	room := models.Room{
+		MaxOccupancy: 2,
+	}
+
+	if chi.URLParam(r, "id") != "" {
+		var ok bool
+		room, ok = m.roomForAdmin(w, r)
+		if !ok {
+			return
+		}
+	}
+
+	m.renderRoomForm(w, r, room, forms.New(nil))
+}
+
+// AdminPostShowRoom creates or updates a room
+func (m *Repository) AdminPostShowRoom(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var room models.Room
+
+	if chi.URLParam(r, "id") != "" {
+		var ok bool
+		room, ok = m.roomForAdmin(w, r)
+		if !ok {
+			return
+		}
+	}
+
+	room.RoomName = strings.TrimSpace(r.Form.Get("room_name"))
+	room.Slug = strings.TrimSpace(r.Form.Get("slug"))
+	room.Description = strings.TrimSpace(r.Form.Get("description"))
+	room.BedConfiguration = strings.TrimSpace(r.Form.Get("bed_configuration"))
+	room.Amenities = lines(r.Form.Get("amenities"))
+	room.Photos = parsePhotos(r.Form.Get("photos"))
+
+	if room.Slug == "" {
+		room.Slug = slugify(room.RoomName)
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_name", "max_occupancy")
+
+	if !validSlug.MatchString(room.Slug) {
+		form.Errors.Add("slug", "Use lower case letters, digits and dashes only!")
+	}
+
+	room.MaxOccupancy, err = strconv.Atoi(r.Form.Get("max_occupancy"))
+	if err != nil || room.MaxOccupancy < 1 {
+		form.Errors.Add("max_occupancy", "Must be a whole number of at least 1!")
+	}
+
+	for _, p := range room.Photos {
+		if !strings.HasPrefix(p.URL, "/") && !strings.HasPrefix(p.URL, "https://") && !strings.HasPrefix(p.URL, "http://") {
+			form.Errors.Add("photos", "Photo URLs must start with /, http:// or https://!")
+			break
+		}
+	}
+
+	if form.Valid() {
+		if room.ID == 0 {
+			room.ID, err = m.DB.InsertRoom(r.Context(), room)
+		} else {
+			err = m.DB.UpdateRoom(r.Context(), room)
+		}
+
+		if errors.Is(err, repository.ErrDuplicateSlug) {
+			form.Errors.Add("slug", "This slug is already used by another room!")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		m.renderRoomForm(w, r, room, form)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminDeleteRoom deletes a room that has no reservations or blocks
+func (m *Repository) AdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.DB.DeleteRoom(r.Context(), room.ID)
+	if errors.Is(err, repository.ErrRoomInUse) {
+		m.App.Session.Put(r.Context(), "error", "Rooms with reservations or blocks cannot be deleted")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room deleted")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// roomForAdmin loads the room with the id in the URL; it writes the response and returns false
+// when there is no such room
+func (m *Repository) roomForAdmin(w http.ResponseWriter, r *http.Request) (models.Room, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return models.Room{}, false
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return room, false
+	} else if err != nil {
+		helpers.ServerError(w, err)
+		return room, false
+	}
+
+	return room, true
+}
+
+// renderRoomForm renders the room form, amenities and photos are edited one per line
+func (m *Repository) renderRoomForm(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form) {
+	var photos []string
+	for _, p := range room.Photos {
+		if p.Caption != "" {
+			photos = append(photos, p.URL+" | "+p.Caption)
+		} else {
+			photos = append(photos, p.URL)
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+	data["amenities"] = strings.Join(room.Amenities, "\n")
+	data["photos"] = strings.Join(photos, "\n")
+
+	if room.ID != 0 {
+		token, err := m.DB.GetRoomICalToken(r.Context(), room.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if token != "" {
+			data["ical_url"] = m.roomFeedURL(room.ID, token)
+		}
+	}
+
+	render.Template(w, r, "admin-rooms-show.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// lines returns the non-blank lines of s, trimmed
+func lines(s string) []string {
+	var result []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// parsePhotos reads a gallery written one photo per line as "url" or "url | caption"
+func parsePhotos(s string) []models.RoomPhoto {
+	var photos []models.RoomPhoto
+	for _, line := range lines(s) {
+		url, caption, _ := strings.Cut(line, "|")
+		photos = append(photos, models.RoomPhoto{
+			URL: strings.TrimSpace(url),
+			Caption: strings.TrimSpace(caption),
+		})
+	}
+	return photos
+}
+
+// slugify turns a room name into a slug, e.g. "General's Quarters" into "generals-quarters"
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, c := range strings.ToLower(name) {
+		switch {
+		case c >= 'a' && c <= 'z' || c >= '0' && c <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(c)
+			dash = false
+		case c == '\'':
+			// "General's" becomes "generals" rather than "general-s"
+		default:
+			dash = true
+		}
+	}
+
+	return b.String()
+}
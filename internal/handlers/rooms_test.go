@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestRepository_Room(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/rooms/generals-quarters", nil)
+	ctx := getCtx(req)
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("slug", "generals-quarters")
+	req = req.WithContext(context.WithValue(ctx, chi.RouteCtxKey, chiCtx))
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.Room).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Room handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	for _, want := range []string{"General&#39;s Quarters", "1 king bed", "Sea view", "/static/images/generals-quarters.png", `formData.append("room_id", "1")`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected room page to contain %q", want)
+		}
+	}
+}
+
+func TestRepository_AdminRooms(t *testing.T) {
+	req := adminRequest("GET", "/admin/rooms", "", nil)
+	rr := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminRooms).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminRooms handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	if !strings.Contains(rr.Body.String(), "/rooms/majors-suite") {
+		t.Error("expected the rooms to link to their pages")
+	}
+}
+
+func TestRepository_AdminShowRoom(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		expectedStatusCode	int
+	}{
+		{"new room", "", http.StatusOK},
+		{"existing room", "1", http.StatusOK},
+		{"calendar link off", "2", http.StatusOK},
+		{"invalid id", "x", http.StatusNotFound},
+		{"missing room", "3", http.StatusNotFound},
+		{"calendar link error", "1000", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("GET", "/admin/rooms/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminShowRoom).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		feed := "/ical/rooms/" + e.id + ".ics?token=feed-token"
+		if e.id == "1" && !strings.Contains(rr.Body.String(), feed) {
+			t.Errorf("for %s expected the calendar link %s on the page", e.name, feed)
+		}
+	}
+}
+
+func TestRepository_AdminPostShowRoom(t *testing.T) {
+	valid := func(changes map[string]string) url.Values {
+		postedData := url.Values{}
+		postedData.Add("room_name", "Colonel's Cabin")
+		postedData.Add("slug", "")
+		postedData.Add("description", "A cabin in the woods")
+		postedData.Add("max_occupancy", "4")
+		postedData.Add("bed_configuration", "2 double beds")
+		postedData.Add("amenities", "Fireplace\n\nSauna\n")
+		postedData.Add("photos", "/static/images/outside.png | The cabin\nhttps://example.com/inside.png")
+		for k, v := range changes {
+			postedData.Set(k, v)
+		}
+		return postedData
+	}
+
+	tests := []struct {
+		name				string
+		id					string
+		postedData			url.Values
+		expectedStatusCode	int
+		expectedError		string
+	}{
+		{"create room", "", valid(nil), http.StatusSeeOther, ""},
+		{"create without name", "", valid(map[string]string{"room_name": ""}), http.StatusOK, "cannot be blank"},
+		{"create with invalid slug", "", valid(map[string]string{"slug": "Colonel's Cabin"}), http.StatusOK, "lower case letters"},
+		{"create with taken slug", "", valid(map[string]string{"slug": "taken"}), http.StatusOK, "already used"},
+		{"create with no occupancy", "", valid(map[string]string{"max_occupancy": "0"}), http.StatusOK, "at least 1"},
+		{"create with invalid photo", "", valid(map[string]string{"photos": "outside.png"}), http.StatusOK, "Photo URLs"},
+		{"create fails", "", valid(map[string]string{"room_name": "fail"}), http.StatusInternalServerError, ""},
+		{"update room", "1", valid(nil), http.StatusSeeOther, ""},
+		{"update with taken slug", "1", valid(map[string]string{"slug": "taken"}), http.StatusOK, "already used"},
+		{"update missing room", "3", valid(nil), http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/rooms/"+e.id, e.id, e.postedData)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostShowRoom).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedError != "" && !strings.Contains(rr.Body.String(), e.expectedError) {
+			t.Errorf("for %s expected the form to show %q", e.name, e.expectedError)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteRoom(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		expectedStatusCode	int
+		expectedSession		string
+	}{
+		{"delete", "1", http.StatusSeeOther, "flash"},
+		{"room in use", "2", http.StatusSeeOther, "error"},
+		{"missing room", "3", http.StatusNotFound, ""},
+		{"database error", "1000", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/delete-room/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminDeleteRoom).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedSession != "" && session.PopString(req.Context(), e.expectedSession) == "" {
+			t.Errorf("for %s expected a %s message", e.name, e.expectedSession)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"General's Quarters":	"generals-quarters",
+		"  Room 12 -- Annex ":	"room-12-annex",
+		"Chambre à deux":		"chambre-deux",
+	}
+
+	for name, expected := range tests {
+		if got := slugify(name); got != expected {
+			t.Errorf("slugify(%q) = %q, wanted %q", name, got, expected)
+		}
+	}
+}
+
+func TestParsePhotos(t *testing.T) {
+	photos := parsePhotos("/a.png | Front door \n\n /b.png\n")
+
+	if len(photos) != 2 {
+		t.Fatalf("expected 2 photos, got %d", len(photos))
+	}
+
+	if photos[0].URL != "/a.png" || photos[0].Caption != "Front door" || photos[1].URL != "/b.png" || photos[1].Caption != "" {
+		t.Errorf("unexpected photos %+v", photos)
+	}
+}
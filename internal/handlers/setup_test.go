@@ -15,11 +15,21 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/justinas/nosurf"
 	"github.com/marif226/bookings/internal/config"
+	"github.com/marif226/bookings/internal/helpers"
 	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/pricing"
 	"github.com/marif226/bookings/internal/render"
+	"github.com/marif226/bookings/internal/signer"
 )
 
-var functions = template.FuncMap {}
+var functions = template.FuncMap {
+	"humanDate": render.HumanDate,
+	"formatDate": render.FormatDate,
+	"iterate": render.Iterate,
+	"add": render.Add,
+	"accessLevelName": models.AccessLevelName,
+	"money": pricing.FormatMoney,
+}
 var app config.AppConfig
 var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
@@ -27,6 +37,7 @@ var pathToTemplates = "./../../templates"
 func TestMain(m *testing.M) {
 	// what am i going to put in the session
 	gob.Register(models.Reservation{})
+	gob.Register(map[string]int{})
 
 	// change to true when in production
 	app.InProduction = false
@@ -46,11 +57,10 @@ func TestMain(m *testing.M) {
 
 	app.Session = session
 
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
-	defer close(mailChan)
-
-	listenForMail()
+	app.URL = "http://localhost:8080"
+	app.Mail.From = "bookings@here.com"
+	app.Mail.Owner = "owner@here.com"
+	app.Signer = signer.New([]byte("0123456789abcdef0123456789abcdef"))
 
 	// create template cache
 	templateCache, err := CreateTestTemplateCache()
@@ -70,15 +80,9 @@ func TestMain(m *testing.M) {
 	// set app config for render package
 	render.NewRenderer(&app)
 
-	os.Exit(m.Run())
-}
+	helpers.NewHelpers(&app)
 
-func listenForMail() {
-	go func() {
-		for {
-			_ = <- app.MailChan
-		}
-	}()
+	os.Exit(m.Run())
 }
 
 func getRoutes() http.Handler {
@@ -90,8 +94,8 @@ func getRoutes() http.Handler {
 
 	mux.Get("/", Repo.Home)
 	mux.Get("/about", Repo.About)
-	mux.Get("/generals-quarters", Repo.Generals)
-	mux.Get("/majors-suite", Repo.Majors)
+	mux.Get("/rooms", Repo.Rooms)
+	mux.Get("/rooms/{slug}", Repo.Room)
 	mux.Get("/contact", Repo.Contact)
 
 	mux.Get("/search-availability", Repo.Availability)
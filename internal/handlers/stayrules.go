@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marif226/bookings/internal/forms"
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/render"
+	"github.com/marif226/bookings/internal/stayrules"
+)
+
+// weekdayNames are the names of days of the week in the stay rules form
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// checkStayRules returns a stayrules.Violation if a stay in a room breaks one of its rules when booked today
+func (m *Repository) checkStayRules(ctx context.Context, roomID int, start, end time.Time) error {
+	rules, err := m.DB.GetStayRulesByRoomID(ctx, roomID)
+	if err != nil {
+		return err
+	}
+
+	return stayrules.Check(rules, start, end, today())
+}
+
+// today returns the current date at midnight UTC, the way dates of stays are parsed
+func today() time.Time {
+	y, mo, d := time.Now().Date()
+	return time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)
+}
+
+// AdminShowStayRules shows the stay rules of a room
+func (m *Repository) AdminShowStayRules(w http.ResponseWriter, r *http.Request) {
+	room, ok := m.roomForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := m.DB.GetStayRulesByRoomID(r.Context(), room.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	values := url.Values{}
+	values.Set("rules", formatStayRules(rules))
+
+	m.renderStayRulesForm(w, r, room, forms.New(values))
+}
+
+// AdminPostStayRules saves the stay rules of a room
+func (m *Repository) AdminPostStayRules(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room, ok := m.roomForAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	rules, err := parseStayRules(form.Get("rules"))
+	if err != nil {
+		form.Errors.Add("rules", err.Error())
+		m.renderStayRulesForm(w, r, room, form)
+		return
+	}
+
+	err = m.DB.SaveStayRules(r.Context(), room.ID, rules)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rules saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// renderStayRulesForm renders the stay rules form of a room with the values held by form
+func (m *Repository) renderStayRulesForm(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["room"] = room
+
+	render.Template(w, r, "admin-rooms-stay-rules.page.html", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// formatStayRules writes rules one per line in the format read by parseStayRules
+func formatStayRules(rules []models.StayRule) string {
+	var lines []string
+	for _, rule := range rules {
+		var start, end string
+		if rule.HasDates() {
+			start, end = rule.StartDate.Format(seasonDateLayout), rule.EndDate.Format(seasonDateLayout)
+		}
+
+		var settings []string
+		if rule.MinNights > 0 {
+			settings = append(settings, fmt.Sprintf("min=%d", rule.MinNights))
+		}
+		if rule.MaxNights > 0 {
+			settings = append(settings, fmt.Sprintf("max=%d", rule.MaxNights))
+		}
+		if rule.ClosedToArrival != 0 {
+			settings = append(settings, "no-arrival="+formatWeekdays(rule.ClosedToArrival))
+		}
+		if rule.ClosedToDeparture != 0 {
+			settings = append(settings, "no-departure="+formatWeekdays(rule.ClosedToDeparture))
+		}
+		if rule.LeadDays > 0 {
+			settings = append(settings, fmt.Sprintf("lead=%d", rule.LeadDays))
+		}
+
+		lines = append(lines, fmt.Sprintf("%s | %s | %s | %s", rule.Name, start, end, strings.Join(settings, " ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseStayRules reads rules written one per line as "name | first date | last date | settings", where
+// the dates may both be left blank for a rule that applies all year and the settings are any of
+// min=N, max=N, no-arrival=days, no-departure=days and lead=N separated by spaces
+func parseStayRules(s string) ([]models.StayRule, error) {
+	var rules []models.StayRule
+
+	for i, line := range lines(s) {
+		fields := strings.Split(line, "|")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("Line %d must have 4 parts separated by |!", i+1)
+		}
+
+		for j := range fields {
+			fields[j] = strings.TrimSpace(fields[j])
+		}
+
+		rule := models.StayRule{
+			Name: fields[0],
+		}
+
+		if fields[1] != "" || fields[2] != "" {
+			var err error
+
+			rule.StartDate, err = time.Parse(seasonDateLayout, fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: the first date must be a date in YYYY-MM-DD format!", i+1)
+			}
+
+			rule.EndDate, err = time.Parse(seasonDateLayout, fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: the last date must be a date in YYYY-MM-DD format!", i+1)
+			}
+
+			if rule.EndDate.Before(rule.StartDate) {
+				return nil, fmt.Errorf("Line %d: the last date cannot be before the first date!", i+1)
+			}
+		}
+
+		for _, setting := range strings.Fields(fields[3]) {
+			key, value, _ := strings.Cut(setting, "=")
+
+			var err error
+
+			switch key {
+			case "min":
+				rule.MinNights, err = strconv.Atoi(value)
+			case "max":
+				rule.MaxNights, err = strconv.Atoi(value)
+			case "lead":
+				rule.LeadDays, err = strconv.Atoi(value)
+			case "no-arrival":
+				rule.ClosedToArrival, err = parseWeekdays(value)
+			case "no-departure":
+				rule.ClosedToDeparture, err = parseWeekdays(value)
+			default:
+				return nil, fmt.Errorf("Line %d: unknown setting %q!", i+1, setting)
+			}
+
+			if err != nil || rule.MinNights < 0 || rule.MaxNights < 0 || rule.LeadDays < 0 {
+				return nil, fmt.Errorf("Line %d: invalid setting %q!", i+1, setting)
+			}
+		}
+
+		if rule.MaxNights > 0 && rule.MaxNights < rule.MinNights {
+			return nil, fmt.Errorf("Line %d: the maximum cannot be below the minimum!", i+1)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// formatWeekdays writes days as a comma separated list such as "fri,sat"
+func formatWeekdays(days models.Weekdays) string {
+	var names []string
+	for _, d := range days.Days() {
+		names = append(names, weekdayNames[d])
+	}
+	return strings.Join(names, ",")
+}
+
+// parseWeekdays reads a comma separated list of days such as "fri,sat"
+func parseWeekdays(s string) (models.Weekdays, error) {
+	var days models.Weekdays
+	for _, name := range strings.Split(s, ",") {
+		d, ok := weekday(name)
+		if !ok {
+			return 0, fmt.Errorf("unknown day %q", name)
+		}
+		days = days.With(d)
+	}
+	return days, nil
+}
+
+// weekday returns the day of the week named name, which may be abbreviated to three letters
+func weekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if len(name) >= 3 && strings.HasPrefix(strings.ToLower(d.String()), name) {
+			return d, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepository_AdminShowStayRules(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		expectedStatusCode	int
+		expectedBody		string
+	}{
+		{"existing rules", "1", http.StatusOK, "Christmas | 2050-12-23 | 2050-12-26 | min=3"},
+		{"missing room", "3", http.StatusNotFound, ""},
+		{"database error", "1002", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("GET", "/admin/rooms/"+e.id+"/stay-rules", e.id, nil)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminShowStayRules).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedBody != "" && !strings.Contains(rr.Body.String(), e.expectedBody) {
+			t.Errorf("for %s expected the form to contain %q", e.name, e.expectedBody)
+		}
+	}
+}
+
+func TestRepository_AdminPostStayRules(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		rules				string
+		expectedStatusCode	int
+		expectedError		string
+	}{
+		{"save", "1", "Christmas | 2050-12-23 | 2050-12-26 | min=3\nAll year | | | max=14 lead=1", http.StatusSeeOther, ""},
+		{"no rules", "1", "", http.StatusSeeOther, ""},
+		{"invalid rule", "1", "Christmas | 2050-12-23 | min=3", http.StatusOK, "Line 1 must have"},
+		{"missing room", "3", "", http.StatusNotFound, ""},
+		{"database error", "1000", "", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("rules", e.rules)
+
+		req := adminRequest("POST", "/admin/rooms/"+e.id+"/stay-rules", e.id, postedData)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostStayRules).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedError != "" && !strings.Contains(rr.Body.String(), e.expectedError) {
+			t.Errorf("for %s expected the form to show %q", e.name, e.expectedError)
+		}
+	}
+}
+
+func TestParseStayRules(t *testing.T) {
+	text := "Christmas | 2050-12-23 | 2050-12-26 | min=3 no-arrival=sun,Monday no-departure=sat\n\n | | | max=14 lead=2"
+
+	rules, err := parseStayRules(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+
+	christmas := rules[0]
+	if christmas.Name != "Christmas" || christmas.MinNights != 3 || !christmas.HasDates() ||
+		!christmas.ClosedToArrival.Has(time.Sunday) || !christmas.ClosedToArrival.Has(time.Monday) ||
+		christmas.ClosedToArrival.Has(time.Saturday) || !christmas.ClosedToDeparture.Has(time.Saturday) {
+		t.Errorf("unexpected first rule %+v", christmas)
+	}
+
+	if rules[1].HasDates() || rules[1].MaxNights != 14 || rules[1].LeadDays != 2 {
+		t.Errorf("unexpected second rule %+v", rules[1])
+	}
+
+	if s := formatStayRules(rules); s != "Christmas | 2050-12-23 | 2050-12-26 | min=3 no-arrival=sun,mon no-departure=sat\n |  |  | max=14 lead=2" {
+		t.Errorf("unexpected formatting %q", s)
+	}
+
+	for _, invalid := range []string{
+		"Christmas | 2050-12-23 | min=3",
+		"Christmas | 2050-12-23 | | min=3",
+		"Christmas | 2050-12-26 | 2050-12-23 | min=3",
+		"Christmas | | | min=three",
+		"Christmas | | | min=-1",
+		"Christmas | | | min=5 max=3",
+		"Christmas | | | no-arrival=someday",
+		"Christmas | | | closed",
+	} {
+		_, err := parseStayRules(invalid)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/marif226/bookings/internal/forms"
+	"github.com/marif226/bookings/internal/helpers"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/render"
+	"github.com/marif226/bookings/internal/repository"
+)
+
+// minPasswordLength is the shortest password accepted for a user
+const minPasswordLength = 8
+
+// accessLevelOption is one entry of the access level select on the user form
+type accessLevelOption struct {
+	Level	int
+	Name	string
+}
+
+// accessLevelOptions returns the access levels the current user may hand out
+func (m *Repository) accessLevelOptions(r *http.Request) []accessLevelOption {
+	current := m.App.Session.GetInt(r.Context(), "access_level")
+
+	var options []accessLevelOption
+	for level := models.AccessGuest; level <= current && level <= models.AccessOwner; level++ {
+		options = append(options, accessLevelOption{Level: level, Name: models.AccessLevelName(level)})
+	}
+
+	return options
+}
+
+// AdminUsers shows all users in admin tool
+func (m *Repository) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := m.DB.AllUsers(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["users"] = users
+
+	render.Template(w, r, "admin-users.page.html", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowUser shows the form to create a new user or edit an existing one
+func (m *Repository) AdminShowUser(w http.ResponseWriter, r *http.Request) {
+	user := models.User{
+		AccessLevel: models.AccessStaff,
+		Active: true,
+	}
+
+	if chi.URLParam(r, "id") != "" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		}
+
+		user, err = m.DB.GetUserByID(r.Context(), id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if !helpers.HasAccess(r, user.AccessLevel) {
+			helpers.ClientError(w, http.StatusForbidden)
+			return
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["user"] = user
+	data["access_levels"] = m.accessLevelOptions(r)
+
+	render.Template(w, r, "admin-users-show.page.html", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostShowUser creates or updates a user
+func (m *Repository) AdminPostShowUser(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var user models.User
+
+	if chi.URLParam(r, "id") != "" {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		}
+
+		user, err = m.DB.GetUserByID(r.Context(), id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if !helpers.HasAccess(r, user.AccessLevel) {
+			helpers.ClientError(w, http.StatusForbidden)
+			return
+		}
+	}
+
+	user.FirstName = r.Form.Get("first_name")
+	user.LastName = r.Form.Get("last_name")
+	user.Email = r.Form.Get("email")
+	password := r.Form.Get("password")
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "access_level")
+	form.IsEmail("email")
+
+	if user.ID == 0 {
+		form.Required("password")
+	}
+	if password != "" {
+		form.MinLength("password", minPasswordLength)
+	}
+
+	accessLevel, err := strconv.Atoi(r.Form.Get("access_level"))
+	if err != nil || models.AccessLevelName(accessLevel) == "" {
+		form.Errors.Add("access_level", "Invalid access level!")
+	} else if !helpers.HasAccess(r, accessLevel) {
+		form.Errors.Add("access_level", "You cannot grant a higher access level than your own!")
+	} else {
+		user.AccessLevel = accessLevel
+	}
+
+	if form.Valid() {
+		if user.ID == 0 {
+			user.ID, err = m.DB.InsertUser(r.Context(), user, password)
+		} else {
+			err = m.DB.UpdateUser(r.Context(), user)
+			if err == nil && password != "" {
+				err = m.DB.UpdatePassword(r.Context(), user.ID, password)
+			}
+		}
+
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			form.Errors.Add("email", "This email address is already in use!")
+		} else if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["user"] = user
+		data["access_levels"] = m.accessLevelOptions(r)
+
+		render.Template(w, r, "admin-users-show.page.html", &models.TemplateData{
+			Data: data,
+			Form: form,
+		})
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "User saved")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminActivateUser allows a deactivated user to log in again
+func (m *Repository) AdminActivateUser(w http.ResponseWriter, r *http.Request) {
+	m.setUserActive(w, r, true)
+}
+
+// AdminDeactivateUser stops a user from logging in without deleting the account
+func (m *Repository) AdminDeactivateUser(w http.ResponseWriter, r *http.Request) {
+	m.setUserActive(w, r, false)
+}
+
+func (m *Repository) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	user, ok := m.userForAction(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.DB.SetUserActive(r.Context(), user.ID, active)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if active {
+		m.App.Session.Put(r.Context(), "flash", "User activated")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "User deactivated")
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// AdminDeleteUser deletes a user
+func (m *Repository) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.userForAction(w, r)
+	if !ok {
+		return
+	}
+
+	err := m.DB.DeleteUser(r.Context(), user.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "User deleted")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// userForAction loads the user named in the URL and checks the current user may change it;
+// it writes the response and returns false when the action is not allowed
+func (m *Repository) userForAction(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return models.User{}, false
+	}
+
+	if id == m.App.Session.GetInt(r.Context(), "user_id") {
+		m.App.Session.Put(r.Context(), "error", "You cannot do that to your own account")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return models.User{}, false
+	}
+
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return models.User{}, false
+	}
+
+	if !helpers.HasAccess(r, user.AccessLevel) {
+		helpers.ClientError(w, http.StatusForbidden)
+		return models.User{}, false
+	}
+
+	return user, true
+}
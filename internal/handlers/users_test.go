@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/marif226/bookings/internal/models"
+)
+
+// adminRequest builds a request for a manager with id 99 logged in, with the given id URL parameter
+func adminRequest(method, target, id string, postedData url.Values) *http.Request {
+	var req *http.Request
+	if postedData != nil {
+		req, _ = http.NewRequest(method, target, strings.NewReader(postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req, _ = http.NewRequest(method, target, nil)
+	}
+
+	ctx := getCtx(req)
+	session.Put(ctx, "user_id", 99)
+	session.Put(ctx, "access_level", models.AccessManager)
+
+	chiCtx := chi.NewRouteContext()
+	if id != "" {
+		chiCtx.URLParams.Add("id", id)
+	}
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, chiCtx)
+
+	return req.WithContext(ctx)
+}
+
+func TestRepository_AdminUsers(t *testing.T) {
+	req := adminRequest("GET", "/admin/users", "", nil)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminUsers)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminUsers handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+}
+
+func TestRepository_AdminShowUser(t *testing.T) {
+	tests := []struct {
+		name				string
+		id					string
+		expectedStatusCode	int
+	}{
+		{"new user", "", http.StatusOK},
+		{"existing user", "1", http.StatusOK},
+		{"higher access level", "2", http.StatusForbidden},
+		{"invalid id", "x", http.StatusNotFound},
+		{"missing user", "1000", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("GET", "/admin/users/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminShowUser)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminPostShowUser(t *testing.T) {
+	valid := func(changes map[string]string) url.Values {
+		postedData := url.Values{}
+		postedData.Add("first_name", "Summer")
+		postedData.Add("last_name", "Staff")
+		postedData.Add("email", "summer@here.com")
+		postedData.Add("access_level", "2")
+		postedData.Add("password", "correct horse")
+		for k, v := range changes {
+			postedData.Set(k, v)
+		}
+		return postedData
+	}
+
+	tests := []struct {
+		name				string
+		id					string
+		postedData			url.Values
+		expectedStatusCode	int
+	}{
+		{"create user", "", valid(nil), http.StatusSeeOther},
+		{"create without password", "", valid(map[string]string{"password": ""}), http.StatusOK},
+		{"create with short password", "", valid(map[string]string{"password": "short"}), http.StatusOK},
+		{"create with taken email", "", valid(map[string]string{"email": "taken@here.com"}), http.StatusOK},
+		{"create with invalid email", "", valid(map[string]string{"email": "summer"}), http.StatusOK},
+		{"grant higher access level", "", valid(map[string]string{"access_level": "4"}), http.StatusOK},
+		{"unknown access level", "", valid(map[string]string{"access_level": "9"}), http.StatusOK},
+		{"update user", "1", valid(map[string]string{"password": ""}), http.StatusSeeOther},
+		{"update password", "1", valid(nil), http.StatusSeeOther},
+		{"update with taken email", "1", valid(map[string]string{"email": "taken@here.com"}), http.StatusOK},
+		{"update higher access level user", "2", valid(nil), http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/users/"+e.id, e.id, e.postedData)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostShowUser)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminUserActions(t *testing.T) {
+	tests := []struct {
+		name				string
+		handler				func(m *Repository, w http.ResponseWriter, r *http.Request)
+		id					string
+		expectedStatusCode	int
+	}{
+		{"activate", (*Repository).AdminActivateUser, "1", http.StatusSeeOther},
+		{"deactivate", (*Repository).AdminDeactivateUser, "1", http.StatusSeeOther},
+		{"deactivate self", (*Repository).AdminDeactivateUser, "99", http.StatusSeeOther},
+		{"deactivate higher access level", (*Repository).AdminDeactivateUser, "2", http.StatusForbidden},
+		{"deactivate missing user", (*Repository).AdminDeactivateUser, "1000", http.StatusInternalServerError},
+		{"delete", (*Repository).AdminDeleteUser, "1", http.StatusSeeOther},
+		{"delete invalid id", (*Repository).AdminDeleteUser, "x", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req := adminRequest("POST", "/admin/user-action/"+e.id, e.id, nil)
+		rr := httptest.NewRecorder()
+
+		e.handler(Repo, rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/marif226/bookings/internal/models"
+)
+
+// apiTokenPrefix makes API tokens easy to recognise, e.g. by secret scanners
+const apiTokenPrefix = "bk_"
+
+type contextKey string
+
+const apiTokenContextKey contextKey = "api_token"
+
+// NewAPIToken returns a new random API token, it is shown to the user once and only its hash is stored
+func NewAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashAPIToken returns the hash under which an API token is stored
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// BearerToken returns the token from an Authorization: Bearer header, and whether the header was present
+func BearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false
+	}
+
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", true
+	}
+
+	return strings.TrimSpace(token), true
+}
+
+// WithAPIToken returns a copy of ctx carrying the API token a request was authenticated with
+func WithAPIToken(ctx context.Context, t models.APIToken) context.Context {
+	return context.WithValue(ctx, apiTokenContextKey, t)
+}
+
+// APITokenFromContext returns the API token a request was authenticated with, if any
+func APITokenFromContext(ctx context.Context) (models.APIToken, bool) {
+	t, ok := ctx.Value(apiTokenContextKey).(models.APIToken)
+	return t, ok
+}
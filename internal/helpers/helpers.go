@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"runtime/debug"
@@ -26,7 +27,63 @@ func ServerError(w http.ResponseWriter, err error) {
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
+// jsonError is the envelope of every error returned by the JSON API
+type jsonError struct {
+	Error jsonErrorBody `json:"error"`
+}
+
+type jsonErrorBody struct {
+	Status	int					`json:"status"`
+	Message	string				`json:"message"`
+	Fields	map[string][]string	`json:"fields,omitempty"`
+}
+
+// WriteJSON writes data as a JSON response with the given status
+func WriteJSON(w http.ResponseWriter, status int, data interface{}) {
+	out, err := json.Marshal(data)
+	if err != nil {
+		ServerErrorJSON(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// ClientErrorJSON writes a JSON error envelope with the given status and message
+func ClientErrorJSON(w http.ResponseWriter, status int, message string) {
+	app.InfoLog.Println("Client error with status of ", status)
+	WriteJSON(w, status, jsonError{Error: jsonErrorBody{Status: status, Message: message}})
+}
+
+// ValidationErrorJSON writes a JSON error envelope listing the problems with each field
+func ValidationErrorJSON(w http.ResponseWriter, fields map[string][]string) {
+	status := http.StatusUnprocessableEntity
+	WriteJSON(w, status, jsonError{Error: jsonErrorBody{Status: status, Message: "Validation failed", Fields: fields}})
+}
+
+// ServerErrorJSON logs err and writes a JSON error envelope without exposing the error
+func ServerErrorJSON(w http.ResponseWriter, err error) {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	app.ErrorLog.Println(trace)
+
+	status := http.StatusInternalServerError
+	out, _ := json.Marshal(jsonError{Error: jsonErrorBody{Status: status, Message: http.StatusText(status)}})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
 func IsAuthenticated(r *http.Request) bool {
 	exists := app.Session.Exists(r.Context(), "user_id")
 	return exists
+}
+
+// HasAccess reports whether the logged in user has at least the given access level
+func HasAccess(r *http.Request, level int) bool {
+	if !IsAuthenticated(r) {
+		return false
+	}
+	return app.Session.GetInt(r.Context(), "access_level") >= level
 }
\ No newline at end of file
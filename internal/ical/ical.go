@@ -0,0 +1,168 @@
+// Package ical writes iCalendar (RFC 5545) calendars of all-day events, such as stays
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// prodID identifies the program that wrote a calendar
+const prodID = "-//Bookings and Reservations//Bookings//EN"
+
+// maxLineLength is the length in octets after which content lines are folded
+const maxLineLength = 75
+
+// Methods of a calendar sent by email (RFC 5546), Publish for a calendar that is only subscribed to
+const (
+	MethodPublish	= "PUBLISH"
+	MethodRequest	= "REQUEST"
+	MethodCancel	= "CANCEL"
+)
+
+// Statuses of an event
+const (
+	StatusConfirmed	= "CONFIRMED"
+	StatusTentative	= "TENTATIVE"
+	StatusCancelled	= "CANCELLED"
+)
+
+// Event is an all-day event from Start up to, but not including, End
+type Event struct {
+	// UID identifies the event across updates, so it must stay the same for the same stay
+	UID				string
+	// Sequence must grow with every update of the event
+	Sequence		int
+	Status			string
+	Start			time.Time
+	End				time.Time
+	Summary			string
+	Description		string
+	Location		string
+	URL				string
+	// Organizer and Attendee are bare email addresses, left out when empty
+	Organizer		string
+	// OrganizerName is the display name of Organizer, left out when empty
+	OrganizerName	string
+	Attendee		string
+	// Stamp is when the event was written, now when zero
+	Stamp			time.Time
+}
+
+// Calendar is an iCalendar object, Method is left out when empty
+type Calendar struct {
+	Name	string
+	Method	string
+	Events	[]Event
+}
+
+// ContentType returns the MIME type of the calendar
+func (c Calendar) ContentType() string {
+	if c.Method == "" {
+		return "text/calendar; charset=utf-8"
+	}
+	return fmt.Sprintf("text/calendar; charset=utf-8; method=%s", c.Method)
+}
+
+// Bytes returns the calendar in iCalendar format
+func (c Calendar) Bytes() []byte {
+	var w writer
+
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", prodID)
+	w.line("CALSCALE", "GREGORIAN")
+	if c.Method != "" {
+		w.line("METHOD", c.Method)
+	}
+	if c.Name != "" {
+		w.line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	for _, e := range c.Events {
+		stamp := e.Stamp
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", e.UID)
+		w.line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		w.line("SEQUENCE", fmt.Sprint(e.Sequence))
+		if e.Status != "" {
+			w.line("STATUS", e.Status)
+		}
+		w.line("DTSTART;VALUE=DATE", e.Start.Format("20060102"))
+		w.line("DTEND;VALUE=DATE", e.End.Format("20060102"))
+		w.line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			w.line("LOCATION", escape(e.Location))
+		}
+		if e.URL != "" {
+			w.line("URL", e.URL)
+		}
+		if e.Organizer != "" && e.OrganizerName != "" {
+			w.line(fmt.Sprintf("ORGANIZER;CN=%s", quoteParam(e.OrganizerName)), "mailto:"+e.Organizer)
+		} else if e.Organizer != "" {
+			w.line("ORGANIZER", "mailto:"+e.Organizer)
+		}
+		if e.Attendee != "" {
+			w.line("ATTENDEE;ROLE=REQ-PARTICIPANT", "mailto:"+e.Attendee)
+		}
+		// the stay blocks the days in the calendar of the guest
+		w.line("TRANSP", "OPAQUE")
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+
+	return w.buf.Bytes()
+}
+
+// escape escapes the characters with a meaning in TEXT values
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// quoteParam quotes a parameter value, dropping the double quotes and control characters it cannot hold
+func quoteParam(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '"' || r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	return `"` + s + `"`
+}
+
+// writer writes content lines, folding the long ones
+type writer struct {
+	buf	bytes.Buffer
+}
+
+// line writes name:value, folded into lines of at most maxLineLength octets without splitting a character
+func (w *writer) line(name, value string) {
+	s := name + ":" + value
+
+	limit := maxLineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+
+		w.buf.WriteString(s[:cut])
+		w.buf.WriteString("\r\n ")
+		s = s[cut:]
+		// continuation lines start with a space, which counts towards their length
+		limit = maxLineLength - 1
+	}
+
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
@@ -0,0 +1,95 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar_Bytes(t *testing.T) {
+	c := Calendar{
+		Method: MethodRequest,
+		Events: []Event{
+			{
+				UID: "reservation-1@localhost",
+				Sequence: 2,
+				Status: StatusConfirmed,
+				Start: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+				End: time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
+				Summary: "Stay in General's Quarters; room 1, 2 adults",
+				Description: "Reservation 1\nSee you soon",
+				Organizer: "me@here.com",
+				Attendee: "john@smith.com",
+				Stamp: time.Date(2049, 12, 1, 10, 30, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	out := string(c.Bytes())
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"METHOD:REQUEST\r\n",
+		"UID:reservation-1@localhost\r\n",
+		"DTSTAMP:20491201T103000Z\r\n",
+		"SEQUENCE:2\r\n",
+		"STATUS:CONFIRMED\r\n",
+		"DTSTART;VALUE=DATE:20500101\r\n",
+		"DTEND;VALUE=DATE:20500104\r\n",
+		`SUMMARY:Stay in General's Quarters\; room 1\, 2 adults` + "\r\n",
+		`DESCRIPTION:Reservation 1\nSee you soon` + "\r\n",
+		"ORGANIZER:mailto:me@here.com\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected calendar to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, "LOCATION") {
+		t.Error("expected an empty location to be left out")
+	}
+
+	if c.ContentType() != "text/calendar; charset=utf-8; method=REQUEST" {
+		t.Errorf("unexpected content type %s", c.ContentType())
+	}
+}
+
+func TestCalendar_OrganizerName(t *testing.T) {
+	c := Calendar{Events: []Event{{UID: "reservation-1@localhost", Organizer: "bookings@here.com", OrganizerName: `Fort "Smythe"; Bookings`}}}
+
+	out := string(c.Bytes())
+
+	want := `ORGANIZER;CN="Fort Smythe; Bookings":mailto:bookings@here.com` + "\r\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("expected calendar to contain %q, got:\n%s", want, out)
+	}
+}
+
+func TestWriter_Folding(t *testing.T) {
+	var w writer
+	w.line("DESCRIPTION", strings.Repeat("é", 100))
+
+	lines := strings.Split(strings.TrimSuffix(w.buf.String(), "\r\n"), "\r\n")
+	if len(lines) < 3 {
+		t.Fatalf("expected the line to be folded, got %q", lines)
+	}
+
+	var unfolded strings.Builder
+	for i, l := range lines {
+		if len(l) > maxLineLength {
+			t.Errorf("line %d is %d octets long", i, len(l))
+		}
+		if i > 0 {
+			if !strings.HasPrefix(l, " ") {
+				t.Errorf("continuation line %d does not start with a space", i)
+			}
+			l = l[1:]
+		}
+		unfolded.WriteString(l)
+	}
+
+	if unfolded.String() != "DESCRIPTION:"+strings.Repeat("é", 100) {
+		t.Error("unfolding did not give back the original line, a character was split")
+	}
+}
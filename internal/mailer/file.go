@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// fileMailer saves emails as .eml files instead of sending them, so they can be opened in a mail client
+type fileMailer struct {
+	dir		string
+	count	uint64
+}
+
+// NewFile returns a Mailer saving emails in dir, which is created if needed
+func NewFile(dir string) (Mailer, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create mail directory: %w", err)
+	}
+
+	return &fileMailer{dir: dir}, nil
+}
+
+// Send writes msg to a new file, named so that files sort in the order they were written
+func (f *fileMailer) Send(msg Message) error {
+	email := compose(msg)
+	if email.Error != nil {
+		return email.Error
+	}
+
+	name := fmt.Sprintf("%s-%06d.eml", time.Now().Format("20060102-150405"), atomic.AddUint64(&f.count, 1))
+
+	return ioutil.WriteFile(filepath.Join(f.dir, name), []byte(email.GetMessage()), 0600)
+}
+
+// Close does nothing, as no file is kept open
+func (f *fileMailer) Close() error {
+	return nil
+}
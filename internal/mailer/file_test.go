@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marif226/bookings/internal/models"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+
+	m, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, subject := range []string{"First", "Second"} {
+		err = m.Send(Message{To: "john@smith.com", From: "me@here.com", Subject: subject, HTML: "<p>Dear John</p>"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected two files, got %d, %v", len(files), err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatalf("cannot parse saved email: %s", err)
+	}
+
+	if msg.Header.Get("Subject") != "First" || !strings.Contains(msg.Header.Get("To"), "john@smith.com") {
+		t.Errorf("unexpected headers %v", msg.Header)
+	}
+
+	body, _ := ioutil.ReadAll(msg.Body)
+	if !strings.Contains(string(body), "Dear John") {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	err = m.Send(Message{To: "john@smith.com", From: "me@here.com", Subject: "Both", HTML: "<p>Dear John</p>", Text: "Dear John",
+		Attachments: []models.Attachment{{Name: "reservation.ics", ContentType: "text/calendar; method=REQUEST", Data: []byte("BEGIN:VCALENDAR")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ = ioutil.ReadDir(dir)
+	data, err := ioutil.ReadFile(filepath.Join(dir, files[2].Name()))
+	if err != nil || !strings.Contains(string(data), "multipart/alternative") || !strings.Contains(string(data), "text/plain") {
+		t.Errorf("expected a plain text alternative, got:\n%s", data)
+	}
+
+	if !strings.Contains(string(data), "multipart/mixed") || !strings.Contains(string(data), `filename="reservation.ics"`) {
+		t.Errorf("expected the calendar to be attached, got:\n%s", data)
+	}
+
+	err = m.Send(Message{To: "not an address", From: "me@here.com"})
+	if err == nil {
+		t.Error("expected an error for an invalid recipient")
+	}
+}
@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"log"
+)
+
+// logMailer only logs the emails it is given
+type logMailer struct {
+	infoLog	*log.Logger
+}
+
+// NewLog returns a Mailer that logs the recipient and subject of every email and sends nothing
+func NewLog(infoLog *log.Logger) Mailer {
+	return &logMailer{infoLog: infoLog}
+}
+
+// Send logs msg
+func (l *logMailer) Send(msg Message) error {
+	l.infoLog.Printf("Email to %s not sent, mail transport is log: %s", msg.To, msg.Subject)
+	return nil
+}
+
+// Close does nothing
+func (l *logMailer) Close() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+// Package mailer delivers emails through the transport chosen in the configuration: an SMTP
+// relay, a directory of .eml files or the log
+package mailer
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/marif226/bookings/internal/config"
+	"github.com/marif226/bookings/internal/models"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// Message is an email ready to be delivered
+type Message struct {
+	From	string
+	To		string
+	Subject	string
+	HTML	string
+	// Text is the plain text alternative of HTML, left out when empty
+	Text		string
+	Attachments	[]models.Attachment
+}
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(msg Message) error
+	// Close releases any connection kept open between emails
+	Close() error
+}
+
+// New returns the Mailer for the transport in cfg
+func New(cfg config.MailConfig, infoLog *log.Logger) (Mailer, error) {
+	switch cfg.Transport {
+	case config.MailTransportSMTP:
+		return NewSMTP(cfg), nil
+	case config.MailTransportFile:
+		return NewFile(cfg.Dir)
+	case config.MailTransportLog:
+		return NewLog(infoLog), nil
+	}
+
+	return nil, fmt.Errorf("unknown mail transport %q", cfg.Transport)
+}
+
+// compose builds the email sent for msg
+func compose(msg Message) *mail.Email {
+	email := mail.NewMSG()
+	email.SetFrom(msg.From).AddTo(msg.To).SetSubject(msg.Subject)
+	if msg.Text == "" {
+		email.SetBody(mail.TextHTML, msg.HTML)
+	} else {
+		email.SetBody(mail.TextPlain, msg.Text)
+		email.AddAlternative(mail.TextHTML, msg.HTML)
+	}
+
+	for _, a := range msg.Attachments {
+		email.Attach(&mail.File{Name: a.Name, MimeType: a.ContentType, Data: a.Data})
+	}
+
+	return email
+}
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/marif226/bookings/internal/config"
+)
+
+func TestNew(t *testing.T) {
+	infoLog := log.New(ioutil.Discard, "", 0)
+	dir := filepath.Join(t.TempDir(), "mail")
+
+	tests := []struct {
+		transport		string
+		expectedType	string
+	}{
+		{config.MailTransportSMTP, "*mailer.smtpMailer"},
+		{config.MailTransportFile, "*mailer.fileMailer"},
+		{config.MailTransportLog, "*mailer.logMailer"},
+	}
+
+	for _, e := range tests {
+		m, err := New(config.MailConfig{Transport: e.transport, Dir: dir}, infoLog)
+		if err != nil {
+			t.Errorf("%s: %s", e.transport, err)
+			continue
+		}
+
+		if got := fmt.Sprintf("%T", m); got != e.expectedType {
+			t.Errorf("%s: expected %s, got %s", e.transport, e.expectedType, got)
+		}
+	}
+
+	_, err := New(config.MailConfig{Transport: "pigeon"}, infoLog)
+	if err == nil {
+		t.Error("expected an error for an unknown transport")
+	}
+}
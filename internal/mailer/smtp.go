@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/marif226/bookings/internal/config"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// maxIdleConnections is how many connections to the relay are kept open between emails
+const maxIdleConnections = 4
+
+// smtpMailer sends emails through an SMTP relay, reusing connections between emails
+type smtpMailer struct {
+	server	*mail.SMTPServer
+	mu		sync.Mutex
+	idle	[]*mail.SMTPClient
+}
+
+// NewSMTP returns a Mailer sending through the relay in cfg
+func NewSMTP(cfg config.MailConfig) Mailer {
+	server := mail.NewSMTPClient()
+	server.Host = cfg.Host
+	server.Port = cfg.Port
+	server.Username = cfg.Username
+	server.Password = cfg.Password
+	server.KeepAlive = true
+	server.ConnectTimeout = 10 * time.Second
+	server.SendTimeout = 10 * time.Second
+
+	switch cfg.Encryption {
+	case config.MailEncryptionSTARTTLS:
+		server.Encryption = mail.EncryptionSTARTTLS
+	case config.MailEncryptionTLS:
+		server.Encryption = mail.EncryptionSSLTLS
+	default:
+		server.Encryption = mail.EncryptionNone
+	}
+
+	return &smtpMailer{server: server}
+}
+
+// Send delivers msg over an idle connection, or a new one when there is none
+func (s *smtpMailer) Send(msg Message) error {
+	email := compose(msg)
+	if email.Error != nil {
+		return email.Error
+	}
+
+	client, err := s.connection()
+	if err != nil {
+		return err
+	}
+
+	err = email.Send(client)
+	if err != nil {
+		// the state of the session is unknown, so the connection is not used again
+		client.Close()
+		return err
+	}
+
+	s.release(client)
+
+	return nil
+}
+
+// Close ends every idle connection
+func (s *smtpMailer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, client := range s.idle {
+		client.Quit()
+		client.Close()
+	}
+	s.idle = nil
+
+	return nil
+}
+
+// connection returns an idle connection that still works, or a new one
+func (s *smtpMailer) connection() (*mail.SMTPClient, error) {
+	for {
+		s.mu.Lock()
+		if len(s.idle) == 0 {
+			s.mu.Unlock()
+			return s.server.Connect()
+		}
+		client := s.idle[len(s.idle)-1]
+		s.idle = s.idle[:len(s.idle)-1]
+		s.mu.Unlock()
+
+		// the relay may have dropped a connection that was idle for too long
+		if client.Noop() == nil {
+			return client, nil
+		}
+		client.Close()
+	}
+}
+
+// release keeps client open for the next email, unless enough connections are idle already
+func (s *smtpMailer) release(client *mail.SMTPClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.idle) < maxIdleConnections {
+		s.idle = append(s.idle, client)
+		return
+	}
+
+	client.Quit()
+	client.Close()
+}
@@ -0,0 +1,169 @@
+package mailer
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/marif226/bookings/internal/config"
+)
+
+// fakeRelay is an SMTP server that accepts every email and counts connections and emails
+type fakeRelay struct {
+	listener	net.Listener
+	mu			sync.Mutex
+	connections	int
+	emails		[]string
+	// hangUp closes every connection after one email, like a relay with a short idle timeout
+	hangUp		bool
+}
+
+func newFakeRelay(t *testing.T) *fakeRelay {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &fakeRelay{listener: l}
+	go r.serve()
+	t.Cleanup(func() { l.Close() })
+
+	return r
+}
+
+func (r *fakeRelay) config() config.MailConfig {
+	addr := r.listener.Addr().(*net.TCPAddr)
+	return config.MailConfig{Host: addr.IP.String(), Port: addr.Port, Encryption: config.MailEncryptionNone}
+}
+
+func (r *fakeRelay) serve() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		r.mu.Lock()
+		r.connections++
+		r.mu.Unlock()
+
+		go r.handle(conn)
+	}
+}
+
+func (r *fakeRelay) handle(conn net.Conn) {
+	defer conn.Close()
+
+	in := bufio.NewReader(conn)
+	reply := func(s string) {
+		conn.Write([]byte(s + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := in.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+
+			r.mu.Lock()
+			r.emails = append(r.emails, data.String())
+			n := len(r.emails)
+			r.mu.Unlock()
+
+			reply("250 queued as " + strconv.Itoa(n))
+			if r.hangUp {
+				return
+			}
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (r *fakeRelay) counts() (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.connections, len(r.emails)
+}
+
+func TestSMTPMailer_ReusesConnection(t *testing.T) {
+	relay := newFakeRelay(t)
+	m := NewSMTP(relay.config())
+
+	for i := 0; i < 3; i++ {
+		err := m.Send(Message{To: "john@smith.com", From: "me@here.com", Subject: "Hello", HTML: "<p>Hi</p>"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	connections, emails := relay.counts()
+	if connections != 1 || emails != 3 {
+		t.Errorf("expected 3 emails over 1 connection, got %d over %d", emails, connections)
+	}
+
+	relay.mu.Lock()
+	if !strings.Contains(relay.emails[0], "Subject: Hello") {
+		t.Errorf("unexpected email:\n%s", relay.emails[0])
+	}
+	relay.mu.Unlock()
+
+	err := m.Close()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSMTPMailer_ReconnectsAfterHangUp(t *testing.T) {
+	relay := newFakeRelay(t)
+	relay.hangUp = true
+	m := NewSMTP(relay.config())
+	defer m.Close()
+
+	for i := 0; i < 2; i++ {
+		err := m.Send(Message{To: "john@smith.com", From: "me@here.com", Subject: "Hello"})
+		if err != nil {
+			t.Fatalf("email %d: %s", i+1, err)
+		}
+	}
+
+	connections, emails := relay.counts()
+	if connections != 2 || emails != 2 {
+		t.Errorf("expected 2 emails over 2 connections, got %d over %d", emails, connections)
+	}
+}
+
+func TestSMTPMailer_Unreachable(t *testing.T) {
+	relay := newFakeRelay(t)
+	cfg := relay.config()
+	relay.listener.Close()
+
+	err := NewSMTP(cfg).Send(Message{To: "john@smith.com", From: "me@here.com", Subject: "Hello"})
+	if err == nil {
+		t.Error("expected an error when the relay is down")
+	}
+}
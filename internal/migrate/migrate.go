@@ -0,0 +1,346 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// versionLayout is the timestamp format used for migration versions
+const versionLayout = "20060102150405"
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrNoMigrations is returned by Down when there is nothing to roll back
+var ErrNoMigrations = errors.New("no migrations have been applied")
+
+// Migration is one schema change, with the SQL to apply and to roll it back
+type Migration struct {
+	Version	int64
+	Name	string
+	Up		string
+	Down	string
+}
+
+// Status reports whether a migration has been applied to the database
+type Status struct {
+	Migration
+	Applied		bool
+	AppliedAt	time.Time
+}
+
+// Migrator applies migrations to a database and records them in the schema_migrations table
+type Migrator struct {
+	DB			*sql.DB
+	Migrations	[]Migration
+}
+
+// New creates a migrator for db
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{
+		DB: db,
+		Migrations: migrations,
+	}
+}
+
+// Load reads the migrations in dir of fsys, named <version>_<name>.up.sql and <version>_<name>.down.sql,
+// and returns them ordered by version
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	hasUp := make(map[int64]bool)
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected file %s in %s, migrations are named <version>_<name>.up.sql or .down.sql", entry.Name(), dir)
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version in %s: %w", entry.Name(), err)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("version %d is used by both %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+			hasUp[version] = true
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var migrations []Migration
+	for version, m := range byVersion {
+		if !hasUp[version] {
+			return nil, fmt.Errorf("migration %d_%s has no up file", version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Create writes empty up and down files for a new migration to dir and returns their paths
+func Create(dir, name string, now time.Time) (string, string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return "", "", fmt.Errorf("migration name %q may only contain letters, digits and underscores", name)
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%s_%s", now.UTC().Format(versionLayout), name))
+	up := base + ".up.sql"
+	down := base + ".down.sql"
+
+	for _, file := range []string{up, down} {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return "", "", err
+		}
+		f.Close()
+	}
+
+	return up, down, nil
+}
+
+// Up applies all pending migrations, each in its own transaction, and returns the ones it applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err = m.exec(ctx, migration.Up, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2);`, migration.Version, time.Now())
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down rolls back the given number of most recently applied migrations and returns the ones it rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := statuses[i].Migration
+		if !statuses[i].Applied {
+			continue
+		}
+
+		err = m.exec(ctx, migration.Down, `DELETE FROM schema_migrations WHERE version = $1;`, migration.Version)
+		if err != nil {
+			return done, fmt.Errorf("rolling back %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	if len(done) == 0 {
+		return nil, ErrNoMigrations
+	}
+
+	return done, nil
+}
+
+// Status returns every known migration with whether and when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range m.Migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, Status{
+			Migration: migration,
+			Applied: ok,
+			AppliedAt: appliedAt,
+		})
+	}
+
+	return statuses, nil
+}
+
+// applied creates the schema_migrations table if needed and returns the applied versions
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	_, err := m.DB.ExecContext(ctx, `SELECT version FROM schema_migrations LIMIT 1;`)
+	if err != nil {
+		err = m.create(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations;`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		err := rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// create creates the schema_migrations table. A database migrated by soda before has its known versions
+// in the schema_migration table, they are copied over in the same transaction so that they are not
+// applied a second time
+func (m *Migrator) create(ctx context.Context) error {
+	versions, err := m.sodaVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot adopt the migrations applied by soda: %w", err)
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `CREATE TABLE schema_migrations (
+		version BIGINT PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	);`)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, version := range versions {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2);`, version, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// sodaVersions returns the known versions recorded in the schema_migration table of soda, if there is one
+func (m *Migrator) sodaVersions(ctx context.Context) ([]int64, error) {
+	rows, err := m.DB.QueryContext(ctx, `SELECT version FROM schema_migration;`)
+	if err != nil {
+		// soda never migrated this database
+		return nil, nil
+	}
+
+	defer rows.Close()
+
+	known := make(map[int64]bool)
+	for _, migration := range m.Migrations {
+		known[migration.Version] = true
+	}
+
+	var versions []int64
+	for rows.Next() {
+		var version string
+		err := rows.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := strconv.ParseInt(strings.TrimSpace(version), 10, 64)
+		if err == nil && known[v] {
+			versions = append(versions, v)
+		}
+	}
+
+	return versions, rows.Err()
+}
+
+// exec runs the statements of a migration and the bookkeeping query in one transaction
+func (m *Migrator) exec(ctx context.Context, statements, bookkeeping string, args ...interface{}) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !isEmpty(statements) {
+		_, err = tx.ExecContext(ctx, statements)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, bookkeeping, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// isEmpty reports whether sql holds nothing but whitespace and -- comments
+func isEmpty(sql string) bool {
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
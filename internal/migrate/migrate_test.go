@@ -0,0 +1,254 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/marif226/bookings/internal/driver"
+	"github.com/marif226/bookings/migrations"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/20220102000000_second.up.sql":		{Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"sql/20220102000000_second.down.sql":	{Data: []byte("DROP TABLE b;")},
+		"sql/20220101000000_first.up.sql":		{Data: []byte("CREATE TABLE a (id INTEGER);")},
+	}
+
+	list, err := Load(fsys, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("expected 2 migrations, got %d", len(list))
+	}
+
+	if list[0].Name != "first" || list[1].Name != "second" {
+		t.Errorf("migrations are not ordered by version: %s, %s", list[0].Name, list[1].Name)
+	}
+
+	if list[0].Down != "" || list[1].Down != "DROP TABLE b;" {
+		t.Errorf("unexpected down migrations %q, %q", list[0].Down, list[1].Down)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name	string
+		fsys	fstest.MapFS
+	}{
+		{"stray file", fstest.MapFS{"sql/notes.txt": {}}},
+		{"missing up", fstest.MapFS{"sql/20220101000000_first.down.sql": {}}},
+		{"duplicate version", fstest.MapFS{
+			"sql/20220101000000_first.up.sql": {},
+			"sql/20220101000000_other.up.sql": {},
+		}},
+	}
+
+	for _, e := range tests {
+		_, err := Load(e.fsys, "sql")
+		if err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestLoad_Embedded(t *testing.T) {
+	versions := make(map[string][]int64)
+
+	for _, dir := range []string{"postgres", "sqlite"} {
+		list, err := Load(migrations.FS, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, m := range list {
+			versions[dir] = append(versions[dir], m.Version)
+
+			// sqlite declares foreign keys with their tables, so some of its migrations are comments only
+			if dir == "postgres" && isEmpty(m.Up) {
+				t.Errorf("migration %d_%s has no up statements", m.Version, m.Name)
+			}
+		}
+
+		if last := list[len(list)-1]; last.Version < 20221025101500 {
+			t.Errorf("%s: expected the api tokens migration to be embedded, last is %d_%s", dir, last.Version, last.Name)
+		}
+	}
+
+	if fmt.Sprint(versions["postgres"]) != fmt.Sprint(versions["sqlite"]) {
+		t.Errorf("postgres and sqlite migrations differ:\n%v\n%v", versions["postgres"], versions["sqlite"])
+	}
+}
+
+func TestMigrator_SQLite(t *testing.T) {
+	list, err := Load(migrations.FS, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	ctx := context.Background()
+	m := New(db.SQL, list)
+
+	done, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(list) {
+		t.Errorf("expected %d migrations to be applied, got %d", len(list), len(done))
+	}
+
+	var rooms int
+	err = db.SQL.QueryRow(`SELECT COUNT(id) FROM rooms;`).Scan(&rooms)
+	if err != nil || rooms != 2 {
+		t.Errorf("expected 2 seeded rooms, got %d, %v", rooms, err)
+	}
+
+	done, err = m.Up(ctx)
+	if err != nil || len(done) != 0 {
+		t.Errorf("expected nothing to apply twice, got %d, %v", len(done), err)
+	}
+
+	done, err = m.Down(ctx, len(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(list) {
+		t.Errorf("expected %d migrations to be rolled back, got %d", len(list), len(done))
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if s.Applied {
+			t.Errorf("%d_%s should have been rolled back", s.Version, s.Name)
+		}
+	}
+
+	_, err = m.Down(ctx, 1)
+	if err != ErrNoMigrations {
+		t.Errorf("expected ErrNoMigrations, got %v", err)
+	}
+}
+
+func TestMigrator_AdoptsSoda(t *testing.T) {
+	list, err := Load(migrations.FS, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	// soda applied the first three migrations and recorded them, together with one no longer known
+	_, err = db.SQL.Exec(`CREATE TABLE schema_migration (version VARCHAR(14) NOT NULL);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range list[:3] {
+		_, err = db.SQL.Exec(migration.Up)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.SQL.Exec(`INSERT INTO schema_migration (version) VALUES ($1);`, fmt.Sprint(migration.Version))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = db.SQL.Exec(`INSERT INTO schema_migration (version) VALUES ('20010101000000');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	m := New(db.SQL, list)
+
+	done, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(list)-3 || done[0].Version != list[3].Version {
+		t.Errorf("expected the migrations after the third to be applied, got %d", len(done))
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != len(list) || !statuses[0].Applied {
+		t.Errorf("expected the migrations of soda to be applied, got %+v", statuses[0])
+	}
+
+	// once every migration is rolled back, the versions of soda are not adopted again
+	_, err = m.Down(ctx, len(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err = m.Status(ctx)
+	if err != nil || statuses[0].Applied {
+		t.Errorf("expected soda to be adopted only when schema_migrations is created, got %v", err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2022, 10, 26, 9, 30, 0, 0, time.UTC)
+
+	up, down, err := Create(dir, "Add room photos", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(up) != "20221026093000_add_room_photos.up.sql" {
+		t.Errorf("unexpected up file %s", up)
+	}
+
+	if !strings.HasSuffix(down, ".down.sql") {
+		t.Errorf("unexpected down file %s", down)
+	}
+
+	if _, err := os.Stat(down); err != nil {
+		t.Error(err)
+	}
+
+	_, _, err = Create(dir, "Add room photos", now)
+	if err == nil {
+		t.Error("expected an error when the migration already exists")
+	}
+
+	_, _, err = Create(dir, "drop-rooms;", now)
+	if err == nil {
+		t.Error("expected an error for an invalid name")
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	if !isEmpty("\n-- nothing to do\n  \n") {
+		t.Error("comments only should be empty")
+	}
+
+	if isEmpty("-- drop\nDROP TABLE a;") {
+		t.Error("statements should not be empty")
+	}
+}
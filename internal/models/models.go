@@ -1,9 +1,40 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
+// Access levels stored in users.access_level, each level includes the ones below it
+const (
+	AccessGuest		= 1
+	AccessStaff		= 2
+	AccessManager	= 3
+	AccessOwner		= 4
+)
+
+var accessLevelNames = map[int]string{
+	AccessGuest: "guest",
+	AccessStaff: "staff",
+	AccessManager: "manager",
+	AccessOwner: "owner",
+}
+
+// AccessLevelName returns the role name for an access level
+func AccessLevelName(level int) string {
+	return accessLevelNames[level]
+}
+
+// AccessLevelByName returns the access level for a role name
+func AccessLevelByName(name string) (int, bool) {
+	for level, n := range accessLevelNames {
+		if n == name {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
 // User is the is user model
 type User struct {
 	ID			int
@@ -12,19 +43,177 @@ type User struct {
 	Email		string
 	Password	string
 	AccessLevel	int
+	Active		bool
+	CreatedAt	time.Time
+	UpdatedAt	time.Time
+}
+
+// Scopes that can be granted to an API token
+const (
+	ScopeReservationsRead	= "reservations:read"
+)
+
+// APIScopes lists every scope an API token can be granted
+var APIScopes = []string{ScopeReservationsRead}
+
+// APIToken is the API token model, only a hash of the token itself is stored
+type APIToken struct {
+	ID			int
+	UserID		int
+	Name		string
+	TokenHash	string
+	Scopes		[]string
+	LastUsedAt	time.Time
+	RevokedAt	time.Time
 	CreatedAt	time.Time
 	UpdatedAt	time.Time
+	User		User
+}
+
+// HasScope reports whether the token has been granted scope
+func (t APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoked reports whether the token has been revoked
+func (t APIToken) Revoked() bool {
+	return !t.RevokedAt.IsZero()
 }
 
 // Room is the room model
 type Room struct {
+	ID					int
+	RoomName			string
+	Slug				string
+	Description			string
+	MaxOccupancy		int
+	BedConfiguration	string
+	Amenities			[]string
+	Photos				[]RoomPhoto
+	CreatedAt			time.Time
+	UpdatedAt			time.Time
+}
+
+// RoomPhoto is one photo of a room's gallery, the gallery is ordered by Position
+type RoomPhoto struct {
 	ID			int
-	RoomName	string
+	RoomID		int
+	URL			string
+	Caption		string
+	Position	int
 	CreatedAt	time.Time
 	UpdatedAt	time.Time
 }
 
-// Restriction is the room model
+// RatePlan is the pricing of a room, all amounts are in cents of Currency
+type RatePlan struct {
+	ID				int
+	RoomID			int
+	Currency		string
+	NightlyRate		int
+	WeekendRate		int // for Friday and Saturday nights, 0 means NightlyRate
+	IncludedGuests	int
+	ExtraGuestRate	int // per night for every guest above IncludedGuests
+	Seasons			[]RateSeason
+	CreatedAt		time.Time
+	UpdatedAt		time.Time
+}
+
+// RateSeason overrides the rates of a plan for the nights from StartDate through EndDate
+type RateSeason struct {
+	ID				int
+	RatePlanID		int
+	Name			string
+	StartDate		time.Time
+	EndDate			time.Time
+	NightlyRate		int
+	WeekendRate		int // 0 means NightlyRate
+	CreatedAt		time.Time
+	UpdatedAt		time.Time
+}
+
+// Quote is the itemised price of a stay, amounts are in cents of Currency
+type Quote struct {
+	Currency	string
+	Lines		[]QuoteLine
+	Total		int
+}
+
+// QuoteLine is one item of a quote, Date is zero for items that are not about a single night
+type QuoteLine struct {
+	Date		time.Time
+	Description	string
+	Amount		int
+}
+
+// IsZero reports whether q holds no price, e.g. for a room without a rate plan
+func (q Quote) IsZero() bool {
+	return q.Currency == "" && len(q.Lines) == 0
+}
+
+// StayRule limits the stays that can be booked in a room. A rule with a StartDate and EndDate
+// only applies around those dates, a rule without them all year
+type StayRule struct {
+	ID					int
+	RoomID				int
+	Name				string
+	StartDate			time.Time
+	EndDate				time.Time
+	MinNights			int // 0 means no minimum
+	MaxNights			int // 0 means no maximum
+	ClosedToArrival		Weekdays
+	ClosedToDeparture	Weekdays
+	LeadDays			int // days between booking and arrival
+	CreatedAt			time.Time
+	UpdatedAt			time.Time
+}
+
+// HasDates reports whether the rule is limited to a range of dates
+func (r StayRule) HasDates() bool {
+	return !r.StartDate.IsZero() && !r.EndDate.IsZero()
+}
+
+// Covers reports whether d falls within the dates of the rule, which is always the case without dates
+func (r StayRule) Covers(d time.Time) bool {
+	return !r.HasDates() || (!d.Before(r.StartDate) && !d.After(r.EndDate))
+}
+
+// Weekdays is a set of days of the week, bit n is set for time.Weekday n
+type Weekdays int
+
+// Has reports whether d is in the set
+func (w Weekdays) Has(d time.Weekday) bool {
+	return w&(1<<uint(d)) != 0
+}
+
+// With returns the set with d added
+func (w Weekdays) With(d time.Weekday) Weekdays {
+	return w | 1<<uint(d)
+}
+
+// Days returns the days in the set starting with Sunday
+func (w Weekdays) Days() []time.Weekday {
+	var days []time.Weekday
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if w.Has(d) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// Restriction IDs seeded into the restrictions table
+const (
+	RestrictionReservation	= 1
+	RestrictionOwnerBlock	= 2
+)
+
+// Restriction is the restriction model
 type Restriction struct {
 	ID				int
 	RestrictionName	string
@@ -42,10 +231,83 @@ type Reservation struct {
 	StartDate		time.Time
 	EndDate			time.Time
 	RoomID			int
+	Adults			int
+	Children		int
 	CreatedAt		time.Time
 	UpdatedAt		time.Time
 	Room			Room
-	Processed		int
+	Status			ReservationStatus
+	StatusChanges	[]StatusChange
+	Quote			Quote
+}
+
+// Guests returns the size of the party staying
+func (r Reservation) Guests() int {
+	return r.Adults + r.Children
+}
+
+// ReservationStatus is the stage a reservation has reached, from booking to departure
+type ReservationStatus string
+
+// Statuses of reservations, new reservations are pending
+const (
+	StatusPending		ReservationStatus = "pending"
+	StatusConfirmed		ReservationStatus = "confirmed"
+	StatusCheckedIn		ReservationStatus = "checked-in"
+	StatusCheckedOut	ReservationStatus = "checked-out"
+	StatusCancelled		ReservationStatus = "cancelled"
+	StatusNoShow		ReservationStatus = "no-show"
+)
+
+// ReservationStatuses lists every status in the order a reservation moves through them
+var ReservationStatuses = []ReservationStatus{
+	StatusPending, StatusConfirmed, StatusCheckedIn, StatusCheckedOut, StatusCancelled, StatusNoShow,
+}
+
+// statusTransitions holds the statuses each status may move to; the others are final
+var statusTransitions = map[ReservationStatus][]ReservationStatus{
+	StatusPending: {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusCheckedIn, StatusCancelled, StatusNoShow},
+	StatusCheckedIn: {StatusCheckedOut},
+}
+
+// Valid reports whether s is one of ReservationStatuses
+func (s ReservationStatus) Valid() bool {
+	for _, status := range ReservationStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the statuses a reservation in status s may move to
+func (s ReservationStatus) Next() []ReservationStatus {
+	return statusTransitions[s]
+}
+
+// CanBecome reports whether a reservation in status s may move to status to
+func (s ReservationStatus) CanBecome(to ReservationStatus) bool {
+	for _, next := range statusTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Open reports whether a reservation in status s is still to come, so its dates may be changed
+func (s ReservationStatus) Open() bool {
+	return s == StatusPending || s == StatusConfirmed
+}
+
+// StatusChange records a reservation moving from one status to another
+type StatusChange struct {
+	ID				int
+	ReservationID	int
+	FromStatus		ReservationStatus
+	ToStatus		ReservationStatus
+	CreatedAt		time.Time
 }
 
 // RoomRestriction is the room restriction model
@@ -68,6 +330,36 @@ type MailData struct {
 	To 			string // email address i'm sending to
 	From		string // email address i'm sending from
 	Subject 	string
-	Content 	string
+	// Template is the name of the email template, rendered with Data when the email is sent
 	Template 	string
+	Data		json.RawMessage
+	// Content is the html body of an email queued before templates, sent as it is
+	Content		string
+	Attachments	[]Attachment
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Name		string
+	ContentType	string
+	Data		[]byte
+}
+
+// Statuses of emails in the outbox, failing emails stay pending until they run out of attempts
+const (
+	MailPending	= "pending"
+	MailSent	= "sent"
+	MailDead	= "dead"
+)
+
+// OutboxMail is an email queued in the outbox, kept there after it has been sent or given up on
+type OutboxMail struct {
+	ID				int
+	Mail			MailData
+	Status			string
+	Attempts		int
+	NextAttemptAt	time.Time
+	LastError		string
+	CreatedAt		time.Time
+	UpdatedAt		time.Time
 }
\ No newline at end of file
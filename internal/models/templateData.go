@@ -14,4 +14,16 @@ type TemplateData struct {
 	Error 			string
 	Form			*forms.Form
 	IsAuthenticated int
+	AccessLevel		int
+}
+
+// Role returns the role name of the current user
+func (td *TemplateData) Role() string {
+	return AccessLevelName(td.AccessLevel)
+}
+
+// HasRole reports whether the current user has at least the given role
+func (td *TemplateData) HasRole(role string) bool {
+	level, ok := AccessLevelByName(role)
+	return ok && td.AccessLevel >= level
 }
\ No newline at end of file
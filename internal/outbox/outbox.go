@@ -0,0 +1,133 @@
+// Package outbox sends the emails queued in the database with a pool of workers, retrying the ones
+// that fail with exponential backoff until they run out of attempts
+package outbox
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+)
+
+// lease is how long a claimed email is left to one worker before it may be claimed again, well above
+// the time it takes to give up on a mail server
+const lease = 10 * time.Minute
+
+// maxRetryDelay caps the wait between two attempts
+const maxRetryDelay = 12 * time.Hour
+
+// Store is the part of the repository that holds the outbox
+type Store interface {
+	ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error)
+	MarkMailSent(ctx context.Context, id int) error
+	ScheduleMailRetry(ctx context.Context, id int, lastError string, at time.Time) error
+	MarkMailDead(ctx context.Context, id int, lastError string) error
+}
+
+// SendFunc delivers one email
+type SendFunc func(msg models.MailData) error
+
+// Sender sends the emails in the outbox of Store
+type Sender struct {
+	Store			Store
+	Send			SendFunc
+	Workers			int
+	MaxAttempts		int
+	// RetryDelay is the wait after the first failed attempt, it doubles after every further one
+	RetryDelay		time.Duration
+	// PollInterval is how long an idle worker waits before looking for due emails again
+	PollInterval	time.Duration
+	ErrorLog		*log.Logger
+}
+
+// Run starts the workers and blocks until ctx is done and the emails being sent have been dealt with.
+// Emails still queued stay in the outbox for the next run
+func (s *Sender) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < s.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// work sends due emails one at a time, polling for more whenever there are none
+func (s *Sender) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		if s.sendNext(ctx) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+// sendNext claims one due email and sends it, reporting whether there was one
+func (s *Sender) sendNext(ctx context.Context) bool {
+	mail, err := s.Store.ClaimMail(ctx, 1, lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.ErrorLog.Println("cannot claim mail:", err)
+		}
+		return false
+	}
+
+	if len(mail) == 0 {
+		return false
+	}
+
+	s.deliver(mail[0])
+
+	return true
+}
+
+// deliver sends o and records the outcome
+func (s *Sender) deliver(o models.OutboxMail) {
+	// the outcome is recorded even while shutting down, else the email would be sent twice
+	ctx := context.Background()
+
+	var err error
+
+	sendErr := s.Send(o.Mail)
+	switch {
+	case sendErr == nil:
+		err = s.Store.MarkMailSent(ctx, o.ID)
+	case o.Attempts >= s.MaxAttempts:
+		s.ErrorLog.Printf("giving up on email %d to %s after %d attempts: %v", o.ID, o.Mail.To, o.Attempts, sendErr)
+		err = s.Store.MarkMailDead(ctx, o.ID, sendErr.Error())
+	default:
+		s.ErrorLog.Printf("cannot send email %d to %s, attempt %d: %v", o.ID, o.Mail.To, o.Attempts, sendErr)
+		err = s.Store.ScheduleMailRetry(ctx, o.ID, sendErr.Error(), time.Now().Add(Backoff(s.RetryDelay, o.Attempts)))
+	}
+
+	if err != nil {
+		s.ErrorLog.Printf("cannot record the outcome of sending email %d: %v", o.ID, err)
+	}
+}
+
+// Backoff returns the wait after attempts failed attempts: base after the first, doubling after
+// every further one up to maxRetryDelay
+func Backoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
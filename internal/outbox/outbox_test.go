@@ -0,0 +1,158 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marif226/bookings/internal/config"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/repository"
+	"github.com/marif226/bookings/internal/repository/dbrepo"
+)
+
+// run starts s in the background and returns a function that stops it and waits for it to finish
+func run(s *Sender) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// eventually fails the test unless cond becomes true within a second
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newSender(store repository.DatabaseRepo, send SendFunc) *Sender {
+	return &Sender{
+		Store: store,
+		Send: send,
+		Workers: 3,
+		MaxAttempts: 3,
+		RetryDelay: time.Millisecond,
+		PollInterval: time.Millisecond,
+		ErrorLog: log.New(ioutil.Discard, "", 0),
+	}
+}
+
+func TestSender_Sends(t *testing.T) {
+	repo := dbrepo.NewMemoryRepo(&config.AppConfig{}, nil)
+	ctx := context.Background()
+
+	for _, to := range []string{"a@here.com", "b@here.com", "c@here.com"} {
+		if err := repo.EnqueueMail(ctx, models.MailData{To: to}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	sent := make(map[string]int)
+
+	stop := run(newSender(repo, func(msg models.MailData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent[msg.To]++
+		return nil
+	}))
+
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent) == 3
+	})
+
+	stop()
+
+	for to, n := range sent {
+		if n != 1 {
+			t.Errorf("expected one email to %s, got %d", to, n)
+		}
+	}
+
+	// sent emails are not claimed again, even once their lease is over
+	mail, err := repo.ClaimMail(ctx, 10, -time.Hour)
+	if err != nil || len(mail) != 0 {
+		t.Errorf("expected no pending email, got %+v, %v", mail, err)
+	}
+}
+
+func TestSender_RetriesThenGivesUp(t *testing.T) {
+	repo := dbrepo.NewMemoryRepo(&config.AppConfig{}, nil)
+	ctx := context.Background()
+
+	err := repo.EnqueueMail(ctx, models.MailData{To: "john@smith.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	attempts := 0
+
+	stop := run(newSender(repo, func(msg models.MailData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		return errors.New("connection refused")
+	}))
+
+	var dead []models.OutboxMail
+	eventually(t, func() bool {
+		dead, _ = repo.AllDeadMail(ctx)
+		return len(dead) == 1
+	})
+
+	stop()
+
+	if attempts != 3 || dead[0].Attempts != 3 || dead[0].LastError != "connection refused" {
+		t.Errorf("expected 3 failed attempts, got %d and %+v", attempts, dead[0])
+	}
+
+	err = repo.ResendMail(ctx, dead[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail, err := repo.ClaimMail(ctx, 10, time.Minute)
+	if err != nil || len(mail) != 1 || mail[0].Attempts != 1 {
+		t.Errorf("expected the resent email to start again, got %+v, %v", mail, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts	int
+		expected	time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{30, maxRetryDelay},
+	}
+
+	for _, e := range tests {
+		if d := Backoff(time.Minute, e.attempts); d != e.expected {
+			t.Errorf("Backoff after %d attempts = %s, wanted %s", e.attempts, d, e.expected)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package pricing computes the price of stays from the rate plans of rooms
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/stayrules"
+)
+
+// ErrInvalidAmount is returned by ParseAmount for anything but a non-negative amount with at most two decimals
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Quote returns the itemised price of a stay for guests from start until end, the day of departure,
+// booked on today. Every night is priced separately, so a stay may mix weekday, weekend and seasonal rates
+func Quote(plan models.RatePlan, start, end, today time.Time, guests int) (models.Quote, error) {
+	if err := stayrules.CheckDates(start, end, today); err != nil {
+		return models.Quote{}, err
+	}
+
+	q := models.Quote{
+		Currency: plan.Currency,
+	}
+
+	nights := 0
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		amount, description := nightlyRate(plan, d)
+		q.Lines = append(q.Lines, models.QuoteLine{
+			Date: d,
+			Description: description,
+			Amount: amount,
+		})
+		q.Total += amount
+		nights++
+	}
+
+	extra := guests - plan.IncludedGuests
+	if extra > 0 && plan.ExtraGuestRate > 0 {
+		amount := extra * nights * plan.ExtraGuestRate
+		q.Lines = append(q.Lines, models.QuoteLine{
+			Description: fmt.Sprintf("%d extra %s for %d %s", extra, stayrules.Plural(extra, "guest"), nights, stayrules.Plural(nights, "night")),
+			Amount: amount,
+		})
+		q.Total += amount
+	}
+
+	return q, nil
+}
+
+// nightlyRate returns the rate of the night starting on d and a description of it
+func nightlyRate(plan models.RatePlan, d time.Time) (int, string) {
+	nightly, weekend, name := plan.NightlyRate, plan.WeekendRate, "Nightly rate"
+
+	if s, ok := season(plan.Seasons, d); ok {
+		nightly, weekend, name = s.NightlyRate, s.WeekendRate, s.Name
+		if name == "" {
+			name = "Seasonal rate"
+		}
+	}
+
+	if IsWeekend(d) && weekend > 0 {
+		return weekend, name + " (weekend)"
+	}
+
+	return nightly, name
+}
+
+// season returns the season covering the night starting on d. When seasons overlap the one that
+// starts last wins, so a holiday week inside a summer season keeps its own rates
+func season(seasons []models.RateSeason, d time.Time) (models.RateSeason, bool) {
+	var found models.RateSeason
+	ok := false
+
+	for _, s := range seasons {
+		if d.Before(s.StartDate) || d.After(s.EndDate) {
+			continue
+		}
+
+		if !ok || s.StartDate.After(found.StartDate) {
+			found, ok = s, true
+		}
+	}
+
+	return found, ok
+}
+
+// IsWeekend reports whether the night starting on d is a weekend night, i.e. a Friday or Saturday
+func IsWeekend(d time.Time) bool {
+	return d.Weekday() == time.Friday || d.Weekday() == time.Saturday
+}
+
+// FormatAmount formats an amount in cents with two decimals, e.g. 12050 as "120.50"
+func FormatAmount(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// FormatMoney formats an amount in cents together with its currency, e.g. "USD 120.50"
+func FormatMoney(cents int, currency string) string {
+	if currency == "" {
+		return FormatAmount(cents)
+	}
+	return currency + " " + FormatAmount(cents)
+}
+
+// ParseAmount parses an amount such as "120", "120.5" or "120.50" into cents
+func ParseAmount(s string) (int, error) {
+	units, decimals, _ := strings.Cut(strings.TrimSpace(s), ".")
+	if units == "" || len(decimals) > 2 {
+		return 0, ErrInvalidAmount
+	}
+
+	for _, part := range []string{units, decimals} {
+		if strings.Trim(part, "0123456789") != "" {
+			return 0, ErrInvalidAmount
+		}
+	}
+
+	whole, err := strconv.Atoi(units)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+
+	cents := 0
+	if decimals != "" {
+		cents, _ = strconv.Atoi((decimals + "0")[:2])
+	}
+
+	return whole*100 + cents, nil
+}
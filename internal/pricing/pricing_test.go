@@ -0,0 +1,106 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/stayrules"
+)
+
+// day returns a date in January 2050, the 1st is a Saturday
+func day(d int) time.Time {
+	return time.Date(2050, time.January, d, 0, 0, 0, 0, time.UTC)
+}
+
+var plan = models.RatePlan{
+	Currency: "USD",
+	NightlyRate: 10000,
+	WeekendRate: 12000,
+	IncludedGuests: 2,
+	ExtraGuestRate: 2500,
+	Seasons: []models.RateSeason{
+		{Name: "Winter", StartDate: day(10), EndDate: day(31), NightlyRate: 15000},
+		{Name: "Festival", StartDate: day(14), EndDate: day(15), NightlyRate: 20000, WeekendRate: 25000},
+	},
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name			string
+		start			time.Time
+		end				time.Time
+		guests			int
+		expectedLines	[]string
+		expectedTotal	int
+	}{
+		{"weekdays", day(3), day(5), 2, []string{"Nightly rate", "Nightly rate"}, 20000},
+		{"weekend", day(6), day(9), 1, []string{"Nightly rate", "Nightly rate (weekend)", "Nightly rate (weekend)"}, 34000},
+		{"season without weekend rate", day(13), day(14), 2, []string{"Winter"}, 15000},
+		{"overlapping seasons", day(13), day(16), 2, []string{"Winter", "Festival (weekend)", "Festival (weekend)"}, 65000},
+		{"extra guests", day(3), day(5), 4, []string{"Nightly rate", "Nightly rate", "2 extra guests for 2 nights"}, 30000},
+	}
+
+	for _, e := range tests {
+		q, err := Quote(plan, e.start, e.end, day(1), e.guests)
+		if err != nil {
+			t.Fatalf("for %s got error %v", e.name, err)
+		}
+
+		if q.Total != e.expectedTotal || q.Currency != "USD" {
+			t.Errorf("for %s expected a total of USD %d, got %s %d", e.name, e.expectedTotal, q.Currency, q.Total)
+		}
+
+		if len(q.Lines) != len(e.expectedLines) {
+			t.Fatalf("for %s expected %d lines, got %+v", e.name, len(e.expectedLines), q.Lines)
+		}
+
+		for i, line := range q.Lines {
+			if line.Description != e.expectedLines[i] {
+				t.Errorf("for %s expected line %d to be %q, got %q", e.name, i, e.expectedLines[i], line.Description)
+			}
+		}
+	}
+}
+
+func TestQuote_InvalidDates(t *testing.T) {
+	for _, end := range []time.Time{day(3), day(2)} {
+		_, err := Quote(plan, day(3), end, day(1), 1)
+		if err != stayrules.ErrInvalidDates {
+			t.Errorf("expected ErrInvalidDates for an end of %s, got %v", end.Format("2006-01-02"), err)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	valid := map[string]int{
+		"120":		12000,
+		"120.5":	12050,
+		" 0.05 ":	5,
+		"7.":		700,
+	}
+
+	for s, expected := range valid {
+		cents, err := ParseAmount(s)
+		if err != nil || cents != expected {
+			t.Errorf("ParseAmount(%q) = %d, %v, wanted %d", s, cents, err, expected)
+		}
+	}
+
+	for _, s := range []string{"", "-1", "1.234", "1,50", "abc", ".50"} {
+		_, err := ParseAmount(s)
+		if err != ErrInvalidAmount {
+			t.Errorf("ParseAmount(%q) should fail, got %v", s, err)
+		}
+	}
+}
+
+func TestFormatMoney(t *testing.T) {
+	if s := FormatMoney(12050, "USD"); s != "USD 120.50" {
+		t.Errorf("unexpected %q", s)
+	}
+
+	if s := FormatMoney(5, ""); s != "0.05" {
+		t.Errorf("unexpected %q", s)
+	}
+}
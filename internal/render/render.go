@@ -12,10 +12,16 @@ import (
 	"github.com/justinas/nosurf"
 	"github.com/marif226/bookings/internal/config"
 	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/pricing"
 )
 
 var functions = template.FuncMap {
 	"humanDate": HumanDate,
+	"formatDate": FormatDate,
+	"iterate": Iterate,
+	"add": Add,
+	"accessLevelName": models.AccessLevelName,
+	"money": pricing.FormatMoney,
 }
 
 var app *config.AppConfig
@@ -31,6 +37,25 @@ func HumanDate(t time.Time) string {
 	return t.Format("02-01-2006")
 }
 
+// FormatDate returns time in the given layout
+func FormatDate(t time.Time, f string) string {
+	return t.Format(f)
+}
+
+// Iterate returns a slice of ints, starting at 0, going to count
+func Iterate(count int) []int {
+	var items []int
+	for i := 0; i < count; i++ {
+		items = append(items, i)
+	}
+	return items
+}
+
+// Add returns the sum of a and b
+func Add(a, b int) int {
+	return a + b
+}
+
 // AddDefaultData adds data for all templates
 func AddDefaultData(templData *models.TemplateData, r *http.Request) *models.TemplateData {
 	templData.Flash = app.Session.PopString(r.Context(), "flash")
@@ -39,6 +64,7 @@ func AddDefaultData(templData *models.TemplateData, r *http.Request) *models.Tem
 	templData.CSRFToken = nosurf.Token(r)
 	if app.Session.Exists(r.Context(), "user_id") {
 		templData.IsAuthenticated = 1
+		templData.AccessLevel = app.Session.GetInt(r.Context(), "access_level")
 	}
 	return templData
 }
@@ -1,22 +1,59 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"sync"
+	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/marif226/bookings/internal/config"
+	"github.com/marif226/bookings/internal/models"
 	"github.com/marif226/bookings/internal/repository"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
+// defaultQueryTimeout bounds repository calls when no timeout is configured
+const defaultQueryTimeout = 3 * time.Second
+
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB *sql.DB
 }
 
+// sqliteDBRepo runs the queries of postgresDBRepo, which stick to SQL that SQLite understands,
+// and replaces only the methods that lock rows
+type sqliteDBRepo struct {
+	postgresDBRepo
+}
+
 type testDBRepo struct {
 	App *config.AppConfig
 	DB	*sql.DB
 }
 
+// FailureHook is called by the in-memory repository with the name of the DatabaseRepo method
+// before every call; a non-nil error makes that call fail with it
+type FailureHook func(method string) error
+
+type memoryDBRepo struct {
+	App 				*config.AppConfig
+	fail				FailureHook
+	mu					sync.RWMutex
+	ids					map[string]int
+	users				map[int]models.User
+	rooms				map[int]models.Room
+	ratePlans			map[int]models.RatePlan // by room id
+	stayRules			map[int][]models.StayRule // by room id
+	icalTokens			map[int]string // by room id
+	reservations		map[int]models.Reservation
+	roomRestrictions	map[int]models.RoomRestriction
+	apiTokens			map[int]models.APIToken
+	outbox				map[int]models.OutboxMail
+}
+
 func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
 	return &postgresDBRepo{
 		App: a,
@@ -24,8 +61,76 @@ func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 	}
 }
 
+// NewSQLiteRepo creates a repository for a database opened with driver.ConnectSQLite
+func NewSQLiteRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
+	return &sqliteDBRepo{
+		postgresDBRepo: postgresDBRepo{
+			App: a,
+			DB: conn,
+		},
+	}
+}
+
 func NewTestingRepo(a *config.AppConfig) repository.DatabaseRepo {
 	return &testDBRepo{
 		App: a,
 	}
-}
\ No newline at end of file
+}
+
+// NewMemoryRepo creates an empty in-memory repository holding only the seeded rooms and rate plans;
+// fail may be nil
+func NewMemoryRepo(a *config.AppConfig, fail FailureHook) repository.DatabaseRepo {
+	m := &memoryDBRepo{
+		App: a,
+		fail: fail,
+		ids: make(map[string]int),
+		users: make(map[int]models.User),
+		rooms: make(map[int]models.Room),
+		ratePlans: make(map[int]models.RatePlan),
+		stayRules: make(map[int][]models.StayRule),
+		icalTokens: make(map[int]string),
+		reservations: make(map[int]models.Reservation),
+		roomRestrictions: make(map[int]models.RoomRestriction),
+		apiTokens: make(map[int]models.APIToken),
+		outbox: make(map[int]models.OutboxMail),
+	}
+	m.seed()
+
+	return m
+}
+
+// withTimeout derives the context for one repository call from ctx, bounded by the configured query timeout
+func (m *postgresDBRepo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := m.App.Database.QueryTimeout
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// duplicateEmailError turns a unique violation on users.email into repository.ErrDuplicateEmail
+func duplicateEmailError(err error) error {
+	if uniqueViolation(err) {
+		return repository.ErrDuplicateEmail
+	}
+	return err
+}
+
+// duplicateSlugError turns a unique violation on rooms.slug into repository.ErrDuplicateSlug
+func duplicateSlugError(err error) error {
+	if uniqueViolation(err) {
+		return repository.ErrDuplicateSlug
+	}
+	return err
+}
+
+// uniqueViolation reports whether err is a unique constraint violation of postgres or SQLite
+func uniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return true
+	}
+
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
@@ -0,0 +1,1280 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// seed adds the rooms and rate plans inserted by the seed migrations
+func (m *memoryDBRepo) seed() {
+	rooms := []models.Room{
+		{
+			RoomName: "General's Quarters",
+			Slug: "generals-quarters",
+			Description: "Our most luxurious apartments with the most beautiful views, top-class furniture and Iranian carpets. The general of the Cuban Army Ernesto Pintos himself once stayed here.",
+			BedConfiguration: "1 king bed",
+			Photos: []models.RoomPhoto{{URL: "/static/images/generals-quarters.png"}},
+		},
+		{
+			RoomName: "Major's Suite",
+			Slug: "majors-suite",
+			Description: "The ideal option in the price-quality ratio. This includes comfortable rooms with breakfast included, as well as a bed, a wardrobe and a bathroom with hot water.",
+			BedConfiguration: "1 double bed",
+			Amenities: []string{"Breakfast included"},
+			Photos: []models.RoomPhoto{{URL: "/static/images/marjors-suite.png"}},
+		},
+	}
+
+	// nightly and weekend rates of the rooms above
+	rates := [][2]int{{15000, 18000}, {9500, 11000}}
+
+	for i, room := range rooms {
+		room.ID = m.nextID("rooms")
+		room.MaxOccupancy = 2
+		room.CreatedAt = time.Now()
+		room.UpdatedAt = time.Now()
+		room.Photos = m.newPhotos(room.ID, room.Photos)
+		m.rooms[room.ID] = room
+
+		m.ratePlans[room.ID] = models.RatePlan{
+			ID: m.nextID("rate_plans"),
+			RoomID: room.ID,
+			Currency: "USD",
+			NightlyRate: rates[i][0],
+			WeekendRate: rates[i][1],
+			IncludedGuests: 2,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+	}
+}
+
+// newPhotos returns copies of photos for room id with new ids, numbered in slice order
+func (m *memoryDBRepo) newPhotos(roomID int, photos []models.RoomPhoto) []models.RoomPhoto {
+	var gallery []models.RoomPhoto
+	for i, p := range photos {
+		p.ID = m.nextID("room_photos")
+		p.RoomID = roomID
+		p.Position = i
+		p.CreatedAt = time.Now()
+		p.UpdatedAt = time.Now()
+		gallery = append(gallery, p)
+	}
+	return gallery
+}
+
+// copyRoom returns room with its own copies of the amenities and photos
+func copyRoom(room models.Room) models.Room {
+	room.Amenities = append([]string(nil), room.Amenities...)
+	room.Photos = append([]models.RoomPhoto(nil), room.Photos...)
+	return room
+}
+
+// slugTaken reports whether a room other than id has slug
+func (m *memoryDBRepo) slugTaken(slug string, id int) bool {
+	for _, room := range m.rooms {
+		if room.Slug == slug && room.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// nextID returns the next id of table, like a serial column
+func (m *memoryDBRepo) nextID(table string) int {
+	m.ids[table]++
+	return m.ids[table]
+}
+
+// check runs before every call, failing it if the context is done or the failure hook says so
+func (m *memoryDBRepo) check(ctx context.Context, method string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if m.fail != nil {
+		return m.fail(method)
+	}
+
+	return nil
+}
+
+// overlaps reports whether the range start-end overlaps r, the same test the postgres queries use
+func overlaps(r models.RoomRestriction, start, end time.Time) bool {
+	return start.Before(r.EndDate) && end.After(r.StartDate)
+}
+
+// withRoom returns res with its room filled in and its quote lines and status history copied
+func (m *memoryDBRepo) withRoom(res models.Reservation) models.Reservation {
+	room := m.rooms[res.RoomID]
+	res.Room = models.Room{ID: room.ID, RoomName: room.RoomName}
+	res.Quote.Lines = append([]models.QuoteLine(nil), res.Quote.Lines...)
+	res.StatusChanges = append([]models.StatusChange(nil), res.StatusChanges...)
+	return res
+}
+
+// withUser returns t with its owner filled in and its scopes copied
+func (m *memoryDBRepo) withUser(t models.APIToken) models.APIToken {
+	u := m.users[t.UserID]
+	u.Password = ""
+	t.User = u
+	t.Scopes = append([]string(nil), t.Scopes...)
+	return t
+}
+
+// emailTaken reports whether a user other than id has email
+func (m *memoryDBRepo) emailTaken(email string, id int) bool {
+	for _, u := range m.users {
+		if u.Email == email && u.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// AllUsers returns a slice of all users
+func (m *memoryDBRepo) AllUsers(ctx context.Context) ([]models.User, error) {
+	if err := m.check(ctx, "AllUsers"); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []models.User
+	for _, u := range m.users {
+		u.Password = ""
+		users = append(users, u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].LastName != users[j].LastName {
+			return users[i].LastName < users[j].LastName
+		}
+		return users[i].FirstName < users[j].FirstName
+	})
+
+	return users, nil
+}
+
+// InsertReservation books a room and queues the emails returned by mail, which may be nil, returning
+// repository.ErrRoomUnavailable if any of the dates are taken
+func (m *memoryDBRepo) InsertReservation(ctx context.Context, res models.Reservation, mail repository.MailFunc) (int, error) {
+	if err := m.check(ctx, "InsertReservation"); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[res.RoomID]; !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	for _, r := range m.roomRestrictions {
+		if r.RoomID == res.RoomID && overlaps(r, res.StartDate, res.EndDate) {
+			return 0, repository.ErrRoomUnavailable
+		}
+	}
+
+	res.ID = m.nextID("reservations")
+	res.Room = models.Room{}
+	res.Quote.Lines = append([]models.QuoteLine(nil), res.Quote.Lines...)
+	res.Status = models.StatusPending
+	res.StatusChanges = nil
+	res.CreatedAt = time.Now()
+	res.UpdatedAt = time.Now()
+	m.reservations[res.ID] = res
+
+	restrictionID := m.nextID("room_restrictions")
+	m.roomRestrictions[restrictionID] = models.RoomRestriction{
+		ID: restrictionID,
+		StartDate: res.StartDate,
+		EndDate: res.EndDate,
+		RoomID: res.RoomID,
+		ReservationID: res.ID,
+		RestrictionID: models.RestrictionReservation,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if mail != nil {
+		for _, msg := range mail(m.withRoom(res)) {
+			m.enqueueMail(msg)
+		}
+	}
+
+	return res.ID, nil
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false if not
+func (m *memoryDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	if err := m.check(ctx, "SearchAvailabilityByDatesByRoomID"); err != nil {
+		return false, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, r := range m.roomRestrictions {
+		if r.RoomID == roomID && overlaps(r, start, end) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// SearchAvailabilityForAllRooms returns the rooms sleeping at least guests that are available for the given date range
+func (m *memoryDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time, guests int) ([]models.Room, error) {
+	if err := m.check(ctx, "SearchAvailabilityForAllRooms"); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	taken := make(map[int]bool)
+	for _, r := range m.roomRestrictions {
+		if overlaps(r, start, end) {
+			taken[r.RoomID] = true
+		}
+	}
+
+	var rooms []models.Room
+	for id, room := range m.rooms {
+		if !taken[id] && room.MaxOccupancy >= guests {
+			rooms = append(rooms, models.Room{ID: room.ID, RoomName: room.RoomName, MaxOccupancy: room.MaxOccupancy})
+		}
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].ID < rooms[j].ID
+	})
+
+	return rooms, nil
+}
+
+// GetRoomByID gets room by id
+func (m *memoryDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	if err := m.check(ctx, "GetRoomByID"); err != nil {
+		return models.Room{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return models.Room{}, sql.ErrNoRows
+	}
+
+	return copyRoom(room), nil
+}
+
+// GetRoomBySlug gets room by slug
+func (m *memoryDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	if err := m.check(ctx, "GetRoomBySlug"); err != nil {
+		return models.Room{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, room := range m.rooms {
+		if room.Slug == slug {
+			return copyRoom(room), nil
+		}
+	}
+
+	return models.Room{}, sql.ErrNoRows
+}
+
+// InsertRoom inserts a room together with its photos and returns its id
+func (m *memoryDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	if err := m.check(ctx, "InsertRoom"); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.slugTaken(room.Slug, 0) {
+		return 0, repository.ErrDuplicateSlug
+	}
+
+	room.ID = m.nextID("rooms")
+	room.Amenities = append([]string(nil), room.Amenities...)
+	room.Photos = m.newPhotos(room.ID, room.Photos)
+	room.CreatedAt = time.Now()
+	room.UpdatedAt = time.Now()
+	m.rooms[room.ID] = room
+
+	return room.ID, nil
+}
+
+// UpdateRoom updates a room and replaces its photos
+func (m *memoryDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	if err := m.check(ctx, "UpdateRoom"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.rooms[room.ID]
+	if !ok {
+		return nil
+	}
+
+	if m.slugTaken(room.Slug, room.ID) {
+		return repository.ErrDuplicateSlug
+	}
+
+	room.Amenities = append([]string(nil), room.Amenities...)
+	room.Photos = m.newPhotos(room.ID, room.Photos)
+	room.CreatedAt = existing.CreatedAt
+	room.UpdatedAt = time.Now()
+	m.rooms[room.ID] = room
+
+	return nil
+}
+
+// DeleteRoom deletes a room, it returns repository.ErrRoomInUse while the room still has reservations or blocks
+func (m *memoryDBRepo) DeleteRoom(ctx context.Context, id int) error {
+	if err := m.check(ctx, "DeleteRoom"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, res := range m.reservations {
+		if res.RoomID == id {
+			return repository.ErrRoomInUse
+		}
+	}
+
+	for _, r := range m.roomRestrictions {
+		if r.RoomID == id {
+			return repository.ErrRoomInUse
+		}
+	}
+
+	delete(m.rooms, id)
+	delete(m.ratePlans, id)
+	delete(m.stayRules, id)
+	delete(m.icalTokens, id)
+
+	return nil
+}
+
+// GetRoomICalToken returns the token of the iCal feed of a room, empty while the feed is off
+func (m *memoryDBRepo) GetRoomICalToken(ctx context.Context, roomID int) (string, error) {
+	if err := m.check(ctx, "GetRoomICalToken"); err != nil {
+		return "", err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.rooms[roomID]; !ok {
+		return "", sql.ErrNoRows
+	}
+
+	return m.icalTokens[roomID], nil
+}
+
+// SetRoomICalToken replaces the token of the iCal feed of a room, an empty token turns the feed off
+func (m *memoryDBRepo) SetRoomICalToken(ctx context.Context, roomID int, token string) error {
+	if err := m.check(ctx, "SetRoomICalToken"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[roomID]; !ok {
+		return nil
+	}
+
+	if token == "" {
+		delete(m.icalTokens, roomID)
+	} else {
+		m.icalTokens[roomID] = token
+	}
+
+	return nil
+}
+
+// GetRatePlanByRoomID returns the rate plan of a room, it returns sql.ErrNoRows if the room has no rate plan
+func (m *memoryDBRepo) GetRatePlanByRoomID(ctx context.Context, roomID int) (models.RatePlan, error) {
+	if err := m.check(ctx, "GetRatePlanByRoomID"); err != nil {
+		return models.RatePlan{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	plan, ok := m.ratePlans[roomID]
+	if !ok {
+		return models.RatePlan{}, sql.ErrNoRows
+	}
+
+	plan.Seasons = append([]models.RateSeason(nil), plan.Seasons...)
+
+	return plan, nil
+}
+
+// SaveRatePlan creates or replaces the rate plan of plan.RoomID together with its seasons
+func (m *memoryDBRepo) SaveRatePlan(ctx context.Context, plan models.RatePlan) error {
+	if err := m.check(ctx, "SaveRatePlan"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[plan.RoomID]; !ok {
+		return sql.ErrNoRows
+	}
+
+	existing, ok := m.ratePlans[plan.RoomID]
+	if ok {
+		plan.ID = existing.ID
+		plan.CreatedAt = existing.CreatedAt
+	} else {
+		plan.ID = m.nextID("rate_plans")
+		plan.CreatedAt = time.Now()
+	}
+	plan.UpdatedAt = time.Now()
+
+	var seasons []models.RateSeason
+	for _, s := range plan.Seasons {
+		s.ID = m.nextID("rate_seasons")
+		s.RatePlanID = plan.ID
+		s.CreatedAt = time.Now()
+		s.UpdatedAt = time.Now()
+		seasons = append(seasons, s)
+	}
+
+	sort.SliceStable(seasons, func(i, j int) bool {
+		return seasons[i].StartDate.Before(seasons[j].StartDate)
+	})
+
+	plan.Seasons = seasons
+	m.ratePlans[plan.RoomID] = plan
+
+	return nil
+}
+
+// GetStayRulesByRoomID returns the stay rules of a room, the ones for all year first
+func (m *memoryDBRepo) GetStayRulesByRoomID(ctx context.Context, roomID int) ([]models.StayRule, error) {
+	if err := m.check(ctx, "GetStayRulesByRoomID"); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]models.StayRule(nil), m.stayRules[roomID]...), nil
+}
+
+// SaveStayRules replaces the stay rules of a room
+func (m *memoryDBRepo) SaveStayRules(ctx context.Context, roomID int, rules []models.StayRule) error {
+	if err := m.check(ctx, "SaveStayRules"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[roomID]; !ok {
+		return sql.ErrNoRows
+	}
+
+	var saved []models.StayRule
+	for _, rule := range rules {
+		rule.ID = m.nextID("stay_rules")
+		rule.RoomID = roomID
+		rule.CreatedAt = time.Now()
+		rule.UpdatedAt = time.Now()
+		saved = append(saved, rule)
+	}
+
+	sort.SliceStable(saved, func(i, j int) bool {
+		if saved[i].HasDates() != saved[j].HasDates() {
+			return !saved[i].HasDates()
+		}
+		return saved[i].StartDate.Before(saved[j].StartDate)
+	})
+
+	m.stayRules[roomID] = saved
+
+	return nil
+}
+
+// GetUserByID returns a user by id
+func (m *memoryDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	if err := m.check(ctx, "GetUserByID"); err != nil {
+		return models.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	return u, nil
+}
+
+// GetUserByEmail returns a user by email address
+func (m *memoryDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	if err := m.check(ctx, "GetUserByEmail"); err != nil {
+		return models.User{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+
+	return models.User{}, sql.ErrNoRows
+}
+
+// UpdateUser updates user in database
+func (m *memoryDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	if err := m.check(ctx, "UpdateUser"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.users[u.ID]
+	if !ok {
+		return nil
+	}
+
+	if m.emailTaken(u.Email, u.ID) {
+		return repository.ErrDuplicateEmail
+	}
+
+	existing.FirstName = u.FirstName
+	existing.LastName = u.LastName
+	existing.Email = u.Email
+	existing.AccessLevel = u.AccessLevel
+	existing.UpdatedAt = time.Now()
+	m.users[u.ID] = existing
+
+	return nil
+}
+
+// InsertUser inserts a user with a bcrypt hash of password
+func (m *memoryDBRepo) InsertUser(ctx context.Context, u models.User, password string) (int, error) {
+	if err := m.check(ctx, "InsertUser"); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(u.Email, 0) {
+		return 0, repository.ErrDuplicateEmail
+	}
+
+	u.ID = m.nextID("users")
+	u.Password = string(hashedPassword)
+	u.Active = true
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = time.Now()
+	m.users[u.ID] = u
+
+	return u.ID, nil
+}
+
+// UpdatePassword replaces the password of a user with a bcrypt hash of password
+func (m *memoryDBRepo) UpdatePassword(ctx context.Context, id int, password string) error {
+	if err := m.check(ctx, "UpdatePassword"); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, ok := m.users[id]; ok {
+		u.Password = string(hashedPassword)
+		u.UpdatedAt = time.Now()
+		m.users[id] = u
+	}
+
+	return nil
+}
+
+// SetUserActive activates or deactivates a user
+func (m *memoryDBRepo) SetUserActive(ctx context.Context, id int, active bool) error {
+	if err := m.check(ctx, "SetUserActive"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, ok := m.users[id]; ok {
+		u.Active = active
+		u.UpdatedAt = time.Now()
+		m.users[id] = u
+	}
+
+	return nil
+}
+
+// DeleteUser deletes one user by id together with their API tokens
+func (m *memoryDBRepo) DeleteUser(ctx context.Context, id int) error {
+	if err := m.check(ctx, "DeleteUser"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.users, id)
+	for tokenID, t := range m.apiTokens {
+		if t.UserID == id {
+			delete(m.apiTokens, tokenID)
+		}
+	}
+
+	return nil
+}
+
+// Authenticate authenticates user
+func (m *memoryDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	if err := m.check(ctx, "Authenticate"); err != nil {
+		return 0, "", err
+	}
+
+	m.mu.RLock()
+	var user models.User
+	found := false
+	for _, u := range m.users {
+		if u.Email == email && u.Active {
+			user, found = u, true
+			break
+		}
+	}
+	m.mu.RUnlock()
+
+	if !found {
+		return 0, "", sql.ErrNoRows
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", errors.New("incorrect password!")
+	} else if err != nil {
+		return 0, "", err
+	}
+
+	return user.ID, user.Password, nil
+}
+
+// AllReservations returns a slice of all reservations in status, or of every reservation if status is empty
+func (m *memoryDBRepo) AllReservations(ctx context.Context, status models.ReservationStatus) ([]models.Reservation, error) {
+	if err := m.check(ctx, "AllReservations"); err != nil {
+		return nil, err
+	}
+
+	return m.reservationsWhere(func(res models.Reservation) bool { return status == "" || res.Status == status }), nil
+}
+
+// AllNewReservations returns a slice of all pending reservations
+func (m *memoryDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	if err := m.check(ctx, "AllNewReservations"); err != nil {
+		return nil, err
+	}
+
+	return m.reservationsWhere(func(res models.Reservation) bool { return res.Status == models.StatusPending }), nil
+}
+
+// reservationsWhere returns the reservations matching keep, ordered by start date
+func (m *memoryDBRepo) reservationsWhere(keep func(models.Reservation) bool) []models.Reservation {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var reservations []models.Reservation
+	for _, res := range m.reservations {
+		if keep(res) {
+			reservations = append(reservations, m.withRoom(res))
+		}
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		if !reservations[i].StartDate.Equal(reservations[j].StartDate) {
+			return reservations[i].StartDate.Before(reservations[j].StartDate)
+		}
+		return reservations[i].ID < reservations[j].ID
+	})
+
+	return reservations
+}
+
+// GetReservationByID returns one reservation by id together with the history of its status
+func (m *memoryDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	if err := m.check(ctx, "GetReservationByID"); err != nil {
+		return models.Reservation{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return models.Reservation{}, sql.ErrNoRows
+	}
+
+	return m.withRoom(res), nil
+}
+
+// UpdateReservation updates the guest details of a reservation
+func (m *memoryDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	if err := m.check(ctx, "UpdateReservation"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if res, ok := m.reservations[u.ID]; ok {
+		res.FirstName = u.FirstName
+		res.LastName = u.LastName
+		res.Email = u.Email
+		res.Phone = u.Phone
+		res.UpdatedAt = time.Now()
+		m.reservations[u.ID] = res
+	}
+
+	return nil
+}
+
+// ChangeReservationDates moves a reservation and its room restriction to res.StartDate and res.EndDate
+// and stores res.Quote with it. It returns repository.ErrRoomUnavailable if the room is taken on any of
+// the new dates and sql.ErrNoRows if there is no pending or confirmed reservation res.ID for res.RoomID
+func (m *memoryDBRepo) ChangeReservationDates(ctx context.Context, res models.Reservation) error {
+	if err := m.check(ctx, "ChangeReservationDates"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.reservations[res.ID]
+	if !ok || existing.RoomID != res.RoomID || !existing.Status.Open() {
+		return sql.ErrNoRows
+	}
+
+	for _, r := range m.roomRestrictions {
+		if r.RoomID == res.RoomID && r.ReservationID != res.ID && overlaps(r, res.StartDate, res.EndDate) {
+			return repository.ErrRoomUnavailable
+		}
+	}
+
+	existing.StartDate = res.StartDate
+	existing.EndDate = res.EndDate
+	existing.Quote = res.Quote
+	existing.Quote.Lines = append([]models.QuoteLine(nil), res.Quote.Lines...)
+	existing.UpdatedAt = time.Now()
+	m.reservations[res.ID] = existing
+
+	for id, r := range m.roomRestrictions {
+		if r.ReservationID == res.ID {
+			r.StartDate = res.StartDate
+			r.EndDate = res.EndDate
+			r.UpdatedAt = time.Now()
+			m.roomRestrictions[id] = r
+		}
+	}
+
+	return nil
+}
+
+// DeleteReservation deletes one reservation by id together with its room restrictions
+func (m *memoryDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	if err := m.check(ctx, "DeleteReservation"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.reservations, id)
+	for restrictionID, r := range m.roomRestrictions {
+		if r.ReservationID == id {
+			delete(m.roomRestrictions, restrictionID)
+		}
+	}
+
+	return nil
+}
+
+// UpdateReservationStatus moves a reservation to status and records the change. It returns
+// repository.ErrInvalidTransition if the reservation cannot move there from its current status.
+// Cancelling a reservation frees its room but keeps the reservation
+func (m *memoryDBRepo) UpdateReservationStatus(ctx context.Context, id int, status models.ReservationStatus) error {
+	if err := m.check(ctx, "UpdateReservationStatus"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	if !res.Status.CanBecome(status) {
+		return repository.ErrInvalidTransition
+	}
+
+	res.StatusChanges = append(res.StatusChanges, models.StatusChange{
+		ID: m.nextID("reservation_status_changes"),
+		ReservationID: id,
+		FromStatus: res.Status,
+		ToStatus: status,
+		CreatedAt: time.Now(),
+	})
+	res.Status = status
+	res.UpdatedAt = time.Now()
+	m.reservations[id] = res
+
+	if status == models.StatusCancelled {
+		for restrictionID, r := range m.roomRestrictions {
+			if r.ReservationID == id {
+				delete(m.roomRestrictions, restrictionID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// AllRooms returns all rooms ordered by name, together with their photos
+func (m *memoryDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	if err := m.check(ctx, "AllRooms"); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rooms []models.Room
+	for _, room := range m.rooms {
+		rooms = append(rooms, copyRoom(room))
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].RoomName < rooms[j].RoomName
+	})
+
+	return rooms, nil
+}
+
+// GetRestrictionsForRoomByDate returns restrictions for a room overlapping the given date range
+func (m *memoryDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	if err := m.check(ctx, "GetRestrictionsForRoomByDate"); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var restrictions []models.RoomRestriction
+	for _, r := range m.roomRestrictions {
+		// the calendar asks for whole months, so a restriction starting on the last day counts
+		if r.RoomID == roomID && start.Before(r.EndDate) && !end.Before(r.StartDate) {
+			restrictions = append(restrictions, models.RoomRestriction{
+				ID: r.ID,
+				ReservationID: r.ReservationID,
+				RestrictionID: r.RestrictionID,
+				RoomID: r.RoomID,
+				StartDate: r.StartDate,
+				EndDate: r.EndDate,
+			})
+		}
+	}
+
+	sort.Slice(restrictions, func(i, j int) bool {
+		return restrictions[i].ID < restrictions[j].ID
+	})
+
+	return restrictions, nil
+}
+
+// InsertBlockForRoom inserts a one-day owner block for a room
+func (m *memoryDBRepo) InsertBlockForRoom(ctx context.Context, roomID int, startDate time.Time) error {
+	if err := m.check(ctx, "InsertBlockForRoom"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[roomID]; !ok {
+		return sql.ErrNoRows
+	}
+
+	for _, r := range m.roomRestrictions {
+		if r.RoomID == roomID && overlaps(r, startDate, startDate.AddDate(0, 0, 1)) {
+			return repository.ErrRoomUnavailable
+		}
+	}
+
+	id := m.nextID("room_restrictions")
+	m.roomRestrictions[id] = models.RoomRestriction{
+		ID: id,
+		StartDate: startDate,
+		EndDate: startDate.AddDate(0, 0, 1),
+		RoomID: roomID,
+		RestrictionID: models.RestrictionOwnerBlock,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return nil
+}
+
+// DeleteBlockByID deletes an owner block by id
+func (m *memoryDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	if err := m.check(ctx, "DeleteBlockByID"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.roomRestrictions[id]; ok && r.RestrictionID == models.RestrictionOwnerBlock {
+		delete(m.roomRestrictions, id)
+	}
+
+	return nil
+}
+
+// AllAPITokens returns all API tokens with their owners, newest first
+func (m *memoryDBRepo) AllAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	if err := m.check(ctx, "AllAPITokens"); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tokens []models.APIToken
+	for _, t := range m.apiTokens {
+		tokens = append(tokens, m.withUser(t))
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].ID > tokens[j].ID
+	})
+
+	return tokens, nil
+}
+
+// InsertAPIToken inserts a new API token and returns its id
+func (m *memoryDBRepo) InsertAPIToken(ctx context.Context, t models.APIToken) (int, error) {
+	if err := m.check(ctx, "InsertAPIToken"); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[t.UserID]; !ok {
+		return 0, errors.New("api token belongs to an unknown user")
+	}
+
+	for _, existing := range m.apiTokens {
+		if existing.TokenHash == t.TokenHash {
+			return 0, errors.New("api token hash is already in use")
+		}
+	}
+
+	t.ID = m.nextID("api_tokens")
+	t.Scopes = append([]string(nil), t.Scopes...)
+	t.LastUsedAt = time.Time{}
+	t.RevokedAt = time.Time{}
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = time.Now()
+	t.User = models.User{}
+	m.apiTokens[t.ID] = t
+
+	return t.ID, nil
+}
+
+// GetAPITokenByID returns an API token by id together with its owner
+func (m *memoryDBRepo) GetAPITokenByID(ctx context.Context, id int) (models.APIToken, error) {
+	if err := m.check(ctx, "GetAPITokenByID"); err != nil {
+		return models.APIToken{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.apiTokens[id]
+	if !ok {
+		return models.APIToken{}, sql.ErrNoRows
+	}
+
+	return m.withUser(t), nil
+}
+
+// GetAPITokenByHash returns the API token with the given hash together with its owner
+func (m *memoryDBRepo) GetAPITokenByHash(ctx context.Context, hash string) (models.APIToken, error) {
+	if err := m.check(ctx, "GetAPITokenByHash"); err != nil {
+		return models.APIToken{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, t := range m.apiTokens {
+		if t.TokenHash == hash {
+			return m.withUser(t), nil
+		}
+	}
+
+	return models.APIToken{}, sql.ErrNoRows
+}
+
+// UpdateAPITokenLastUsed records that the API token was just used
+func (m *memoryDBRepo) UpdateAPITokenLastUsed(ctx context.Context, id int) error {
+	if err := m.check(ctx, "UpdateAPITokenLastUsed"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.apiTokens[id]; ok {
+		t.LastUsedAt = time.Now()
+		m.apiTokens[id] = t
+	}
+
+	return nil
+}
+
+// RevokeAPIToken revokes an API token, it is kept so that its history stays visible
+func (m *memoryDBRepo) RevokeAPIToken(ctx context.Context, id int) error {
+	if err := m.check(ctx, "RevokeAPIToken"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t, ok := m.apiTokens[id]; ok && !t.Revoked() {
+		t.RevokedAt = time.Now()
+		t.UpdatedAt = t.RevokedAt
+		m.apiTokens[id] = t
+	}
+
+	return nil
+}
+
+// enqueueMail adds msg to the outbox, the caller must hold the lock
+func (m *memoryDBRepo) enqueueMail(msg models.MailData) {
+	id := m.nextID("mail_outbox")
+	m.outbox[id] = models.OutboxMail{
+		ID: id,
+		Mail: msg,
+		Status: models.MailPending,
+		NextAttemptAt: time.Now(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
+
+// EnqueueMail queues an email in the outbox, to be sent as soon as possible
+func (m *memoryDBRepo) EnqueueMail(ctx context.Context, msg models.MailData) error {
+	if err := m.check(ctx, "EnqueueMail"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enqueueMail(msg)
+
+	return nil
+}
+
+// ClaimMail returns up to limit pending emails that are due, oldest first, and leases them for lease
+func (m *memoryDBRepo) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	if err := m.check(ctx, "ClaimMail"); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	var due []models.OutboxMail
+	for _, o := range m.outbox {
+		if o.Status == models.MailPending && !o.NextAttemptAt.After(now) {
+			due = append(due, o)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for i := range due {
+		due[i].Attempts++
+		due[i].NextAttemptAt = now.Add(lease)
+		due[i].UpdatedAt = now
+		m.outbox[due[i].ID] = due[i]
+	}
+
+	return due, nil
+}
+
+// MarkMailSent records that an email has been sent
+func (m *memoryDBRepo) MarkMailSent(ctx context.Context, id int) error {
+	if err := m.check(ctx, "MarkMailSent"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if o, ok := m.outbox[id]; ok {
+		o.Status = models.MailSent
+		o.LastError = ""
+		o.UpdatedAt = time.Now()
+		m.outbox[id] = o
+	}
+
+	return nil
+}
+
+// ScheduleMailRetry records why sending an email failed and when to try again
+func (m *memoryDBRepo) ScheduleMailRetry(ctx context.Context, id int, lastError string, at time.Time) error {
+	if err := m.check(ctx, "ScheduleMailRetry"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if o, ok := m.outbox[id]; ok {
+		o.NextAttemptAt = at
+		o.LastError = lastError
+		o.UpdatedAt = time.Now()
+		m.outbox[id] = o
+	}
+
+	return nil
+}
+
+// MarkMailDead gives up on an email after its last attempt failed, it stays listed until it is resent
+func (m *memoryDBRepo) MarkMailDead(ctx context.Context, id int, lastError string) error {
+	if err := m.check(ctx, "MarkMailDead"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if o, ok := m.outbox[id]; ok {
+		o.Status = models.MailDead
+		o.LastError = lastError
+		o.UpdatedAt = time.Now()
+		m.outbox[id] = o
+	}
+
+	return nil
+}
+
+// AllDeadMail returns the emails that could not be sent, most recently failed first
+func (m *memoryDBRepo) AllDeadMail(ctx context.Context) ([]models.OutboxMail, error) {
+	if err := m.check(ctx, "AllDeadMail"); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var mail []models.OutboxMail
+	for _, o := range m.outbox {
+		if o.Status == models.MailDead {
+			mail = append(mail, o)
+		}
+	}
+
+	sort.Slice(mail, func(i, j int) bool {
+		if !mail[i].UpdatedAt.Equal(mail[j].UpdatedAt) {
+			return mail[i].UpdatedAt.After(mail[j].UpdatedAt)
+		}
+		return mail[i].ID > mail[j].ID
+	})
+
+	return mail, nil
+}
+
+// ResendMail queues an email that could not be sent again, with a fresh set of attempts. It returns
+// sql.ErrNoRows unless the email is dead
+func (m *memoryDBRepo) ResendMail(ctx context.Context, id int) error {
+	if err := m.check(ctx, "ResendMail"); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.outbox[id]
+	if !ok || o.Status != models.MailDead {
+		return sql.ErrNoRows
+	}
+
+	o.Status = models.MailPending
+	o.Attempts = 0
+	o.NextAttemptAt = time.Now()
+	o.UpdatedAt = time.Now()
+	m.outbox[id] = o
+
+	return nil
+}
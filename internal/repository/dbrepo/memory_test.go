@@ -0,0 +1,458 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marif226/bookings/internal/config"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/repository"
+)
+
+func date(day int) time.Time {
+	return time.Date(2050, 1, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestMemoryRepo_Availability(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{}, nil)
+	ctx := context.Background()
+
+	_, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "John", StartDate: date(10), EndDate: date(12), RoomID: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name		string
+		start		time.Time
+		end			time.Time
+		available	bool
+	}{
+		{"before", date(8), date(10), true},
+		{"after", date(12), date(14), true},
+		{"same dates", date(10), date(12), false},
+		{"overlapping start", date(9), date(11), false},
+		{"overlapping end", date(11), date(13), false},
+		{"around", date(9), date(13), false},
+	}
+
+	for _, e := range tests {
+		available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, e.start, e.end, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if available != e.available {
+			t.Errorf("%s: expected available to be %t", e.name, e.available)
+		}
+
+		rooms, err := repo.SearchAvailabilityForAllRooms(ctx, e.start, e.end, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.available && len(rooms) != 2 || !e.available && (len(rooms) != 1 || rooms[0].ID != 2) {
+			t.Errorf("%s: unexpected available rooms %v", e.name, rooms)
+		}
+
+		_, err = repo.InsertReservation(ctx, models.Reservation{StartDate: e.start, EndDate: e.end, RoomID: 1}, nil)
+		if e.available && err != nil {
+			t.Errorf("%s: unexpected error %s", e.name, err)
+		} else if !e.available && !errors.Is(err, repository.ErrRoomUnavailable) {
+			t.Errorf("%s: expected ErrRoomUnavailable, got %v", e.name, err)
+		}
+	}
+
+	err = repo.InsertBlockForRoom(ctx, 1, date(11))
+	if !errors.Is(err, repository.ErrRoomUnavailable) {
+		t.Errorf("expected ErrRoomUnavailable blocking a booked day, got %v", err)
+	}
+
+	err = repo.InsertBlockForRoom(ctx, 1, date(14))
+	if err != nil {
+		t.Errorf("expected the day of departure to be free to block, got %v", err)
+	}
+
+	rooms, err := repo.SearchAvailabilityForAllRooms(ctx, date(20), date(21), 3)
+	if err != nil || len(rooms) != 0 {
+		t.Errorf("expected no room to sleep 3 guests, got %v, %v", rooms, err)
+	}
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{StartDate: date(20), EndDate: date(21), RoomID: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.DeleteReservation(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date(20), date(21), 2)
+	if !available {
+		t.Error("deleting a reservation should free its dates")
+	}
+
+	_, err = repo.InsertReservation(ctx, models.Reservation{StartDate: date(20), EndDate: date(21), RoomID: 3}, nil)
+	if err == nil {
+		t.Error("expected an error for a missing room")
+	}
+}
+
+func TestMemoryRepo_Users(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{}, nil)
+	ctx := context.Background()
+
+	id, err := repo.InsertUser(ctx, models.User{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com"}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.InsertUser(ctx, models.User{Email: "jane@example.com"}, "secret")
+	if !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Errorf("expected ErrDuplicateEmail, got %v", err)
+	}
+
+	authID, _, err := repo.Authenticate(ctx, "jane@example.com", "secret")
+	if err != nil || authID != id {
+		t.Errorf("expected to authenticate as %d, got %d, %v", id, authID, err)
+	}
+
+	_, _, err = repo.Authenticate(ctx, "jane@example.com", "wrong")
+	if err == nil {
+		t.Error("expected an error for a wrong password")
+	}
+
+	err = repo.SetUserActive(ctx, id, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = repo.Authenticate(ctx, "jane@example.com", "secret")
+	if err == nil {
+		t.Error("inactive users should not authenticate")
+	}
+}
+
+func TestMemoryRepo_FailureHook(t *testing.T) {
+	errBoom := errors.New("boom")
+	repo := NewMemoryRepo(&config.AppConfig{}, func(method string) error {
+		if method == "AllRooms" {
+			return errBoom
+		}
+		return nil
+	})
+
+	_, err := repo.AllRooms(context.Background())
+	if !errors.Is(err, errBoom) {
+		t.Errorf("expected hook error, got %v", err)
+	}
+
+	_, err = repo.GetRoomByID(context.Background(), 1)
+	if err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = repo.GetRoomByID(ctx, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMemoryRepo_ConcurrentBookings(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{}, nil)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	booked := 0
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.InsertReservation(context.Background(), models.Reservation{StartDate: date(1), EndDate: date(5), RoomID: 1}, nil)
+			if err == nil {
+				mu.Lock()
+				booked++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if booked != 1 {
+		t.Errorf("expected exactly one booking to succeed, got %d", booked)
+	}
+}
+
+func TestMemoryRepo_ChangeReservationDates(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{}, nil)
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "John", Email: "john@smith.com", StartDate: date(10), EndDate: date(12), RoomID: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.InsertReservation(ctx, models.Reservation{StartDate: date(20), EndDate: date(22), RoomID: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name			string
+		res				models.Reservation
+		expectedError	error
+	}{
+		{"overlapping itself", models.Reservation{ID: id, RoomID: 1, StartDate: date(11), EndDate: date(14)}, nil},
+		{"overlapping another stay", models.Reservation{ID: id, RoomID: 1, StartDate: date(18), EndDate: date(21)}, repository.ErrRoomUnavailable},
+		{"another room", models.Reservation{ID: id, RoomID: 2, StartDate: date(1), EndDate: date(2)}, sql.ErrNoRows},
+		{"missing reservation", models.Reservation{ID: id + 100, RoomID: 1, StartDate: date(1), EndDate: date(2)}, sql.ErrNoRows},
+	}
+
+	for _, e := range tests {
+		e.res.Quote = models.Quote{Currency: "USD", Total: 30000}
+		err := repo.ChangeReservationDates(ctx, e.res)
+		if !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expectedError, err)
+		}
+	}
+
+	res, err := repo.GetReservationByID(ctx, id)
+	if err != nil || !res.StartDate.Equal(date(11)) || !res.EndDate.Equal(date(14)) || res.Quote.Total != 30000 {
+		t.Errorf("expected the reservation to be moved to the 11th - 14th, got %+v, %v", res, err)
+	}
+
+	available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date(10), date(11), 1)
+	if !available {
+		t.Error("moving a reservation should free its old dates")
+	}
+
+	available, _ = repo.SearchAvailabilityByDatesByRoomID(ctx, date(13), date(14), 1)
+	if available {
+		t.Error("moving a reservation should take its new dates")
+	}
+}
+
+func TestMemoryRepo_ReservationStatus(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{}, nil)
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "John", StartDate: date(10), EndDate: date(12), RoomID: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := repo.AllNewReservations(ctx)
+	if err != nil || len(pending) != 1 || pending[0].Status != models.StatusPending {
+		t.Errorf("expected the new reservation to be pending, got %+v, %v", pending, err)
+	}
+
+	tests := []struct {
+		name			string
+		id				int
+		status			models.ReservationStatus
+		expectedError	error
+	}{
+		{"skipping a step", id, models.StatusCheckedOut, repository.ErrInvalidTransition},
+		{"confirm", id, models.StatusConfirmed, nil},
+		{"cancel", id, models.StatusCancelled, nil},
+		{"after cancelling", id, models.StatusConfirmed, repository.ErrInvalidTransition},
+		{"missing reservation", id + 100, models.StatusConfirmed, sql.ErrNoRows},
+	}
+
+	for _, e := range tests {
+		err := repo.UpdateReservationStatus(ctx, e.id, e.status)
+		if !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expectedError, err)
+		}
+	}
+
+	res, err := repo.GetReservationByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != models.StatusCancelled || len(res.StatusChanges) != 2 ||
+		res.StatusChanges[0].FromStatus != models.StatusPending || res.StatusChanges[1].ToStatus != models.StatusCancelled {
+		t.Errorf("expected the reservation to be cancelled after being confirmed, got %s %+v", res.Status, res.StatusChanges)
+	}
+
+	cancelled, err := repo.AllReservations(ctx, models.StatusCancelled)
+	if err != nil || len(cancelled) != 1 {
+		t.Errorf("expected the cancelled reservation to be kept, got %+v, %v", cancelled, err)
+	}
+
+	available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date(10), date(12), 1)
+	if !available {
+		t.Error("cancelling a reservation should free its dates")
+	}
+
+	err = repo.ChangeReservationDates(ctx, models.Reservation{ID: id, RoomID: 1, StartDate: date(14), EndDate: date(16)})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows moving a cancelled reservation, got %v", err)
+	}
+
+	err = repo.DeleteReservation(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryRepo_RatePlans(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{}, nil)
+	ctx := context.Background()
+
+	plan, err := repo.GetRatePlanByRoomID(ctx, 2)
+	if err != nil || plan.NightlyRate != 9500 {
+		t.Fatalf("expected the seeded plan of room 2, got %+v, %v", plan, err)
+	}
+
+	plan.Seasons = []models.RateSeason{
+		{Name: "Summer", StartDate: date(20), EndDate: date(25), NightlyRate: 20000},
+		{Name: "Spring", StartDate: date(1), EndDate: date(5), NightlyRate: 17000},
+	}
+
+	err = repo.SaveRatePlan(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ := repo.GetRatePlanByRoomID(ctx, 2)
+	if saved.ID != plan.ID || len(saved.Seasons) != 2 || saved.Seasons[0].Name != "Spring" {
+		t.Errorf("unexpected saved plan %+v", saved)
+	}
+
+	err = repo.SaveRatePlan(ctx, models.RatePlan{RoomID: 3})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing room, got %v", err)
+	}
+
+	err = repo.DeleteRoom(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.GetRatePlanByRoomID(ctx, 2)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the plan to be deleted with its room, got %v", err)
+	}
+}
+
+func TestMemoryRepo_RoomICalToken(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{}, nil)
+	ctx := context.Background()
+
+	token, err := repo.GetRoomICalToken(ctx, 2)
+	if err != nil || token != "" {
+		t.Fatalf("expected the calendar feed of room 2 to be off, got %q, %v", token, err)
+	}
+
+	err = repo.SetRoomICalToken(ctx, 2, "feed-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _ = repo.GetRoomICalToken(ctx, 2)
+	if token != "feed-token" {
+		t.Errorf("expected the saved calendar token, got %q", token)
+	}
+
+	err = repo.DeleteRoom(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.GetRoomICalToken(ctx, 2)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a deleted room, got %v", err)
+	}
+}
+
+func TestMemoryRepo_StayRules(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{}, nil)
+	ctx := context.Background()
+
+	rules := []models.StayRule{
+		{Name: "Summer", StartDate: date(20), EndDate: date(25), MinNights: 3},
+		{Name: "All year", MaxNights: 14},
+	}
+
+	err := repo.SaveStayRules(ctx, 2, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := repo.GetStayRulesByRoomID(ctx, 2)
+	if err != nil || len(saved) != 2 || saved[0].Name != "All year" || saved[1].RoomID != 2 {
+		t.Errorf("expected the rules for all year first, got %+v, %v", saved, err)
+	}
+
+	err = repo.SaveStayRules(ctx, 3, rules)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing room, got %v", err)
+	}
+
+	err = repo.DeleteRoom(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ = repo.GetStayRulesByRoomID(ctx, 2)
+	if len(saved) != 0 {
+		t.Errorf("expected the rules to be deleted with their room, got %+v", saved)
+	}
+}
+
+func TestMemoryRepo_Outbox(t *testing.T) {
+	repo := NewMemoryRepo(&config.AppConfig{}, nil)
+	ctx := context.Background()
+
+	_, err := repo.InsertReservation(ctx, models.Reservation{StartDate: date(1), EndDate: date(3), RoomID: 1}, func(res models.Reservation) []models.MailData {
+		return []models.MailData{{To: "john@smith.com", Subject: fmt.Sprintf("Reservation %d", res.ID)}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail, err := repo.ClaimMail(ctx, 10, time.Minute)
+	if err != nil || len(mail) != 1 || mail[0].Mail.Subject != "Reservation 1" {
+		t.Fatalf("expected the confirmation of the new reservation, got %+v, %v", mail, err)
+	}
+
+	err = repo.ScheduleMailRetry(ctx, mail[0].ID, "connection refused", time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail, err = repo.ClaimMail(ctx, 10, time.Minute)
+	if err != nil || len(mail) != 1 || mail[0].Attempts != 2 || mail[0].LastError != "connection refused" {
+		t.Fatalf("expected the email to be due again, got %+v, %v", mail, err)
+	}
+
+	err = repo.MarkMailDead(ctx, mail[0].ID, "mailbox unavailable")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dead, err := repo.AllDeadMail(ctx)
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("expected one dead email, got %+v, %v", dead, err)
+	}
+
+	err = repo.ResendMail(ctx, dead[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.ResendMail(ctx, dead[0].ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows resending an email twice, got %v", err)
+	}
+}
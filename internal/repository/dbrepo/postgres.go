@@ -2,30 +2,123 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
-	return true
+// AllUsers returns a slice of all users
+func (m *postgresDBRepo) AllUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var users []models.User
+
+	query := `SELECT id, first_name, last_name, email, access_level, active, created_at, updated_at
+		FROM users ORDER BY last_name, first_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return users, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.User
+		err := rows.Scan(
+			&u.ID,
+			&u.FirstName,
+			&u.LastName,
+			&u.Email,
+			&u.AccessLevel,
+			&u.Active,
+			&u.CreatedAt,
+			&u.UpdatedAt,
+		)
+
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
 }
 
 
-// InsertReservation inserts reservation into the database
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// InsertReservation books a room: in one transaction it checks the dates are still free and inserts
+// the reservation together with its room restriction and the emails returned by mail, so that they
+// are queued if and only if the booking is made. It returns repository.ErrRoomUnavailable if the
+// room has been taken in the meantime
+func (m *postgresDBRepo) InsertReservation(ctx context.Context, res models.Reservation, mail repository.MailFunc) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = lockRoom(ctx, tx, res.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := bookRoom(ctx, tx, res, mail)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// bookRoom checks inside tx that the dates of res are free and inserts the reservation together
+// with its room restriction and the emails returned by mail, which may be nil; the caller must
+// have locked the room
+func bookRoom(ctx context.Context, tx *sql.Tx, res models.Reservation, mail repository.MailFunc) (int, error) {
+	var numRows int
+
+	query := `SELECT COUNT(id) FROM room_restrictions WHERE room_id = $1 and $2 < end_date and $3 > start_date;`
+	err := tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate).Scan(&numRows)
+	if err != nil {
+		return 0, err
+	}
+
+	if numRows > 0 {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	quote, err := encodeQuoteLines(res.Quote.Lines)
+	if err != nil {
+		return 0, err
+	}
+
 	var newID int
 
 	state := `INSERT INTO Reservations (first_name, last_name, email, phone, start_date,
-		end_date, room_id, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING ID;`
+		end_date, room_id, adults, children, currency, total_price, quote, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING ID;`
 
-	err := m.DB.QueryRowContext(ctx, state,
+	err = tx.QueryRowContext(ctx, state,
 		res.FirstName,
 		res.LastName,
 		res.Email,
@@ -33,6 +126,11 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
+		res.Adults,
+		res.Children,
+		res.Quote.Currency,
+		res.Quote.Total,
+		quote,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -41,38 +139,127 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		return 0, err
 	}
 
+	state = `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id,
+		created_at, updated_at, restriction_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`
+
+	_, err = tx.ExecContext(ctx, state,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		newID,
+		time.Now(),
+		time.Now(),
+		models.RestrictionReservation,
+	)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if mail != nil {
+		res.ID = newID
+		for _, msg := range mail(res) {
+			err = enqueueMail(ctx, tx, msg)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
 	return newID, nil
 }
 
-// InsertRoomRestriction inserts a room restriction into the database
-func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// ChangeReservationDates moves a reservation and its room restriction to res.StartDate and res.EndDate
+// and stores res.Quote with it. It returns repository.ErrRoomUnavailable if the room is taken on any of
+// the new dates and sql.ErrNoRows if there is no pending or confirmed reservation res.ID for res.RoomID
+func (m *postgresDBRepo) ChangeReservationDates(ctx context.Context, res models.Reservation) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	state := `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id,
-		created_at, updated_at, restriction_id)
-		VALUES ($1, $2, $3, $4, $5, $6, $7);`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	_, err := m.DB.ExecContext(ctx, state,
-		r.StartDate,
-		r.EndDate,
-		r.RoomID,
-		r.ReservationID,
-		time.Now(),
+	err = lockRoom(ctx, tx, res.RoomID)
+	if err != nil {
+		return err
+	}
+
+	err = changeDates(ctx, tx, res)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// changeDates checks inside tx that the new dates of res are free apart from res itself and moves the
+// reservation together with its room restriction; the caller must have locked the room
+func changeDates(ctx context.Context, tx *sql.Tx, res models.Reservation) error {
+	var numRows int
+
+	query := `SELECT COUNT(id) FROM room_restrictions WHERE room_id = $1 and $2 < end_date and $3 > start_date
+		and (reservation_id IS NULL OR reservation_id <> $4);`
+	err := tx.QueryRowContext(ctx, query, res.RoomID, res.StartDate, res.EndDate, res.ID).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	if numRows > 0 {
+		return repository.ErrRoomUnavailable
+	}
+
+	quote, err := encodeQuoteLines(res.Quote.Lines)
+	if err != nil {
+		return err
+	}
+
+	state := `UPDATE reservations SET start_date = $1, end_date = $2, currency = $3, total_price = $4, quote = $5,
+		updated_at = $6 WHERE id = $7 AND room_id = $8 AND status IN ($9, $10);`
+
+	result, err := tx.ExecContext(ctx, state,
+		res.StartDate,
+		res.EndDate,
+		res.Quote.Currency,
+		res.Quote.Total,
+		quote,
 		time.Now(),
-		r.RestrictionID,
+		res.ID,
+		res.RoomID,
+		models.StatusPending,
+		models.StatusConfirmed,
 	)
 
 	if err != nil {
 		return err
 	}
-	
-	return nil
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	state = `UPDATE room_restrictions SET start_date = $1, end_date = $2, updated_at = $3 WHERE reservation_id = $4;`
+
+	_, err = tx.ExecContext(ctx, state, res.StartDate, res.EndDate, time.Now(), res.ID)
+
+	return err
+}
+
+// lockRoom locks the row of a room until tx ends, so that restrictions for the room are
+// checked and inserted by one transaction at a time
+func lockRoom(ctx context.Context, tx *sql.Tx, roomID int) error {
+	var id int
+	return tx.QueryRowContext(ctx, `SELECT id FROM rooms WHERE id = $1 FOR UPDATE;`, roomID).Scan(&id)
 }
 
 // SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false if not
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `SELECT COUNT(id) FROM room_restrictions WHERE room_id = $1 and $2 < end_date and $3 > start_date;`
@@ -81,7 +268,7 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
 	err := row.Scan(&numRows)
 	if err != nil {
-		return false, nil
+		return false, err
 	}
 
 	if numRows == 0 {
@@ -91,26 +278,30 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 	return false, nil
 }
 
-// SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// SearchAvailabilityForAllRooms returns the rooms sleeping at least guests that are available for the given date range
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time, guests int) ([]models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var rooms []models.Room
 
-	query := `SELECT r.id, r.room_name FROM rooms r WHERE r.id NOT IN (
-		SELECT rr.room_id FROM room_restrictions rr WHERE $1 < rr.end_date and $2 > rr.start_date);`
+	query := `SELECT r.id, r.room_name, r.max_occupancy FROM rooms r WHERE r.max_occupancy >= $3 AND r.id NOT IN (
+		SELECT rr.room_id FROM room_restrictions rr WHERE $1 < rr.end_date and $2 > rr.start_date)
+		ORDER BY r.id;`
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	rows, err := m.DB.QueryContext(ctx, query, start, end, guests)
 	if err != nil {
 		return rooms, err
 	}
 
+	defer rows.Close()
+
 	for rows.Next() {
 		var room models.Room
 		err := rows.Scan(
 			&room.ID,
 			&room.RoomName,
+			&room.MaxOccupancy,
 		)
 
 		if err != nil {
@@ -127,21 +318,39 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 	return rooms, nil
 }
 
-// GetRoomByID gets room by id
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// GetRoomByID gets room by id together with its photos
+func (m *postgresDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var room models.Room
-	query := `SELECT id, room_name, created_at, updated_at FROM rooms WHERE id = $1;`
-	row := m.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(
-		&room.ID,
-		&room.RoomName,
-		&room.CreatedAt,
-		&room.UpdatedAt,
-	)
+	query := `SELECT ` + roomColumns + ` FROM rooms WHERE id = $1;`
+
+	room, err := scanRoom(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return room, err
+	}
+
+	room.Photos, err = m.roomPhotos(ctx, room.ID)
+	if err != nil {
+		return room, err
+	}
+
+	return room, nil
+}
+
+// GetRoomBySlug gets room by slug together with its photos
+func (m *postgresDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + roomColumns + ` FROM rooms WHERE slug = $1;`
+
+	room, err := scanRoom(m.DB.QueryRowContext(ctx, query, slug))
+	if err != nil {
+		return room, err
+	}
 
+	room.Photos, err = m.roomPhotos(ctx, room.ID)
 	if err != nil {
 		return room, err
 	}
@@ -149,12 +358,13 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 	return room, nil
 }
 
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// GetUserByID returns a user by id
+func (m *postgresDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `SELECT id, first_name, email, password, access_level, created_at, updated_at
-		FROM user WHERE id = $1`
+	query := `SELECT id, first_name, last_name, email, password, access_level, active, created_at, updated_at
+		FROM users WHERE id = $1`
 	
 	row := m.DB.QueryRowContext(ctx, query, id)
 
@@ -166,6 +376,37 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 		&u.Email,
 		&u.Password,
 		&u.AccessLevel,
+		&u.Active,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+	)
+
+	if err != nil {
+		return u, err
+	}
+
+	return u, nil
+}
+
+// GetUserByEmail returns a user by email address
+func (m *postgresDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, first_name, last_name, email, password, access_level, active, created_at, updated_at
+		FROM users WHERE email = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, email)
+
+	var u models.User
+	err := row.Scan(
+		&u.ID,
+		&u.FirstName,
+		&u.LastName,
+		&u.Email,
+		&u.Password,
+		&u.AccessLevel,
+		&u.Active,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
@@ -178,11 +419,12 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 }
 
 // UpdateUser updates user in database
-func (m *postgresDBRepo) UpdateUser(u models.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `UPDATE users SET first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5`
+	query := `UPDATE users SET first_name = $1, last_name = $2, email = $3, access_level = $4, updated_at = $5
+		WHERE id = $6`
 
 	_, err := m.DB.ExecContext(ctx, query,
 		&u.FirstName,
@@ -190,103 +432,138 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 		&u.Email,
 		&u.AccessLevel,
 		time.Now(),
+		&u.ID,
 	)
 
 	if err != nil {
-		return err
+		return duplicateEmailError(err)
 	}
 
 	return nil
 }
 
-// Authenticate authenticates user
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// InsertUser inserts a user with a bcrypt hash of password into the database
+func (m *postgresDBRepo) InsertUser(ctx context.Context, u models.User, password string) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	// store info from database
-	var id int
-	var hashedPassword string
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+
+	query := `INSERT INTO users (first_name, last_name, email, password, access_level, active,
+		created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;`
+
+	err = m.DB.QueryRowContext(ctx, query,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		string(hashedPassword),
+		u.AccessLevel,
+		true,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
 
-	row := m.DB.QueryRowContext(ctx, "SELECT id, password FROM users WHERE email = $1", email)
-	err := row.Scan(&id, &hashedPassword)
 	if err != nil {
-		return id, "", err
+		return 0, duplicateEmailError(err)
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
-	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return 0, "", errors.New("incorrect password!")
-	} else if err != nil {
-		return 0, "", nil
+	return newID, nil
+}
+
+// UpdatePassword replaces the password of a user with a bcrypt hash of password
+func (m *postgresDBRepo) UpdatePassword(ctx context.Context, id int, password string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
 	}
 
-	return id, hashedPassword, nil
+	query := `UPDATE users SET password = $1, updated_at = $2 WHERE id = $3`
+
+	_, err = m.DB.ExecContext(ctx, query, string(hashedPassword), time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
-// AllReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// SetUserActive activates or deactivates a user
+func (m *postgresDBRepo) SetUserActive(ctx context.Context, id int, active bool) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var reservations []models.Reservation
+	query := `UPDATE users SET active = $1, updated_at = $2 WHERE id = $3`
 
-	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
-		r.room_id, r.created_at, r.updated_at, r.processed,
-		rm.id, rm.room_name FROM reservations r LEFT JOIN rooms rm ON (r.room_id = rm.id) ORDER BY r.start_date ASC`
+	_, err := m.DB.ExecContext(ctx, query, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	return nil
+}
+
+// DeleteUser deletes one user by id
+func (m *postgresDBRepo) DeleteUser(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `DELETE FROM users WHERE id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
 	if err != nil {
-		return reservations, err
+		return err
 	}
 
-	defer rows.Close()
+	return nil
+}
 
-	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Processed,
-			&i.Room.ID,
-			&i.Room.RoomName,
-		)
+// Authenticate authenticates user
+func (m *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
 
-		if err != nil {
-			return reservations, err
-		}
+	// store info from database
+	var id int
+	var hashedPassword string
 
-		reservations = append(reservations, i)
+	row := m.DB.QueryRowContext(ctx, "SELECT id, password FROM users WHERE email = $1 AND active = true", email)
+	err := row.Scan(&id, &hashedPassword)
+	if err != nil {
+		return id, "", err
 	}
 
-	if err = rows.Err(); err != nil {
-		return reservations, err
+	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return 0, "", errors.New("incorrect password!")
+	} else if err != nil {
+		return 0, "", err
 	}
 
-	return reservations, nil
+	return id, hashedPassword, nil
 }
 
-// AllNewReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// AllReservations returns a slice of all reservations in status, or of every reservation if status is empty
+func (m *postgresDBRepo) AllReservations(ctx context.Context, status models.ReservationStatus) ([]models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var reservations []models.Reservation
 
 	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date,
-		r.room_id, r.created_at, r.updated_at, 
-		rm.id, rm.room_name FROM reservations r LEFT JOIN rooms rm ON (r.room_id = rm.id) 
-		WHERE processed = 0 ORDER BY r.start_date ASC`
+		r.room_id, r.adults, r.children, r.created_at, r.updated_at, r.status,
+		rm.id, rm.room_name FROM reservations r LEFT JOIN rooms rm ON (r.room_id = rm.id)
+		WHERE $1 = '' OR r.status = $1 ORDER BY r.start_date ASC`
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, status)
 	if err != nil {
 		return reservations, err
 	}
@@ -304,8 +581,11 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			&i.StartDate,
 			&i.EndDate,
 			&i.RoomID,
+			&i.Adults,
+			&i.Children,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Status,
 			&i.Room.ID,
 			&i.Room.RoomName,
 		)
@@ -324,15 +604,22 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 	return reservations, nil
 }
 
-// GetReservationByID returns one reservation by id
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// AllNewReservations returns a slice of all pending reservations
+func (m *postgresDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	return m.AllReservations(ctx, models.StatusPending)
+}
+
+// GetReservationByID returns one reservation by id together with the history of its status
+func (m *postgresDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var res models.Reservation
+	var quote string
 
 	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date,
-		r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
+		r.end_date, r.room_id, r.adults, r.children, r.created_at, r.updated_at, r.status,
+		r.currency, r.total_price, r.quote,
 		rm.id, rm.room_name FROM reservations r LEFT JOIN rooms rm ON (r.room_id = rm.id)
 		WHERE r.id = $1;`
 
@@ -346,9 +633,14 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.StartDate,
 		&res.EndDate,
 		&res.RoomID,
+		&res.Adults,
+		&res.Children,
 		&res.CreatedAt,
 		&res.UpdatedAt,
-		&res.Processed,
+		&res.Status,
+		&res.Quote.Currency,
+		&res.Quote.Total,
+		&quote,
 		&res.Room.ID,
 		&res.Room.RoomName,
 	)
@@ -357,12 +649,48 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		return res, err
 	}
 
-	return res, nil
-}
-
+	res.Quote.Lines, err = decodeQuoteLines(quote)
+	if err != nil {
+		return res, err
+	}
+
+	query = `SELECT id, reservation_id, from_status, to_status, created_at
+		FROM reservation_status_changes WHERE reservation_id = $1 ORDER BY created_at, id;`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return res, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.StatusChange
+		err := rows.Scan(
+			&c.ID,
+			&c.ReservationID,
+			&c.FromStatus,
+			&c.ToStatus,
+			&c.CreatedAt,
+		)
+
+		if err != nil {
+			return res, err
+		}
+
+		res.StatusChanges = append(res.StatusChanges, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
 // UpdateReservation updates reservation in database
-func (m *postgresDBRepo) UpdateReservation(u models.Reservation) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	query := `UPDATE reservations SET first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5
@@ -384,32 +712,1139 @@ func (m *postgresDBRepo) UpdateReservation(u models.Reservation) error {
 	return nil
 }
 
-// DeleteReservation deletes one reservation by id
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// DeleteReservation deletes one reservation by id together with its room restrictions
+func (m *postgresDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `DELETE FROM reservations WHERE id = $1;`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	_, err = tx.ExecContext(ctx, `DELETE FROM room_restrictions WHERE reservation_id = $1;`, id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = tx.ExecContext(ctx, `DELETE FROM reservation_status_changes WHERE reservation_id = $1;`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM reservations WHERE id = $1;`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateReservationStatus moves a reservation to status and records the change. It returns
+// repository.ErrInvalidTransition if the reservation cannot move there from its current status.
+// Cancelling a reservation frees its room but keeps the reservation
+func (m *postgresDBRepo) UpdateReservationStatus(ctx context.Context, id int, status models.ReservationStatus) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var from models.ReservationStatus
+
+	err = tx.QueryRowContext(ctx, `SELECT status FROM reservations WHERE id = $1;`, id).Scan(&from)
+	if err != nil {
+		return err
+	}
+
+	if !from.CanBecome(status) {
+		return repository.ErrInvalidTransition
+	}
+
+	// the status must not have changed since it was read, else the transition may no longer be allowed
+	result, err := tx.ExecContext(ctx, `UPDATE reservations SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4;`,
+		status, time.Now(), id, from)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return repository.ErrInvalidTransition
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO reservation_status_changes (reservation_id, from_status, to_status, created_at)
+		VALUES ($1, $2, $3, $4);`, id, from, status, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if status == models.StatusCancelled {
+		_, err = tx.ExecContext(ctx, `DELETE FROM room_restrictions WHERE reservation_id = $1;`, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AllRooms returns all rooms ordered by name, together with their photos
+func (m *postgresDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `SELECT ` + roomColumns + ` FROM rooms ORDER BY room_name;`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		rm, err := scanRoom(rows)
+		if err != nil {
+			return rooms, err
+		}
+
+		rooms = append(rooms, rm)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+	rows.Close()
+
+	for i := range rooms {
+		rooms[i].Photos, err = m.roomPhotos(ctx, rooms[i].ID)
+		if err != nil {
+			return rooms, err
+		}
+	}
+
+	return rooms, nil
+}
+
+// InsertRoom inserts a room together with its photos and returns its id
+func (m *postgresDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+
+	query := `INSERT INTO rooms (room_name, slug, description, max_occupancy, bed_configuration, amenities,
+		created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;`
+
+	err = tx.QueryRowContext(ctx, query,
+		room.RoomName,
+		room.Slug,
+		room.Description,
+		room.MaxOccupancy,
+		room.BedConfiguration,
+		strings.Join(room.Amenities, "\n"),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, duplicateSlugError(err)
+	}
+
+	err = insertRoomPhotos(ctx, tx, newID, room.Photos)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateRoom updates a room and replaces its photos
+func (m *postgresDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE rooms SET room_name = $1, slug = $2, description = $3, max_occupancy = $4,
+		bed_configuration = $5, amenities = $6, updated_at = $7
+		WHERE id = $8;`
+
+	_, err = tx.ExecContext(ctx, query,
+		room.RoomName,
+		room.Slug,
+		room.Description,
+		room.MaxOccupancy,
+		room.BedConfiguration,
+		strings.Join(room.Amenities, "\n"),
+		time.Now(),
+		room.ID,
+	)
+
+	if err != nil {
+		return duplicateSlugError(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM room_photos WHERE room_id = $1;`, room.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertRoomPhotos(ctx, tx, room.ID, room.Photos)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteRoom deletes a room with its photos and rate plan, it returns repository.ErrRoomInUse
+// while the room still has reservations or blocks
+func (m *postgresDBRepo) DeleteRoom(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var numRows int
+
+	query := `SELECT (SELECT COUNT(id) FROM reservations WHERE room_id = $1)
+		+ (SELECT COUNT(id) FROM room_restrictions WHERE room_id = $1);`
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	if numRows > 0 {
+		return repository.ErrRoomInUse
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM room_photos WHERE room_id = $1;`, id)
+	if err != nil {
+		return err
+	}
+
+	// the seasons of the plan are deleted with it
+	_, err = tx.ExecContext(ctx, `DELETE FROM rate_plans WHERE room_id = $1;`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM stay_rules WHERE room_id = $1;`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM rooms WHERE id = $1;`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetRoomICalToken returns the token of the iCal feed of a room, empty while the feed is off
+func (m *postgresDBRepo) GetRoomICalToken(ctx context.Context, roomID int) (string, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var token string
+
+	err := m.DB.QueryRowContext(ctx, `SELECT ical_token FROM rooms WHERE id = $1;`, roomID).Scan(&token)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
 }
 
-// UpdateProcessedForReservation updates processed for reservation by id
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// SetRoomICalToken replaces the token of the iCal feed of a room, an empty token turns the feed off
+func (m *postgresDBRepo) SetRoomICalToken(ctx context.Context, roomID int, token string) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	query := `UPDATE reservations SET processed = $ 1 WHERE id = $2;`
+	query := `UPDATE rooms SET ical_token = $1, updated_at = $2 WHERE id = $3;`
 
-	_, err := m.DB.ExecContext(ctx, query, processed, id)
+	_, err := m.DB.ExecContext(ctx, query, token, time.Now(), roomID)
 	if err != nil {
 		return err
 	}
 
 	return nil
-} 
\ No newline at end of file
+}
+
+// roomPhotos returns the photos of a room in gallery order
+func (m *postgresDBRepo) roomPhotos(ctx context.Context, roomID int) ([]models.RoomPhoto, error) {
+	var photos []models.RoomPhoto
+
+	query := `SELECT id, room_id, url, caption, position, created_at, updated_at
+		FROM room_photos WHERE room_id = $1 ORDER BY position, id;`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return photos, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.RoomPhoto
+		err := rows.Scan(
+			&p.ID,
+			&p.RoomID,
+			&p.URL,
+			&p.Caption,
+			&p.Position,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+
+		if err != nil {
+			return photos, err
+		}
+
+		photos = append(photos, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return photos, err
+	}
+
+	return photos, nil
+}
+
+// insertRoomPhotos inserts the photos of a room inside tx, numbering their positions in slice order
+func insertRoomPhotos(ctx context.Context, tx *sql.Tx, roomID int, photos []models.RoomPhoto) error {
+	query := `INSERT INTO room_photos (room_id, url, caption, position, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6);`
+
+	for i, p := range photos {
+		_, err := tx.ExecContext(ctx, query, roomID, p.URL, p.Caption, i, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetRatePlanByRoomID returns the rate plan of a room together with its seasons ordered by start date,
+// it returns sql.ErrNoRows if the room has no rate plan
+func (m *postgresDBRepo) GetRatePlanByRoomID(ctx context.Context, roomID int) (models.RatePlan, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var plan models.RatePlan
+
+	query := `SELECT id, room_id, currency, nightly_rate, weekend_rate, included_guests, extra_guest_rate,
+		created_at, updated_at
+		FROM rate_plans WHERE room_id = $1;`
+
+	err := m.DB.QueryRowContext(ctx, query, roomID).Scan(
+		&plan.ID,
+		&plan.RoomID,
+		&plan.Currency,
+		&plan.NightlyRate,
+		&plan.WeekendRate,
+		&plan.IncludedGuests,
+		&plan.ExtraGuestRate,
+		&plan.CreatedAt,
+		&plan.UpdatedAt,
+	)
+
+	if err != nil {
+		return plan, err
+	}
+
+	query = `SELECT id, rate_plan_id, name, start_date, end_date, nightly_rate, weekend_rate, created_at, updated_at
+		FROM rate_seasons WHERE rate_plan_id = $1 ORDER BY start_date, id;`
+
+	rows, err := m.DB.QueryContext(ctx, query, plan.ID)
+	if err != nil {
+		return plan, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.RateSeason
+		err := rows.Scan(
+			&s.ID,
+			&s.RatePlanID,
+			&s.Name,
+			&s.StartDate,
+			&s.EndDate,
+			&s.NightlyRate,
+			&s.WeekendRate,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+		)
+
+		if err != nil {
+			return plan, err
+		}
+
+		plan.Seasons = append(plan.Seasons, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return plan, err
+	}
+
+	return plan, nil
+}
+
+// SaveRatePlan creates or replaces the rate plan of plan.RoomID together with its seasons
+func (m *postgresDBRepo) SaveRatePlan(ctx context.Context, plan models.RatePlan) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var planID int
+
+	query := `INSERT INTO rate_plans (room_id, currency, nightly_rate, weekend_rate, included_guests,
+		extra_guest_rate, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (room_id) DO UPDATE SET currency = excluded.currency, nightly_rate = excluded.nightly_rate,
+		weekend_rate = excluded.weekend_rate, included_guests = excluded.included_guests,
+		extra_guest_rate = excluded.extra_guest_rate, updated_at = excluded.updated_at
+		RETURNING id;`
+
+	err = tx.QueryRowContext(ctx, query,
+		plan.RoomID,
+		plan.Currency,
+		plan.NightlyRate,
+		plan.WeekendRate,
+		plan.IncludedGuests,
+		plan.ExtraGuestRate,
+		time.Now(),
+		time.Now(),
+	).Scan(&planID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM rate_seasons WHERE rate_plan_id = $1;`, planID)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO rate_seasons (rate_plan_id, name, start_date, end_date, nightly_rate, weekend_rate,
+		created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`
+
+	for _, s := range plan.Seasons {
+		_, err = tx.ExecContext(ctx, query,
+			planID,
+			s.Name,
+			s.StartDate,
+			s.EndDate,
+			s.NightlyRate,
+			s.WeekendRate,
+			time.Now(),
+			time.Now(),
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetStayRulesByRoomID returns the stay rules of a room, the ones for all year first
+func (m *postgresDBRepo) GetStayRulesByRoomID(ctx context.Context, roomID int) ([]models.StayRule, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var rules []models.StayRule
+
+	query := `SELECT id, room_id, name, start_date, end_date, min_nights, max_nights, closed_to_arrival,
+		closed_to_departure, lead_days, created_at, updated_at
+		FROM stay_rules WHERE room_id = $1 ORDER BY start_date IS NOT NULL, start_date, id;`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return rules, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.StayRule
+		var start, end sql.NullTime
+		err := rows.Scan(
+			&rule.ID,
+			&rule.RoomID,
+			&rule.Name,
+			&start,
+			&end,
+			&rule.MinNights,
+			&rule.MaxNights,
+			&rule.ClosedToArrival,
+			&rule.ClosedToDeparture,
+			&rule.LeadDays,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+		)
+
+		if err != nil {
+			return rules, err
+		}
+
+		rule.StartDate, rule.EndDate = start.Time, end.Time
+		rules = append(rules, rule)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// SaveStayRules replaces the stay rules of a room
+func (m *postgresDBRepo) SaveStayRules(ctx context.Context, roomID int, rules []models.StayRule) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM stay_rules WHERE room_id = $1;`, roomID)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO stay_rules (room_id, name, start_date, end_date, min_nights, max_nights,
+		closed_to_arrival, closed_to_departure, lead_days, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`
+
+	for _, rule := range rules {
+		_, err = tx.ExecContext(ctx, query,
+			roomID,
+			rule.Name,
+			nullDate(rule.StartDate),
+			nullDate(rule.EndDate),
+			rule.MinNights,
+			rule.MaxNights,
+			int(rule.ClosedToArrival),
+			int(rule.ClosedToDeparture),
+			rule.LeadDays,
+			time.Now(),
+			time.Now(),
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// nullDate stores a zero date as NULL
+func nullDate(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// GetRestrictionsForRoomByDate returns restrictions for a room overlapping the given date range
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `SELECT id, COALESCE(reservation_id, 0), restriction_id, room_id, start_date, end_date
+		FROM room_restrictions WHERE $1 < end_date AND $2 >= start_date AND room_id = $3;`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID)
+	if err != nil {
+		return restrictions, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+		err := rows.Scan(
+			&r.ID,
+			&r.ReservationID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.StartDate,
+			&r.EndDate,
+		)
+
+		if err != nil {
+			return restrictions, err
+		}
+
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+
+	return restrictions, nil
+}
+
+// InsertBlockForRoom inserts a one-day owner block for a room, returning repository.ErrRoomUnavailable
+// if the day is already booked or blocked
+func (m *postgresDBRepo) InsertBlockForRoom(ctx context.Context, roomID int, startDate time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockRoom(ctx, tx, roomID)
+	if err != nil {
+		return err
+	}
+
+	err = insertBlock(ctx, tx, roomID, startDate)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertBlock checks inside tx that the day is free and inserts a one-day owner block for a room; the
+// caller must have locked the room
+func insertBlock(ctx context.Context, tx *sql.Tx, roomID int, startDate time.Time) error {
+	var numRows int
+
+	query := `SELECT COUNT(id) FROM room_restrictions WHERE room_id = $1 and $2 < end_date and $3 > start_date;`
+	err := tx.QueryRowContext(ctx, query, roomID, startDate, startDate.AddDate(0, 0, 1)).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	if numRows > 0 {
+		return repository.ErrRoomUnavailable
+	}
+
+	query = `INSERT INTO room_restrictions (start_date, end_date, room_id, restriction_id,
+		created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6);`
+
+	_, err = tx.ExecContext(ctx, query,
+		startDate,
+		startDate.AddDate(0, 0, 1),
+		roomID,
+		models.RestrictionOwnerBlock,
+		time.Now(),
+		time.Now(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteBlockByID deletes an owner block by id
+func (m *postgresDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `DELETE FROM room_restrictions WHERE id = $1 AND restriction_id = $2;`
+
+	_, err := m.DB.ExecContext(ctx, query, id, models.RestrictionOwnerBlock)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AllAPITokens returns all API tokens with their owners, newest first
+func (m *postgresDBRepo) AllAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var tokens []models.APIToken
+
+	query := `SELECT t.id, t.user_id, t.name, t.scopes, t.last_used_at, t.revoked_at, t.created_at, t.updated_at,
+		u.id, u.first_name, u.last_name, u.email, u.access_level, u.active
+		FROM api_tokens t LEFT JOIN users u ON (t.user_id = u.id)
+		ORDER BY t.created_at DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return tokens, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return tokens, err
+		}
+
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tokens, err
+	}
+
+	return tokens, nil
+}
+
+// InsertAPIToken inserts a new API token and returns its id
+func (m *postgresDBRepo) InsertAPIToken(ctx context.Context, t models.APIToken) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+
+	query := `INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;`
+
+	err := m.DB.QueryRowContext(ctx, query,
+		t.UserID,
+		t.Name,
+		t.TokenHash,
+		strings.Join(t.Scopes, ","),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetAPITokenByID returns an API token by id together with its owner
+func (m *postgresDBRepo) GetAPITokenByID(ctx context.Context, id int) (models.APIToken, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT t.id, t.user_id, t.name, t.scopes, t.last_used_at, t.revoked_at, t.created_at, t.updated_at,
+		u.id, u.first_name, u.last_name, u.email, u.access_level, u.active
+		FROM api_tokens t LEFT JOIN users u ON (t.user_id = u.id)
+		WHERE t.id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+
+	return scanAPIToken(row)
+}
+
+// GetAPITokenByHash returns the API token with the given hash together with its owner
+func (m *postgresDBRepo) GetAPITokenByHash(ctx context.Context, hash string) (models.APIToken, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT t.id, t.user_id, t.name, t.scopes, t.last_used_at, t.revoked_at, t.created_at, t.updated_at,
+		u.id, u.first_name, u.last_name, u.email, u.access_level, u.active
+		FROM api_tokens t LEFT JOIN users u ON (t.user_id = u.id)
+		WHERE t.token_hash = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, hash)
+
+	t, err := scanAPIToken(row)
+	if err != nil {
+		return t, err
+	}
+	t.TokenHash = hash
+
+	return t, nil
+}
+
+// UpdateAPITokenLastUsed records that the API token was just used
+func (m *postgresDBRepo) UpdateAPITokenLastUsed(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE api_tokens SET last_used_at = $1 WHERE id = $2`
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeAPIToken revokes an API token, it is kept so that its history stays visible
+func (m *postgresDBRepo) RevokeAPIToken(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE api_tokens SET revoked_at = $1, updated_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// claimMailQuery leases up to $4 pending emails due at $2 until $1, counting the attempt; lock is
+// appended to the query choosing them
+const claimMailQuery = `UPDATE mail_outbox SET attempts = attempts + 1, next_attempt_at = $1, updated_at = $2
+	WHERE id IN (SELECT id FROM mail_outbox WHERE status = $3 AND next_attempt_at <= $2
+		ORDER BY next_attempt_at, id LIMIT $4 %s)
+	RETURNING id, to_address, from_address, subject, template, data, content, attachments, status, attempts,
+		next_attempt_at, last_error, created_at, updated_at;`
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// enqueueMail inserts msg into the outbox, to be sent as soon as possible
+func enqueueMail(ctx context.Context, db execer, msg models.MailData) error {
+	attachments, err := json.Marshal(msg.Attachments)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO mail_outbox (to_address, from_address, subject, template, data, attachments, status,
+		next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`
+
+	_, err = db.ExecContext(ctx, query,
+		msg.To,
+		msg.From,
+		msg.Subject,
+		msg.Template,
+		string(msg.Data),
+		string(attachments),
+		models.MailPending,
+		time.Now(),
+		time.Now(),
+		time.Now(),
+	)
+
+	return err
+}
+
+// EnqueueMail queues an email in the outbox, to be sent as soon as possible
+func (m *postgresDBRepo) EnqueueMail(ctx context.Context, msg models.MailData) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return enqueueMail(ctx, m.DB, msg)
+}
+
+// ClaimMail returns up to limit pending emails that are due, oldest first, and leases them for
+// lease: until then no other call returns them, and if they are neither sent nor rescheduled they
+// are tried again afterwards. Every claim counts as an attempt
+func (m *postgresDBRepo) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	// rows claimed by another worker are skipped rather than waited for
+	return m.claimMail(ctx, fmt.Sprintf(claimMailQuery, "FOR UPDATE SKIP LOCKED"), limit, lease)
+}
+
+// claimMail runs a claimMailQuery
+func (m *postgresDBRepo) claimMail(ctx context.Context, query string, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var mail []models.OutboxMail
+
+	now := time.Now()
+
+	rows, err := m.DB.QueryContext(ctx, query, now.Add(lease), now, models.MailPending, limit)
+	if err != nil {
+		return mail, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		o, err := scanOutboxMail(rows)
+		if err != nil {
+			return mail, err
+		}
+
+		mail = append(mail, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return mail, err
+	}
+
+	return mail, nil
+}
+
+// MarkMailSent records that an email has been sent
+func (m *postgresDBRepo) MarkMailSent(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE mail_outbox SET status = $1, last_error = '', updated_at = $2 WHERE id = $3;`
+
+	_, err := m.DB.ExecContext(ctx, query, models.MailSent, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ScheduleMailRetry records why sending an email failed and when to try again
+func (m *postgresDBRepo) ScheduleMailRetry(ctx context.Context, id int, lastError string, at time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE mail_outbox SET next_attempt_at = $1, last_error = $2, updated_at = $3 WHERE id = $4;`
+
+	_, err := m.DB.ExecContext(ctx, query, at, lastError, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarkMailDead gives up on an email after its last attempt failed, it stays listed until it is resent
+func (m *postgresDBRepo) MarkMailDead(ctx context.Context, id int, lastError string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE mail_outbox SET status = $1, last_error = $2, updated_at = $3 WHERE id = $4;`
+
+	_, err := m.DB.ExecContext(ctx, query, models.MailDead, lastError, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AllDeadMail returns the emails that could not be sent, most recently failed first
+func (m *postgresDBRepo) AllDeadMail(ctx context.Context) ([]models.OutboxMail, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var mail []models.OutboxMail
+
+	query := `SELECT id, to_address, from_address, subject, template, data, content, attachments, status, attempts,
+		next_attempt_at, last_error, created_at, updated_at
+		FROM mail_outbox WHERE status = $1 ORDER BY updated_at DESC, id DESC;`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.MailDead)
+	if err != nil {
+		return mail, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		o, err := scanOutboxMail(rows)
+		if err != nil {
+			return mail, err
+		}
+
+		mail = append(mail, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return mail, err
+	}
+
+	return mail, nil
+}
+
+// ResendMail queues an email that could not be sent again, with a fresh set of attempts. It returns
+// sql.ErrNoRows unless the email is dead
+func (m *postgresDBRepo) ResendMail(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE mail_outbox SET status = $1, attempts = 0, next_attempt_at = $2, updated_at = $2
+		WHERE id = $3 AND status = $4;`
+
+	result, err := m.DB.ExecContext(ctx, query, models.MailPending, time.Now(), id, models.MailDead)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// scanOutboxMail scans a row of mail_outbox
+func scanOutboxMail(row scanner) (models.OutboxMail, error) {
+	var o models.OutboxMail
+	var data, attachments string
+
+	err := row.Scan(
+		&o.ID,
+		&o.Mail.To,
+		&o.Mail.From,
+		&o.Mail.Subject,
+		&o.Mail.Template,
+		&data,
+		&o.Mail.Content,
+		&attachments,
+		&o.Status,
+		&o.Attempts,
+		&o.NextAttemptAt,
+		&o.LastError,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+	)
+	if err != nil {
+		return o, err
+	}
+
+	o.Mail.Data = json.RawMessage(data)
+	err = json.Unmarshal([]byte(attachments), &o.Mail.Attachments)
+
+	return o, err
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// roomColumns are the columns of rooms read by scanRoom
+const roomColumns = `id, room_name, slug, description, max_occupancy, bed_configuration, amenities, created_at, updated_at`
+
+// scanRoom scans a row of roomColumns
+func scanRoom(row scanner) (models.Room, error) {
+	var rm models.Room
+	var amenities string
+
+	err := row.Scan(
+		&rm.ID,
+		&rm.RoomName,
+		&rm.Slug,
+		&rm.Description,
+		&rm.MaxOccupancy,
+		&rm.BedConfiguration,
+		&amenities,
+		&rm.CreatedAt,
+		&rm.UpdatedAt,
+	)
+
+	if err != nil {
+		return rm, err
+	}
+
+	if amenities != "" {
+		rm.Amenities = strings.Split(amenities, "\n")
+	}
+
+	return rm, nil
+}
+
+// scanAPIToken scans a row selected by AllAPITokens or GetAPITokenByHash
+func scanAPIToken(row scanner) (models.APIToken, error) {
+	var t models.APIToken
+	var scopes string
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Name,
+		&scopes,
+		&lastUsedAt,
+		&revokedAt,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&t.User.ID,
+		&t.User.FirstName,
+		&t.User.LastName,
+		&t.User.Email,
+		&t.User.AccessLevel,
+		&t.User.Active,
+	)
+
+	if err != nil {
+		return t, err
+	}
+
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+	t.LastUsedAt = lastUsedAt.Time
+	t.RevokedAt = revokedAt.Time
+
+	return t, nil
+}
+
+// encodeQuoteLines encodes the lines of a quote for reservations.quote
+func encodeQuoteLines(lines []models.QuoteLine) (string, error) {
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	out, err := json.Marshal(lines)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// decodeQuoteLines decodes reservations.quote
+func decodeQuoteLines(quote string) ([]models.QuoteLine, error) {
+	if quote == "" {
+		return nil, nil
+	}
+
+	var lines []models.QuoteLine
+	err := json.Unmarshal([]byte(quote), &lines)
+
+	return lines, err
+}
@@ -0,0 +1,107 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/repository"
+)
+
+// InsertReservation books a room: in one transaction it checks the dates are still free and inserts
+// the reservation together with its room restriction and the emails returned by mail, so that they
+// are queued if and only if the booking is made. It returns repository.ErrRoomUnavailable if the
+// room has been taken in the meantime
+func (m *sqliteDBRepo) InsertReservation(ctx context.Context, res models.Reservation, mail repository.MailFunc) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = roomExists(ctx, tx, res.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := bookRoom(ctx, tx, res, mail)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// ChangeReservationDates moves a reservation and its room restriction to res.StartDate and res.EndDate
+// and stores res.Quote with it. It returns repository.ErrRoomUnavailable if the room is taken on any of
+// the new dates and sql.ErrNoRows if there is no pending or confirmed reservation res.ID for res.RoomID
+func (m *sqliteDBRepo) ChangeReservationDates(ctx context.Context, res models.Reservation) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = roomExists(ctx, tx, res.RoomID)
+	if err != nil {
+		return err
+	}
+
+	err = changeDates(ctx, tx, res)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ClaimMail returns up to limit pending emails that are due, oldest first, and leases them for
+// lease. SQLite runs one write at a time, so the rows need no lock
+func (m *sqliteDBRepo) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	return m.claimMail(ctx, fmt.Sprintf(claimMailQuery, ""), limit, lease)
+}
+
+// InsertBlockForRoom inserts a one-day owner block for a room, returning repository.ErrRoomUnavailable
+// if the day is already booked or blocked
+func (m *sqliteDBRepo) InsertBlockForRoom(ctx context.Context, roomID int, startDate time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = roomExists(ctx, tx, roomID)
+	if err != nil {
+		return err
+	}
+
+	err = insertBlock(ctx, tx, roomID, startDate)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// roomExists returns sql.ErrNoRows if there is no room with roomID. SQLite has no row locks, but
+// driver.ConnectSQLite uses a single connection, so transactions already run one at a time
+func roomExists(ctx context.Context, tx *sql.Tx, roomID int) error {
+	var id int
+	return tx.QueryRowContext(ctx, `SELECT id FROM rooms WHERE id = $1;`, roomID).Scan(&id)
+}
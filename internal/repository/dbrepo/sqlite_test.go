@@ -0,0 +1,640 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marif226/bookings/internal/config"
+	"github.com/marif226/bookings/internal/driver"
+	"github.com/marif226/bookings/internal/migrate"
+	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/repository"
+	"github.com/marif226/bookings/migrations"
+)
+
+// newSQLiteRepo returns a repository for a migrated SQLite database that is removed after the test
+func newSQLiteRepo(t *testing.T) repository.DatabaseRepo {
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.SQL.Close() })
+
+	list, err := migrate.Load(migrations.FS, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrate.New(db.SQL, list).Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSQLiteRepo(db.SQL, &config.AppConfig{})
+}
+
+func TestSQLiteRepo_Reservations(t *testing.T) {
+	repo := newSQLiteRepo(t)
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "John", LastName: "Smith", Email: "john@smith.com", StartDate: date(10), EndDate: date(12), RoomID: 1, Adults: 1, Children: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.InsertReservation(ctx, models.Reservation{StartDate: date(11), EndDate: date(13), RoomID: 1}, nil)
+	if !errors.Is(err, repository.ErrRoomUnavailable) {
+		t.Errorf("expected ErrRoomUnavailable, got %v", err)
+	}
+
+	_, err = repo.InsertReservation(ctx, models.Reservation{StartDate: date(10), EndDate: date(12), RoomID: 3}, nil)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing room, got %v", err)
+	}
+
+	available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, date(12), date(14), 1)
+	if err != nil || !available {
+		t.Errorf("expected room 1 to be available after the stay, got %t, %v", available, err)
+	}
+
+	rooms, err := repo.SearchAvailabilityForAllRooms(ctx, date(9), date(11), 2)
+	if err != nil || len(rooms) != 1 || rooms[0].ID != 2 {
+		t.Errorf("expected only room 2 to be available, got %v, %v", rooms, err)
+	}
+
+	rooms, err = repo.SearchAvailabilityForAllRooms(ctx, date(20), date(22), 3)
+	if err != nil || len(rooms) != 0 {
+		t.Errorf("expected no room to sleep 3 guests, got %v, %v", rooms, err)
+	}
+
+	res, err := repo.GetReservationByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.StartDate.Equal(date(10)) || res.Room.RoomName != "General's Quarters" || res.Guests() != 2 {
+		t.Errorf("unexpected reservation %+v", res)
+	}
+
+	err = repo.InsertBlockForRoom(ctx, 2, date(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.InsertBlockForRoom(ctx, 2, date(20))
+	if !errors.Is(err, repository.ErrRoomUnavailable) {
+		t.Errorf("expected ErrRoomUnavailable blocking a blocked day, got %v", err)
+	}
+
+	err = repo.InsertBlockForRoom(ctx, 1, date(11))
+	if !errors.Is(err, repository.ErrRoomUnavailable) {
+		t.Errorf("expected ErrRoomUnavailable blocking a booked day, got %v", err)
+	}
+
+	restrictions, err := repo.GetRestrictionsForRoomByDate(ctx, 2, date(1), date(31))
+	if err != nil || len(restrictions) != 1 || restrictions[0].ReservationID != 0 {
+		t.Fatalf("expected one owner block, got %v, %v", restrictions, err)
+	}
+
+	err = repo.DeleteReservation(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	available, _ = repo.SearchAvailabilityByDatesByRoomID(ctx, date(10), date(12), 1)
+	if !available {
+		t.Error("deleting a reservation should free its dates")
+	}
+}
+
+func TestSQLiteRepo_ChangeReservationDates(t *testing.T) {
+	repo := newSQLiteRepo(t)
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "John", Email: "john@smith.com", StartDate: date(10), EndDate: date(12), RoomID: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.InsertReservation(ctx, models.Reservation{StartDate: date(20), EndDate: date(22), RoomID: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name			string
+		res				models.Reservation
+		expectedError	error
+	}{
+		{"overlapping itself", models.Reservation{ID: id, RoomID: 1, StartDate: date(11), EndDate: date(14)}, nil},
+		{"overlapping another stay", models.Reservation{ID: id, RoomID: 1, StartDate: date(18), EndDate: date(21)}, repository.ErrRoomUnavailable},
+		{"another room", models.Reservation{ID: id, RoomID: 2, StartDate: date(1), EndDate: date(2)}, sql.ErrNoRows},
+		{"missing reservation", models.Reservation{ID: id + 100, RoomID: 1, StartDate: date(1), EndDate: date(2)}, sql.ErrNoRows},
+	}
+
+	for _, e := range tests {
+		e.res.Quote = models.Quote{Currency: "USD", Total: 30000}
+		err := repo.ChangeReservationDates(ctx, e.res)
+		if !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expectedError, err)
+		}
+	}
+
+	res, err := repo.GetReservationByID(ctx, id)
+	if err != nil || !res.StartDate.Equal(date(11)) || !res.EndDate.Equal(date(14)) || res.Quote.Total != 30000 {
+		t.Errorf("expected the reservation to be moved to the 11th - 14th, got %+v, %v", res, err)
+	}
+
+	available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date(10), date(11), 1)
+	if !available {
+		t.Error("moving a reservation should free its old dates")
+	}
+
+	available, _ = repo.SearchAvailabilityByDatesByRoomID(ctx, date(13), date(14), 1)
+	if available {
+		t.Error("moving a reservation should take its new dates")
+	}
+}
+
+func TestSQLiteRepo_ReservationStatus(t *testing.T) {
+	repo := newSQLiteRepo(t)
+	ctx := context.Background()
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "John", StartDate: date(10), EndDate: date(12), RoomID: 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := repo.AllNewReservations(ctx)
+	if err != nil || len(pending) != 1 || pending[0].Status != models.StatusPending {
+		t.Errorf("expected the new reservation to be pending, got %+v, %v", pending, err)
+	}
+
+	tests := []struct {
+		name			string
+		id				int
+		status			models.ReservationStatus
+		expectedError	error
+	}{
+		{"skipping a step", id, models.StatusCheckedOut, repository.ErrInvalidTransition},
+		{"confirm", id, models.StatusConfirmed, nil},
+		{"cancel", id, models.StatusCancelled, nil},
+		{"after cancelling", id, models.StatusConfirmed, repository.ErrInvalidTransition},
+		{"missing reservation", id + 100, models.StatusConfirmed, sql.ErrNoRows},
+	}
+
+	for _, e := range tests {
+		err := repo.UpdateReservationStatus(ctx, e.id, e.status)
+		if !errors.Is(err, e.expectedError) {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expectedError, err)
+		}
+	}
+
+	res, err := repo.GetReservationByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != models.StatusCancelled || len(res.StatusChanges) != 2 ||
+		res.StatusChanges[0].FromStatus != models.StatusPending || res.StatusChanges[1].ToStatus != models.StatusCancelled {
+		t.Errorf("expected the reservation to be cancelled after being confirmed, got %s %+v", res.Status, res.StatusChanges)
+	}
+
+	cancelled, err := repo.AllReservations(ctx, models.StatusCancelled)
+	if err != nil || len(cancelled) != 1 {
+		t.Errorf("expected the cancelled reservation to be kept, got %+v, %v", cancelled, err)
+	}
+
+	available, _ := repo.SearchAvailabilityByDatesByRoomID(ctx, date(10), date(12), 1)
+	if !available {
+		t.Error("cancelling a reservation should free its dates")
+	}
+
+	err = repo.ChangeReservationDates(ctx, models.Reservation{ID: id, RoomID: 1, StartDate: date(14), EndDate: date(16)})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows moving a cancelled reservation, got %v", err)
+	}
+
+	err = repo.DeleteReservation(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteRepo_UsersAndTokens(t *testing.T) {
+	repo := newSQLiteRepo(t)
+	ctx := context.Background()
+
+	id, err := repo.InsertUser(ctx, models.User{FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", AccessLevel: models.AccessOwner}, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.InsertUser(ctx, models.User{Email: "jane@example.com"}, "secret")
+	if !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Errorf("expected ErrDuplicateEmail, got %v", err)
+	}
+
+	authID, _, err := repo.Authenticate(ctx, "jane@example.com", "secret")
+	if err != nil || authID != id {
+		t.Errorf("expected to authenticate as %d, got %d, %v", id, authID, err)
+	}
+
+	tokenID, err := repo.InsertAPIToken(ctx, models.APIToken{UserID: id, Name: "laptop", TokenHash: "hash", Scopes: []string{models.ScopeReservationsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.RevokeAPIToken(ctx, tokenID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := repo.GetAPITokenByHash(ctx, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.Revoked() || !token.HasScope(models.ScopeReservationsRead) || token.User.Email != "jane@example.com" {
+		t.Errorf("unexpected token %+v", token)
+	}
+
+	err = repo.DeleteUser(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.GetAPITokenByID(ctx, tokenID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected tokens to be deleted with their user, got %v", err)
+	}
+}
+
+func TestSQLiteRepo_Rooms(t *testing.T) {
+	repo := newSQLiteRepo(t)
+	ctx := context.Background()
+
+	room, err := repo.GetRoomBySlug(ctx, "majors-suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.RoomName != "Major's Suite" || len(room.Photos) != 1 || len(room.Amenities) != 1 {
+		t.Errorf("unexpected seeded room %+v", room)
+	}
+
+	room = models.Room{
+		RoomName: "Colonel's Cabin",
+		Slug: "colonels-cabin",
+		MaxOccupancy: 4,
+		Amenities: []string{"Fireplace", "Sauna"},
+		Photos: []models.RoomPhoto{{URL: "/b.png"}, {URL: "/a.png", Caption: "Front"}},
+	}
+
+	room.ID, err = repo.InsertRoom(ctx, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.InsertRoom(ctx, models.Room{RoomName: "Copy", Slug: "colonels-cabin"})
+	if !errors.Is(err, repository.ErrDuplicateSlug) {
+		t.Errorf("expected ErrDuplicateSlug, got %v", err)
+	}
+
+	room.Photos = room.Photos[1:]
+	err = repo.UpdateRoom(ctx, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := repo.GetRoomByID(ctx, room.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Photos) != 1 || saved.Photos[0].URL != "/a.png" || saved.Photos[0].Caption != "Front" || len(saved.Amenities) != 2 {
+		t.Errorf("unexpected saved room %+v", saved)
+	}
+
+	token, err := repo.GetRoomICalToken(ctx, room.ID)
+	if err != nil || token != "" {
+		t.Errorf("expected a new room to have its calendar feed off, got %q, %v", token, err)
+	}
+
+	err = repo.SetRoomICalToken(ctx, room.ID, "feed-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _ = repo.GetRoomICalToken(ctx, room.ID)
+	if token != "feed-token" {
+		t.Errorf("expected the saved calendar token, got %q", token)
+	}
+
+	_, err = repo.InsertReservation(ctx, models.Reservation{StartDate: date(1), EndDate: date(2), RoomID: room.ID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.DeleteRoom(ctx, room.ID)
+	if !errors.Is(err, repository.ErrRoomInUse) {
+		t.Errorf("expected ErrRoomInUse, got %v", err)
+	}
+
+	id, err := repo.InsertRoom(ctx, models.Room{RoomName: "Empty", Slug: "empty", MaxOccupancy: 1, Photos: []models.RoomPhoto{{URL: "/c.png"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.DeleteRoom(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.GetRoomByID(ctx, id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the room to be deleted, got %v", err)
+	}
+
+	_, err = repo.GetRoomICalToken(ctx, id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for the calendar token of a missing room, got %v", err)
+	}
+}
+
+func TestSQLiteRepo_RatePlans(t *testing.T) {
+	repo := newSQLiteRepo(t)
+	ctx := context.Background()
+
+	plan, err := repo.GetRatePlanByRoomID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.NightlyRate != 15000 || plan.WeekendRate != 18000 || plan.Currency != "USD" || len(plan.Seasons) != 0 {
+		t.Errorf("unexpected seeded plan %+v", plan)
+	}
+
+	plan.NightlyRate = 16000
+	plan.Seasons = []models.RateSeason{
+		{Name: "Summer", StartDate: date(20), EndDate: date(25), NightlyRate: 20000},
+		{Name: "Spring", StartDate: date(1), EndDate: date(5), NightlyRate: 17000, WeekendRate: 19000},
+	}
+
+	err = repo.SaveRatePlan(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// saving again replaces the seasons rather than adding to them
+	err = repo.SaveRatePlan(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := repo.GetRatePlanByRoomID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.ID != plan.ID || saved.NightlyRate != 16000 || len(saved.Seasons) != 2 {
+		t.Fatalf("unexpected saved plan %+v", saved)
+	}
+	if saved.Seasons[0].Name != "Spring" || !saved.Seasons[0].EndDate.Equal(date(5)) || saved.Seasons[0].WeekendRate != 19000 {
+		t.Errorf("expected the seasons ordered by start date, got %+v", saved.Seasons)
+	}
+
+	quote := models.Quote{
+		Currency: "USD",
+		Lines: []models.QuoteLine{{Date: date(10), Description: "Nightly rate", Amount: 16000}},
+		Total: 16000,
+	}
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{StartDate: date(10), EndDate: date(11), RoomID: 1, Quote: quote}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := repo.GetReservationByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Quote.Total != 16000 || len(res.Quote.Lines) != 1 || !res.Quote.Lines[0].Date.Equal(date(10)) {
+		t.Errorf("expected the quote to be stored with the reservation, got %+v", res.Quote)
+	}
+
+	room, err := repo.InsertRoom(ctx, models.Room{RoomName: "Annex", Slug: "annex", MaxOccupancy: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.GetRatePlanByRoomID(ctx, room)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a room without a plan, got %v", err)
+	}
+
+	err = repo.SaveRatePlan(ctx, models.RatePlan{RoomID: room, Currency: "EUR", NightlyRate: 5000, IncludedGuests: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.DeleteRoom(ctx, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.GetRatePlanByRoomID(ctx, room)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the plan to be deleted with its room, got %v", err)
+	}
+}
+
+func TestSQLiteRepo_StayRules(t *testing.T) {
+	repo := newSQLiteRepo(t)
+	ctx := context.Background()
+
+	rules, err := repo.GetStayRulesByRoomID(ctx, 1)
+	if err != nil || len(rules) != 0 {
+		t.Fatalf("expected no rules yet, got %+v, %v", rules, err)
+	}
+
+	closed := models.Weekdays(0).With(time.Sunday).With(time.Saturday)
+
+	rules = []models.StayRule{
+		{Name: "Summer", StartDate: date(20), EndDate: date(25), MinNights: 3, ClosedToArrival: closed},
+		{Name: "All year", MaxNights: 14, LeadDays: 2},
+	}
+
+	// saving twice replaces the rules rather than adding to them
+	for i := 0; i < 2; i++ {
+		err = repo.SaveStayRules(ctx, 1, rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved, err := repo.GetStayRulesByRoomID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("expected 2 rules, got %+v", saved)
+	}
+	if saved[0].Name != "All year" || saved[0].HasDates() || saved[0].MaxNights != 14 || saved[0].LeadDays != 2 {
+		t.Errorf("expected the rule for all year first, got %+v", saved[0])
+	}
+	if !saved[1].StartDate.Equal(date(20)) || !saved[1].EndDate.Equal(date(25)) || saved[1].ClosedToArrival != closed {
+		t.Errorf("unexpected dated rule %+v", saved[1])
+	}
+
+	room, err := repo.InsertRoom(ctx, models.Room{RoomName: "Annex", Slug: "annex", MaxOccupancy: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.SaveStayRules(ctx, room, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.DeleteRoom(ctx, room)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, _ = repo.GetStayRulesByRoomID(ctx, room)
+	if len(saved) != 0 {
+		t.Errorf("expected the rules to be deleted with their room, got %+v", saved)
+	}
+}
+
+func TestSQLiteRepo_Outbox(t *testing.T) {
+	repo := newSQLiteRepo(t)
+	ctx := context.Background()
+
+	confirmation := func(res models.Reservation) []models.MailData {
+		return []models.MailData{{
+			To: "john@smith.com",
+			Subject: fmt.Sprintf("Reservation %d", res.ID),
+			Template: "reservation-confirmation",
+			Data: []byte(`{"FirstName":"John"}`),
+			Attachments: []models.Attachment{{Name: "reservation.ics", ContentType: "text/calendar", Data: []byte("BEGIN:VCALENDAR")}},
+		}}
+	}
+
+	id, err := repo.InsertReservation(ctx, models.Reservation{FirstName: "John", StartDate: date(10), EndDate: date(12), RoomID: 1}, confirmation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a booking that fails queues nothing
+	_, err = repo.InsertReservation(ctx, models.Reservation{FirstName: "Jane", StartDate: date(11), EndDate: date(13), RoomID: 1}, confirmation)
+	if !errors.Is(err, repository.ErrRoomUnavailable) {
+		t.Fatalf("expected ErrRoomUnavailable, got %v", err)
+	}
+
+	err = repo.EnqueueMail(ctx, models.MailData{To: "me@here.com", Subject: "Reservation Notification"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail, err := repo.ClaimMail(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mail) != 2 || mail[0].Mail.Subject != fmt.Sprintf("Reservation %d", id) || mail[0].Mail.Template != "reservation-confirmation" || mail[0].Attempts != 1 {
+		t.Fatalf("expected the confirmation and the notification, got %+v", mail)
+	}
+
+	if string(mail[0].Mail.Data) != `{"FirstName":"John"}` || len(mail[0].Mail.Attachments) != 1 || string(mail[0].Mail.Attachments[0].Data) != "BEGIN:VCALENDAR" {
+		t.Errorf("expected the data and attachment of the confirmation to be kept, got %+v", mail[0].Mail)
+	}
+
+	// claimed emails are left alone until their lease is over
+	again, err := repo.ClaimMail(ctx, 10, time.Minute)
+	if err != nil || len(again) != 0 {
+		t.Errorf("expected claimed emails not to be claimed again, got %+v, %v", again, err)
+	}
+
+	err = repo.MarkMailSent(ctx, mail[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = repo.ScheduleMailRetry(ctx, mail[1].ID, "connection refused", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err = repo.ClaimMail(ctx, 10, -time.Hour)
+	if err != nil || len(again) != 0 {
+		t.Errorf("expected no email to be due, got %+v, %v", again, err)
+	}
+
+	err = repo.ResendMail(ctx, mail[1].ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows resending an email that is still queued, got %v", err)
+	}
+
+	err = repo.MarkMailDead(ctx, mail[1].ID, "mailbox unavailable")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dead, err := repo.AllDeadMail(ctx)
+	if err != nil || len(dead) != 1 || dead[0].LastError != "mailbox unavailable" || dead[0].Mail.To != "me@here.com" {
+		t.Fatalf("expected one dead email, got %+v, %v", dead, err)
+	}
+
+	err = repo.ResendMail(ctx, dead[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err = repo.ClaimMail(ctx, 10, time.Minute)
+	if err != nil || len(again) != 1 || again[0].ID != dead[0].ID || again[0].Attempts != 1 {
+		t.Errorf("expected the resent email to be due with fresh attempts, got %+v, %v", again, err)
+	}
+}
+
+func TestSQLiteRepo_OutboxMailQueuedBeforeTemplates(t *testing.T) {
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	list, err := migrate.Load(migrations.FS, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	// migrate up to the email templates and queue an email the way it was done before them
+	n := 0
+	for n < len(list) && list[n].Version < 20221213090000 {
+		n++
+	}
+
+	_, err = migrate.New(db.SQL, list[:n]).Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	_, err = db.SQL.ExecContext(ctx, `INSERT INTO mail_outbox (to_address, from_address, subject, content, template,
+		next_attempt_at, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`,
+		"john@smith.com", "me@here.com", "Reservation Confirmation", "<strong>Reservation Confirmation</strong>", "basic.html", now, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrate.New(db.SQL, list).Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail, err := NewSQLiteRepo(db.SQL, &config.AppConfig{}).ClaimMail(ctx, 10, time.Minute)
+	if err != nil || len(mail) != 1 || mail[0].Mail.Content != "<strong>Reservation Confirmation</strong>" {
+		t.Errorf("expected the email queued before templates to be sent with its content, got %+v, %v", mail, err)
+	}
+}
@@ -1,103 +1,565 @@
 package dbrepo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/marif226/bookings/internal/helpers"
 	"github.com/marif226/bookings/internal/models"
+	"github.com/marif226/bookings/internal/repository"
 )
 
-func (m *testDBRepo) AllUsers() bool {
-	return true
+// AllUsers returns a slice of all users
+func (m *testDBRepo) AllUsers(ctx context.Context) ([]models.User, error) {
+	users := []models.User{
+		{ID: 1, FirstName: "Admin", LastName: "User", Email: "admin@here.com", AccessLevel: models.AccessOwner, Active: true},
+		{ID: 2, FirstName: "Staff", LastName: "User", Email: "staff@here.com", AccessLevel: models.AccessStaff, Active: false},
+	}
+
+	return users, nil
 }
 
 
-// InsertReservation inserts reservation into the database
-func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	// if the room id is 2 then fail otherwise pass
+// InsertReservation books a room, room 2 is unavailable and room 1000 fails
+func (m *testDBRepo) InsertReservation(ctx context.Context, res models.Reservation, mail repository.MailFunc) (int, error) {
 	if res.RoomID == 2 {
+		return 0, repository.ErrRoomUnavailable
+	} else if res.RoomID == 1000 {
 		return 0, errors.New("some error")
 	}
-	return 1, nil
-}
 
-// InsertRoomRestriction inserts a room restriction into the database
-func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	if r.RoomID == 1000 {
-		return errors.New("some error")
+	if mail != nil {
+		res.ID = 1
+		mail(res)
 	}
-	return nil
+	return 1, nil
 }
 
 // SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false if not
-func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	return false, nil
+func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	// room 1 is always available, room 1000 fails
+	if roomID == 1000 {
+		return false, errors.New("some error")
+	}
+	return roomID == 1, nil
 }
 
-// SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+// SearchAvailabilityForAllRooms returns the rooms sleeping at least guests, all of them are available
+// except in 2051 and the search fails for 1000 guests
+func (m *testDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time, guests int) ([]models.Room, error) {
 	var rooms []models.Room
 
+	if guests == 1000 {
+		return rooms, errors.New("some error")
+	} else if start.Year() == 2051 {
+		return rooms, nil
+	}
+
+	all, _ := m.AllRooms(ctx)
+	for _, room := range all {
+		if room.MaxOccupancy >= guests {
+			rooms = append(rooms, room)
+		}
+	}
+
 	return rooms, nil
 }
 
 // GetRoomByID gets room by id
-func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
+func (m *testDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
 	var room models.Room
-	if id > 2 {
-		return room, errors.New("Some error")
+	// room 1000 exists so that InsertReservation can be made to fail, room 1001 so that its rate plan can
+	// and room 1002 so that its stay rules can
+	if id > 2 && id != 1000 && id != 1001 && id != 1002 {
+		return room, sql.ErrNoRows
 	}
-	
+
+	room.ID = id
+	room.RoomName = fmt.Sprintf("Room %d", id)
+	room.Slug = fmt.Sprintf("room-%d", id)
+	room.MaxOccupancy = 2
 
 	return room, nil
 }
 
-func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
+// GetRoomBySlug gets room by slug, generals-quarters exists and fail fails
+func (m *testDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	switch slug {
+	case "generals-quarters":
+		return models.Room{
+			ID: 1,
+			RoomName: "General's Quarters",
+			Slug: slug,
+			Description: "Our most luxurious apartments",
+			MaxOccupancy: 2,
+			BedConfiguration: "1 king bed",
+			Amenities: []string{"Sea view", "Wi-Fi"},
+			Photos: []models.RoomPhoto{{ID: 1, RoomID: 1, URL: "/static/images/generals-quarters.png"}},
+		}, nil
+	case "fail":
+		return models.Room{}, errors.New("some error")
+	}
+	return models.Room{}, sql.ErrNoRows
+}
+
+// InsertRoom inserts a room, the slug taken is in use and the name fail fails
+func (m *testDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	if room.Slug == "taken" {
+		return 0, repository.ErrDuplicateSlug
+	} else if room.RoomName == "fail" {
+		return 0, errors.New("some error")
+	}
+	return 3, nil
+}
+
+// UpdateRoom updates a room, the slug taken is in use and the name fail fails
+func (m *testDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	if room.Slug == "taken" {
+		return repository.ErrDuplicateSlug
+	} else if room.RoomName == "fail" {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// DeleteRoom deletes a room, room 2 has reservations and room 1000 fails
+func (m *testDBRepo) DeleteRoom(ctx context.Context, id int) error {
+	if id == 2 {
+		return repository.ErrRoomInUse
+	} else if id == 1000 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// GetRoomICalToken returns the token of the iCal feed of a room, room 2 has the feed off and room 1000 fails
+func (m *testDBRepo) GetRoomICalToken(ctx context.Context, roomID int) (string, error) {
+	switch {
+	case roomID == 1000:
+		return "", errors.New("some error")
+	case roomID == 2:
+		return "", nil
+	case roomID > 2:
+		return "", sql.ErrNoRows
+	}
+	return "feed-token", nil
+}
+
+// SetRoomICalToken replaces the token of the iCal feed of a room, room 1000 fails
+func (m *testDBRepo) SetRoomICalToken(ctx context.Context, roomID int, token string) error {
+	if roomID == 1000 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// GetRatePlanByRoomID returns the rate plan of a room, room 2 has none and room 1001 fails
+func (m *testDBRepo) GetRatePlanByRoomID(ctx context.Context, roomID int) (models.RatePlan, error) {
+	if roomID == 2 {
+		return models.RatePlan{}, sql.ErrNoRows
+	} else if roomID == 1001 {
+		return models.RatePlan{}, errors.New("some error")
+	}
+
+	plan := models.RatePlan{
+		ID: roomID,
+		RoomID: roomID,
+		Currency: "USD",
+		NightlyRate: 10000,
+		WeekendRate: 12000,
+		IncludedGuests: 2,
+		ExtraGuestRate: 2500,
+		Seasons: []models.RateSeason{
+			{
+				ID: 1,
+				RatePlanID: roomID,
+				Name: "Holidays",
+				StartDate: time.Date(2050, 12, 20, 0, 0, 0, 0, time.UTC),
+				EndDate: time.Date(2051, 1, 2, 0, 0, 0, 0, time.UTC),
+				NightlyRate: 15000,
+			},
+		},
+	}
+
+	return plan, nil
+}
+
+// SaveRatePlan saves the rate plan of a room, room 1000 fails
+func (m *testDBRepo) SaveRatePlan(ctx context.Context, plan models.RatePlan) error {
+	if plan.RoomID == 1000 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// GetStayRulesByRoomID returns the stay rules of a room, every room has a 3 night minimum over
+// Christmas 2050 and room 1002 fails
+func (m *testDBRepo) GetStayRulesByRoomID(ctx context.Context, roomID int) ([]models.StayRule, error) {
+	if roomID == 1002 {
+		return nil, errors.New("some error")
+	}
+
+	rules := []models.StayRule{
+		{
+			ID: 1,
+			RoomID: roomID,
+			Name: "Christmas",
+			StartDate: time.Date(2050, 12, 23, 0, 0, 0, 0, time.UTC),
+			EndDate: time.Date(2050, 12, 26, 0, 0, 0, 0, time.UTC),
+			MinNights: 3,
+		},
+	}
+
+	return rules, nil
+}
+
+// SaveStayRules saves the stay rules of a room, room 1000 fails
+func (m *testDBRepo) SaveStayRules(ctx context.Context, roomID int, rules []models.StayRule) error {
+	if roomID == 1000 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (m *testDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
 	var u models.User
+	if id == 1000 {
+		return u, errors.New("some error")
+	}
+
+	u.ID = id
+	u.Email = "admin@here.com"
+	u.Password = "$2a$10$hash"
+	u.AccessLevel = models.AccessManager
+	u.Active = true
+	// user 2 outranks the managers used in tests
+	if id == 2 {
+		u.AccessLevel = models.AccessOwner
+	}
 
 	return u, nil
 }
 
-func (m *testDBRepo) UpdateUser(u models.User) error {
+// GetUserByEmail returns a user by email address
+func (m *testDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	if email != "admin@here.com" {
+		return models.User{}, sql.ErrNoRows
+	}
+
+	return m.GetUserByID(ctx, 1)
+}
+
+func (m *testDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	if u.Email == "taken@here.com" {
+		return repository.ErrDuplicateEmail
+	}
+	return nil
+}
+
+// InsertUser inserts a user into the database
+func (m *testDBRepo) InsertUser(ctx context.Context, u models.User, password string) (int, error) {
+	if u.Email == "taken@here.com" {
+		return 0, repository.ErrDuplicateEmail
+	}
+	return 1, nil
+}
+
+// UpdatePassword replaces the password of a user
+func (m *testDBRepo) UpdatePassword(ctx context.Context, id int, password string) error {
+	return nil
+}
+
+// SetUserActive activates or deactivates a user
+func (m *testDBRepo) SetUserActive(ctx context.Context, id int, active bool) error {
+	if id == 1000 {
+		return errors.New("some error")
+	}
 	return nil
 }
 
-func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+// DeleteUser deletes one user by id
+func (m *testDBRepo) DeleteUser(ctx context.Context, id int) error {
+	if id == 1000 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (m *testDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
 	return 1, "", nil
 }
 
-// AllReservations returns a slice of all reservations
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
+// AllReservations returns a slice of all reservations in status
+func (m *testDBRepo) AllReservations(ctx context.Context, status models.ReservationStatus) ([]models.Reservation, error) {
 	var reservations []models.Reservation
 
 	return reservations, nil
 }
 
 // AllNewReservations returns a slice of all reservations
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
 	var reservations []models.Reservation
 
 	return reservations, nil
 }
 
 // GetReservationByID returns one reservation by id
-func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
 	var res models.Reservation
+	// id 1000 fails, anything above it does not exist and 998 has been cancelled
+	if id == 1000 {
+		return res, errors.New("some error")
+	} else if id > 1000 {
+		return res, sql.ErrNoRows
+	}
+
+	res.ID = id
+	res.FirstName = "John"
+	res.LastName = "Smith"
+	res.Email = "john@smith.com"
+	res.StartDate = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	res.EndDate = time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC)
+	res.RoomID = 1
+	res.Adults = 2
+	res.Status = models.StatusPending
+	if id == 998 {
+		res.Status = models.StatusCancelled
+	}
+	res.Room.ID = 1
+	res.Room.RoomName = "Room 1"
+	res.Quote = models.Quote{
+		Currency: "USD",
+		Lines: []models.QuoteLine{
+			{Date: res.StartDate, Description: "Nightly rate (weekend)", Amount: 12000},
+			{Date: res.StartDate.AddDate(0, 0, 1), Description: "Nightly rate", Amount: 10000},
+		},
+		Total: 22000,
+	}
 
 	return res, nil
 }
 
 // UpdateReservation updates reservation in database
-func (m *testDBRepo) UpdateReservation(u models.Reservation) error {
+func (m *testDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	return nil
+}
+
+// ChangeReservationDates moves a reservation, the room is taken in 2051 and reservation 999 fails
+func (m *testDBRepo) ChangeReservationDates(ctx context.Context, res models.Reservation) error {
+	if res.StartDate.Year() == 2051 {
+		return repository.ErrRoomUnavailable
+	} else if res.ID == 999 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// DeleteReservation deletes one reservation by id, reservations 999 and 1000 fail
+func (m *testDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	if id == 999 || id == 1000 {
+		return errors.New("some error")
+	}
 	return nil
 }
 
-// DeleteReservation deletes one reservation by id
-func (m *testDBRepo) DeleteReservation(id int) error {
+// UpdateReservationStatus moves a reservation to status, reservations are pending apart from 998,
+// which has been cancelled, and reservations 999 and 1000 fail
+func (m *testDBRepo) UpdateReservationStatus(ctx context.Context, id int, status models.ReservationStatus) error {
+	if id == 999 {
+		return errors.New("some error")
+	}
+
+	res, err := m.GetReservationByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !res.Status.CanBecome(status) {
+		return repository.ErrInvalidTransition
+	}
+	return nil
+}
+
+// AllRooms returns all rooms
+func (m *testDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	rooms := []models.Room{
+		{ID: 1, RoomName: "General's Quarters", Slug: "generals-quarters", MaxOccupancy: 2},
+		{ID: 2, RoomName: "Major's Suite", Slug: "majors-suite", MaxOccupancy: 2},
+	}
+
+	return rooms, nil
+}
+
+// GetRestrictionsForRoomByDate returns restrictions for a room overlapping the given date range
+func (m *testDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	restrictions := []models.RoomRestriction{
+		{
+			ID: 1,
+			RoomID: roomID,
+			ReservationID: 1,
+			RestrictionID: models.RestrictionReservation,
+			StartDate: start,
+			EndDate: start.AddDate(0, 0, 2),
+		},
+		{
+			ID: 2,
+			RoomID: roomID,
+			RestrictionID: models.RestrictionOwnerBlock,
+			StartDate: start.AddDate(0, 0, 3),
+			EndDate: start.AddDate(0, 0, 4),
+		},
+	}
+
+	return restrictions, nil
+}
+
+// InsertBlockForRoom inserts a one-day owner block for a room; days in 2051 are booked and days in
+// 1000 fail
+func (m *testDBRepo) InsertBlockForRoom(ctx context.Context, roomID int, startDate time.Time) error {
+	if roomID == 1000 || startDate.Year() == 1000 {
+		return errors.New("some error")
+	}
+	if startDate.Year() == 2051 {
+		return repository.ErrRoomUnavailable
+	}
 	return nil
 }
 
-// UpdateProcessedForReservation updates processed for reservation by id
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+// DeleteBlockByID deletes an owner block by id
+func (m *testDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	if id == 1000 {
+		return errors.New("some error")
+	}
 	return nil
-} 
\ No newline at end of file
+}
+
+// AllAPITokens returns all API tokens
+func (m *testDBRepo) AllAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	tokens := []models.APIToken{
+		{ID: 1, UserID: 99, Name: "Channel manager", Scopes: []string{models.ScopeReservationsRead}, User: models.User{ID: 99, FirstName: "Admin"}},
+		{ID: 2, UserID: 2, Name: "Old script", RevokedAt: time.Now(), User: models.User{ID: 2, FirstName: "Staff"}},
+	}
+
+	return tokens, nil
+}
+
+// InsertAPIToken inserts a new API token, it fails for a token named "fail"
+func (m *testDBRepo) InsertAPIToken(ctx context.Context, t models.APIToken) (int, error) {
+	if t.Name == "fail" {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+// GetAPITokenByID returns an API token by id, token 2 belongs to user 2 and ids above 1000 do not exist
+func (m *testDBRepo) GetAPITokenByID(ctx context.Context, id int) (models.APIToken, error) {
+	t := models.APIToken{
+		ID: id,
+		UserID: 99,
+		Name: "test",
+		User: models.User{ID: 99},
+	}
+
+	if id == 2 {
+		t.UserID = 2
+		t.User.ID = 2
+	} else if id > 1000 {
+		return models.APIToken{}, sql.ErrNoRows
+	}
+
+	return t, nil
+}
+
+// GetAPITokenByHash knows the tokens "bk_valid", "bk_noscope", "bk_revoked", "bk_inactive" and "bk_fail"
+func (m *testDBRepo) GetAPITokenByHash(ctx context.Context, hash string) (models.APIToken, error) {
+	t := models.APIToken{
+		ID: 1,
+		UserID: 1,
+		Name: "test",
+		TokenHash: hash,
+		Scopes: []string{models.ScopeReservationsRead},
+		User: models.User{ID: 1, AccessLevel: models.AccessStaff, Active: true},
+	}
+
+	switch hash {
+	case helpers.HashAPIToken("bk_valid"):
+	case helpers.HashAPIToken("bk_noscope"):
+		t.Scopes = nil
+	case helpers.HashAPIToken("bk_revoked"):
+		t.RevokedAt = time.Now()
+	case helpers.HashAPIToken("bk_inactive"):
+		t.User.Active = false
+	case helpers.HashAPIToken("bk_fail"):
+		return t, errors.New("some error")
+	default:
+		return models.APIToken{}, sql.ErrNoRows
+	}
+
+	return t, nil
+}
+
+// UpdateAPITokenLastUsed records that the API token was just used
+func (m *testDBRepo) UpdateAPITokenLastUsed(ctx context.Context, id int) error {
+	return nil
+}
+
+// RevokeAPIToken revokes an API token
+func (m *testDBRepo) RevokeAPIToken(ctx context.Context, id int) error {
+	if id == 1000 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// EnqueueMail queues an email in the outbox
+func (m *testDBRepo) EnqueueMail(ctx context.Context, msg models.MailData) error {
+	return nil
+}
+
+// ClaimMail returns the pending emails that are due, there are none
+func (m *testDBRepo) ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error) {
+	return nil, nil
+}
+
+// MarkMailSent records that an email has been sent
+func (m *testDBRepo) MarkMailSent(ctx context.Context, id int) error {
+	return nil
+}
+
+// ScheduleMailRetry records why sending an email failed and when to try again
+func (m *testDBRepo) ScheduleMailRetry(ctx context.Context, id int, lastError string, at time.Time) error {
+	return nil
+}
+
+// MarkMailDead gives up on an email
+func (m *testDBRepo) MarkMailDead(ctx context.Context, id int, lastError string) error {
+	return nil
+}
+
+// AllDeadMail returns the emails that could not be sent
+func (m *testDBRepo) AllDeadMail(ctx context.Context) ([]models.OutboxMail, error) {
+	mail := []models.OutboxMail{
+		{
+			ID: 1,
+			Mail: models.MailData{To: "john@smith.com", From: "me@here.com", Subject: "Reservation Confirmation"},
+			Status: models.MailDead,
+			Attempts: 8,
+			LastError: "connection refused",
+		},
+	}
+
+	return mail, nil
+}
+
+// ResendMail queues a dead email again, email 1 is dead, 1000 fails and the others are not dead
+func (m *testDBRepo) ResendMail(ctx context.Context, id int) error {
+	if id == 1000 {
+		return errors.New("some error")
+	} else if id != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -1,24 +1,77 @@
 package repository
 
 import (
-	"github.com/marif226/bookings/internal/models"
+	"context"
+	"errors"
 	"time"
+
+	"github.com/marif226/bookings/internal/models"
 )
 
+// ErrRoomUnavailable is returned when a room is already booked or blocked for some of the requested dates
+var ErrRoomUnavailable = errors.New("room is not available for the requested dates")
+
+// ErrDuplicateEmail is returned when a user with the same email address already exists
+var ErrDuplicateEmail = errors.New("email address already in use")
+
+// ErrDuplicateSlug is returned when a room with the same slug already exists
+var ErrDuplicateSlug = errors.New("slug already in use")
+
+// ErrRoomInUse is returned when deleting a room that still has reservations or blocks
+var ErrRoomInUse = errors.New("room has reservations or blocks")
+
+// ErrInvalidTransition is returned when a reservation cannot move from its current status to the one requested
+var ErrInvalidTransition = errors.New("reservation cannot move to the requested status")
+
+// MailFunc returns the emails to queue for a reservation once it has been given its id
+type MailFunc func(res models.Reservation) []models.MailData
+
 type DatabaseRepo interface {
-	AllUsers() bool
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(r models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(id int) (models.Room, error)
-	GetUserByID(id int) (models.User, error)
-	UpdateUser(u models.User) error
-	Authenticate(email, testPassword string) (int, string, error)
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(u models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
+	AllUsers(ctx context.Context) ([]models.User, error)
+	InsertReservation(ctx context.Context, res models.Reservation, mail MailFunc) (int, error)
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time, guests int) ([]models.Room, error)
+	GetRoomByID(ctx context.Context, id int) (models.Room, error)
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	UpdateUser(ctx context.Context, u models.User) error
+	InsertUser(ctx context.Context, u models.User, password string) (int, error)
+	UpdatePassword(ctx context.Context, id int, password string) error
+	SetUserActive(ctx context.Context, id int, active bool) error
+	DeleteUser(ctx context.Context, id int) error
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
+	AllReservations(ctx context.Context, status models.ReservationStatus) ([]models.Reservation, error)
+	AllNewReservations(ctx context.Context) ([]models.Reservation, error)
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	UpdateReservation(ctx context.Context, u models.Reservation) error
+	ChangeReservationDates(ctx context.Context, res models.Reservation) error
+	DeleteReservation(ctx context.Context, id int) error
+	UpdateReservationStatus(ctx context.Context, id int, status models.ReservationStatus) error
+	AllRooms(ctx context.Context) ([]models.Room, error)
+	GetRoomBySlug(ctx context.Context, slug string) (models.Room, error)
+	InsertRoom(ctx context.Context, room models.Room) (int, error)
+	UpdateRoom(ctx context.Context, room models.Room) error
+	DeleteRoom(ctx context.Context, id int) error
+	GetRoomICalToken(ctx context.Context, roomID int) (string, error)
+	SetRoomICalToken(ctx context.Context, roomID int, token string) error
+	GetRatePlanByRoomID(ctx context.Context, roomID int) (models.RatePlan, error)
+	SaveRatePlan(ctx context.Context, plan models.RatePlan) error
+	GetStayRulesByRoomID(ctx context.Context, roomID int) ([]models.StayRule, error)
+	SaveStayRules(ctx context.Context, roomID int, rules []models.StayRule) error
+	GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	InsertBlockForRoom(ctx context.Context, roomID int, startDate time.Time) error
+	DeleteBlockByID(ctx context.Context, id int) error
+	AllAPITokens(ctx context.Context) ([]models.APIToken, error)
+	InsertAPIToken(ctx context.Context, t models.APIToken) (int, error)
+	GetAPITokenByID(ctx context.Context, id int) (models.APIToken, error)
+	GetAPITokenByHash(ctx context.Context, hash string) (models.APIToken, error)
+	UpdateAPITokenLastUsed(ctx context.Context, id int) error
+	RevokeAPIToken(ctx context.Context, id int) error
+	EnqueueMail(ctx context.Context, msg models.MailData) error
+	ClaimMail(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMail, error)
+	MarkMailSent(ctx context.Context, id int) error
+	ScheduleMailRetry(ctx context.Context, id int, lastError string, at time.Time) error
+	MarkMailDead(ctx context.Context, id int, lastError string) error
+	AllDeadMail(ctx context.Context) ([]models.OutboxMail, error)
+	ResendMail(ctx context.Context, id int) error
 }
\ No newline at end of file
@@ -0,0 +1,56 @@
+package signer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSigner_SignVerify(t *testing.T) {
+	s := New([]byte("secret"))
+
+	token := s.Sign("reset", "42:abc", time.Hour)
+
+	data, err := s.Verify("reset", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data != "42:abc" {
+		t.Errorf("expected data 42:abc, got %s", data)
+	}
+}
+
+func TestSigner_Invalid(t *testing.T) {
+	s := New([]byte("secret"))
+	token := s.Sign("reset", "42", time.Hour)
+
+	tests := []struct {
+		name	string
+		signer	*Signer
+		purpose	string
+		token	string
+	}{
+		{"other purpose", s, "booking", token},
+		{"other key", New([]byte("other")), "reset", token},
+		{"tampered data", s, "reset", "NDN8OTk5OTk5OTk5OQ" + token[len("NDJ8"):]},
+		{"garbage", s, "reset", "not-a-token"},
+		{"empty", s, "reset", ""},
+	}
+
+	for _, e := range tests {
+		_, err := e.signer.Verify(e.purpose, e.token)
+		if err != ErrInvalidToken {
+			t.Errorf("for %s expected ErrInvalidToken, got %v", e.name, err)
+		}
+	}
+}
+
+func TestSigner_Expired(t *testing.T) {
+	s := New([]byte("secret"))
+	token := s.Sign("reset", "42", -time.Minute)
+
+	_, err := s.Verify("reset", token)
+	if err != ErrExpiredToken {
+		t.Errorf("expected ErrExpiredToken, got %v", err)
+	}
+}
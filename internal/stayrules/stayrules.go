@@ -0,0 +1,109 @@
+// Package stayrules checks stays against the booking rules of rooms
+package stayrules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+)
+
+// Violation is returned by Check when a stay breaks a rule, the message is meant for guests
+type Violation string
+
+func (v Violation) Error() string {
+	return string(v)
+}
+
+// MaxNights is the longest stay in any room whatever its rules, nothing loops over the nights of longer ones
+const MaxNights = 365
+
+// ErrInvalidDates is returned when a stay does not end after it starts
+var ErrInvalidDates = Violation("The departure date must be after the arrival date!")
+
+// ErrPastArrival is returned when a stay starts before the day it is booked on
+var ErrPastArrival = Violation("The arrival date cannot be in the past!")
+
+// ErrTooLong is returned when a stay is longer than MaxNights
+var ErrTooLong = Violation(fmt.Sprintf("Stays can be at most %d nights!", MaxNights))
+
+// CheckDates returns a Violation unless a stay from start until end, booked on today, ends after it
+// starts, does not start in the past and lasts at most MaxNights. Stays are checked with it before
+// anything loops over their nights
+func CheckDates(start, end, today time.Time) error {
+	if !end.After(start) {
+		return ErrInvalidDates
+	}
+
+	if start.Before(today) {
+		return ErrPastArrival
+	}
+
+	if end.After(start.AddDate(0, 0, MaxNights)) {
+		return ErrTooLong
+	}
+
+	return nil
+}
+
+// Check returns a Violation for the dates of a stay from start until end, the day of departure, when
+// it is booked on today, or for the first rule it breaks. Rules on the length of a stay apply if any of
+// its nights falls within their dates, rules on arrival and lead time if the arrival does and rules on
+// departure if the departure does
+func Check(rules []models.StayRule, start, end, today time.Time) error {
+	if err := CheckDates(start, end, today); err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if err := check(rule, start, end, today); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check returns a Violation if the stay breaks rule
+func check(rule models.StayRule, start, end, today time.Time) error {
+	stays := "Stays"
+	if rule.HasDates() && rule.Name != "" {
+		stays = "Stays over " + rule.Name
+	}
+
+	nights, covered := 0, false
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		nights++
+		covered = covered || rule.Covers(d)
+	}
+
+	if covered && rule.MinNights > 0 && nights < rule.MinNights {
+		return Violation(fmt.Sprintf("%s must be at least %d %s!", stays, rule.MinNights, Plural(rule.MinNights, "night")))
+	}
+
+	if covered && rule.MaxNights > 0 && nights > rule.MaxNights {
+		return Violation(fmt.Sprintf("%s can be at most %d %s!", stays, rule.MaxNights, Plural(rule.MaxNights, "night")))
+	}
+
+	if rule.Covers(start) && rule.ClosedToArrival.Has(start.Weekday()) {
+		return Violation(fmt.Sprintf("%s cannot start on a %s!", stays, start.Weekday()))
+	}
+
+	if rule.Covers(end) && rule.ClosedToDeparture.Has(end.Weekday()) {
+		return Violation(fmt.Sprintf("%s cannot end on a %s!", stays, end.Weekday()))
+	}
+
+	if rule.Covers(start) && rule.LeadDays > 0 && start.Before(today.AddDate(0, 0, rule.LeadDays)) {
+		return Violation(fmt.Sprintf("%s must be booked at least %d %s ahead!", stays, rule.LeadDays, Plural(rule.LeadDays, "day")))
+	}
+
+	return nil
+}
+
+// Plural returns word followed by an s unless n is 1
+func Plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
@@ -0,0 +1,81 @@
+package stayrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/marif226/bookings/internal/models"
+)
+
+// day returns a date in December 2050, the 24th is a Saturday
+func day(d int) time.Time {
+	return time.Date(2050, time.December, d, 0, 0, 0, 0, time.UTC)
+}
+
+var rules = []models.StayRule{
+	{Name: "All year", MaxNights: 14, ClosedToArrival: models.Weekdays(0).With(time.Sunday)},
+	{Name: "Holiday weekend", StartDate: day(23), EndDate: day(26), MinNights: 3,
+		ClosedToDeparture: models.Weekdays(0).With(time.Saturday)},
+	{Name: "Festival", StartDate: day(1), EndDate: day(3), LeadDays: 30},
+}
+
+func TestCheck(t *testing.T) {
+	today := day(1).AddDate(0, 0, -10)
+
+	tests := []struct {
+		name		string
+		start		time.Time
+		end			time.Time
+		expected	string
+	}{
+		{"allowed", day(5), day(7), ""},
+		{"end before start", day(7), day(5), "The departure date must be after the arrival date!"},
+		{"no nights", day(5), day(5), "The departure date must be after the arrival date!"},
+		{"too long", day(5), day(20), "Stays can be at most 14 nights!"},
+		{"longer than any room allows", day(5), day(5).AddDate(2, 0, 0), "Stays can be at most 365 nights!"},
+		{"closed to arrival", day(4), day(6), "Stays cannot start on a Sunday!"},
+		{"too short over the holiday", day(22), day(24), "Stays over Holiday weekend must be at least 3 nights!"},
+		{"long enough over the holiday", day(22), day(27), ""},
+		{"closed to departure", day(20), day(24), "Stays over Holiday weekend cannot end on a Saturday!"},
+		{"too short before the holiday", day(20), day(22), ""},
+		{"booked too late", day(2), day(5), "Stays over Festival must be booked at least 30 days ahead!"},
+		{"arriving after the festival", day(5), day(8), ""},
+	}
+
+	for _, e := range tests {
+		err := Check(rules, e.start, e.end, today)
+		if e.expected == "" {
+			if err != nil {
+				t.Errorf("%s: expected no violation, got %v", e.name, err)
+			}
+			continue
+		}
+
+		v, ok := err.(Violation)
+		if !ok || string(v) != e.expected {
+			t.Errorf("%s: expected %q, got %v", e.name, e.expected, err)
+		}
+	}
+}
+
+func TestCheckDates(t *testing.T) {
+	tests := []struct {
+		name		string
+		start		time.Time
+		end			time.Time
+		expected	error
+	}{
+		{"arriving today", day(3), day(4), nil},
+		{"longest stay", day(3), day(3).AddDate(0, 0, MaxNights), nil},
+		{"too long", day(3), day(3).AddDate(0, 0, MaxNights+1), ErrTooLong},
+		{"arrived yesterday", day(2), day(4), ErrPastArrival},
+		{"end before start", day(4), day(3), ErrInvalidDates},
+	}
+
+	for _, e := range tests {
+		err := CheckDates(e.start, e.end, day(3))
+		if err != e.expected {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expected, err)
+		}
+	}
+}
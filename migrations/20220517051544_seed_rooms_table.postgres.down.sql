@@ -1 +0,0 @@
-DELETE FROM rooms;
\ No newline at end of file
@@ -1 +0,0 @@
-DELETE FROM restrictions;
\ No newline at end of file
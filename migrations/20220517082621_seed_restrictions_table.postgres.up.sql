@@ -1,3 +0,0 @@
-INSERT INTO public.restrictions (restriction_name, created_at, updated_at) VALUES 
-    ('Reservation', '17-05-2022 00:00:00.000', '17-05-2022 00:00:00.000'),
-	('Owner Block', '17-05-2022 00:00:00.000', '17-05-2022 00:00:00.000');
\ No newline at end of file
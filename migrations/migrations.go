@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL migrations into the bookings binary
+package migrations
+
+import "embed"
+
+// FS holds the migrations, one directory per database dialect
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var FS embed.FS
@@ -0,0 +1 @@
+-- nothing to undo: making the column NOT NULL again would fail as soon as an owner block exists
@@ -0,0 +1,7 @@
+DROP INDEX rooms_slug_idx;
+
+ALTER TABLE rooms DROP COLUMN amenities;
+ALTER TABLE rooms DROP COLUMN bed_configuration;
+ALTER TABLE rooms DROP COLUMN max_occupancy;
+ALTER TABLE rooms DROP COLUMN description;
+ALTER TABLE rooms DROP COLUMN slug;
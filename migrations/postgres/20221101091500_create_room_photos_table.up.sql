@@ -0,0 +1,22 @@
+CREATE TABLE room_photos (
+    id SERIAL PRIMARY KEY,
+    room_id INTEGER NOT NULL,
+    url VARCHAR(255) NOT NULL,
+    caption VARCHAR(255) NOT NULL DEFAULT '',
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX room_photos_room_id_position_idx ON room_photos (room_id, position);
+
+ALTER TABLE room_photos ADD CONSTRAINT room_photos_rooms_id_fk
+    FOREIGN KEY (room_id) REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE;
+
+INSERT INTO room_photos (room_id, url, position, created_at, updated_at)
+    SELECT id, '/static/images/generals-quarters.png', 0, '2022-11-01 00:00:00', '2022-11-01 00:00:00'
+    FROM rooms WHERE slug = 'generals-quarters';
+
+INSERT INTO room_photos (room_id, url, position, created_at, updated_at)
+    SELECT id, '/static/images/marjors-suite.png', 0, '2022-11-01 00:00:00', '2022-11-01 00:00:00'
+    FROM rooms WHERE slug = 'majors-suite';
@@ -0,0 +1,2 @@
+DROP TABLE rate_seasons;
+DROP TABLE rate_plans;
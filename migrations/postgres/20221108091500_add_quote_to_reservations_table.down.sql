@@ -0,0 +1,3 @@
+ALTER TABLE reservations DROP COLUMN quote;
+ALTER TABLE reservations DROP COLUMN total_price;
+ALTER TABLE reservations DROP COLUMN currency;
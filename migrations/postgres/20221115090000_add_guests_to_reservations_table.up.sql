@@ -0,0 +1,2 @@
+ALTER TABLE reservations ADD COLUMN adults INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE reservations ADD COLUMN children INTEGER NOT NULL DEFAULT 0;
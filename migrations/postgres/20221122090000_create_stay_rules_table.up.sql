@@ -0,0 +1,21 @@
+CREATE TABLE stay_rules (
+    id SERIAL PRIMARY KEY,
+    room_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    -- the rule applies all year unless both dates are set
+    start_date DATE,
+    end_date DATE,
+    min_nights INTEGER NOT NULL DEFAULT 0,
+    max_nights INTEGER NOT NULL DEFAULT 0,
+    -- bit n is set for closed weekday n, Sunday being 0
+    closed_to_arrival INTEGER NOT NULL DEFAULT 0,
+    closed_to_departure INTEGER NOT NULL DEFAULT 0,
+    lead_days INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX stay_rules_room_id_idx ON stay_rules (room_id);
+
+ALTER TABLE stay_rules ADD CONSTRAINT stay_rules_rooms_id_fk
+    FOREIGN KEY (room_id) REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE;
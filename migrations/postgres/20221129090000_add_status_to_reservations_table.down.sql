@@ -0,0 +1,3 @@
+ALTER TABLE reservations ADD COLUMN processed INTEGER NOT NULL DEFAULT 0;
+UPDATE reservations SET processed = 1 WHERE status <> 'pending';
+ALTER TABLE reservations DROP COLUMN status;
@@ -0,0 +1,12 @@
+CREATE TABLE reservation_status_changes (
+    id SERIAL PRIMARY KEY,
+    reservation_id INTEGER NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX reservation_status_changes_reservation_id_idx ON reservation_status_changes (reservation_id);
+
+ALTER TABLE reservation_status_changes ADD CONSTRAINT reservation_status_changes_reservations_id_fk
+    FOREIGN KEY (reservation_id) REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,17 @@
+CREATE TABLE mail_outbox (
+    id SERIAL PRIMARY KEY,
+    to_address VARCHAR(255) NOT NULL,
+    from_address VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    template VARCHAR(255) NOT NULL DEFAULT '',
+    -- pending until sent, or dead once every attempt has failed
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX mail_outbox_status_next_attempt_at_idx ON mail_outbox (status, next_attempt_at);
@@ -0,0 +1,2 @@
+-- files attached to the email, as a JSON array
+ALTER TABLE mail_outbox ADD COLUMN attachments TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1 @@
+ALTER TABLE rooms DROP COLUMN ical_token;
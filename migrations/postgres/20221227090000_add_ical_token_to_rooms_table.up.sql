@@ -0,0 +1,2 @@
+-- the secret in the iCal feed link of the room, empty while the feed is off
+ALTER TABLE rooms ADD COLUMN ical_token VARCHAR(64) NOT NULL DEFAULT '';
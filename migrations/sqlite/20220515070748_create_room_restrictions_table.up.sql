@@ -0,0 +1,18 @@
+-- SQLite cannot alter columns or add constraints to an existing table, so reservation_id is
+-- nullable for owner blocks and all foreign keys are declared here
+CREATE TABLE room_restrictions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    room_id INTEGER NOT NULL,
+    reservation_id INTEGER NULL,
+    restriction_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CONSTRAINT room_restrictions_rooms_id_fk
+        FOREIGN KEY (room_id) REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT room_restrictions_restrictions_id_fk
+        FOREIGN KEY (restriction_id) REFERENCES restrictions (id) ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT room_restrictions_reservations_id_fk
+        FOREIGN KEY (reservation_id) REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
@@ -0,0 +1 @@
+-- the foreign keys are dropped together with their tables
@@ -0,0 +1 @@
+-- the foreign keys are declared when the tables are created
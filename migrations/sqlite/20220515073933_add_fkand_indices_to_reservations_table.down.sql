@@ -0,0 +1,2 @@
+DROP INDEX reservations_email_idx;
+DROP INDEX reservations_last_name_idx;
@@ -0,0 +1,3 @@
+-- the foreign key is declared when room_restrictions is created
+CREATE INDEX reservations_email_idx ON reservations (email);
+CREATE INDEX reservations_last_name_idx ON reservations (last_name);
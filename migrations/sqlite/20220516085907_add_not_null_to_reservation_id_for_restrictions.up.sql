@@ -0,0 +1 @@
+-- reservation_id is nullable from the start, owner blocks are not tied to a reservation
@@ -0,0 +1,3 @@
+INSERT INTO rooms (room_name, created_at, updated_at) VALUES
+    ('General''s Quarters', '2022-05-17 00:00:00', '2022-05-17 00:00:00'),
+    ('Major''s Suite', '2022-05-17 00:00:00', '2022-05-17 00:00:00');
@@ -0,0 +1,3 @@
+INSERT INTO restrictions (restriction_name, created_at, updated_at) VALUES
+    ('Reservation', '2022-05-17 00:00:00', '2022-05-17 00:00:00'),
+    ('Owner Block', '2022-05-17 00:00:00', '2022-05-17 00:00:00');
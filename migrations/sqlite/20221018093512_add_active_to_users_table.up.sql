@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT 1;
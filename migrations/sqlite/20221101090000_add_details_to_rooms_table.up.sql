@@ -0,0 +1,23 @@
+ALTER TABLE rooms ADD COLUMN slug VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE rooms ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE rooms ADD COLUMN max_occupancy INTEGER NOT NULL DEFAULT 2;
+ALTER TABLE rooms ADD COLUMN bed_configuration VARCHAR(255) NOT NULL DEFAULT '';
+-- one amenity per line
+ALTER TABLE rooms ADD COLUMN amenities TEXT NOT NULL DEFAULT '';
+
+UPDATE rooms SET
+    slug = 'generals-quarters',
+    description = 'Our most luxurious apartments with the most beautiful views, top-class furniture and Iranian carpets. The general of the Cuban Army Ernesto Pintos himself once stayed here.',
+    bed_configuration = '1 king bed'
+    WHERE room_name = 'General''s Quarters';
+
+UPDATE rooms SET
+    slug = 'majors-suite',
+    description = 'The ideal option in the price-quality ratio. This includes comfortable rooms with breakfast included, as well as a bed, a wardrobe and a bathroom with hot water.',
+    bed_configuration = '1 double bed',
+    amenities = 'Breakfast included'
+    WHERE room_name = 'Major''s Suite';
+
+UPDATE rooms SET slug = 'room-' || id WHERE slug = '';
+
+CREATE UNIQUE INDEX rooms_slug_idx ON rooms (slug);
@@ -0,0 +1,41 @@
+CREATE TABLE rate_plans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    room_id INTEGER NOT NULL,
+    currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    -- all amounts are in cents
+    nightly_rate INTEGER NOT NULL,
+    weekend_rate INTEGER NOT NULL DEFAULT 0,
+    included_guests INTEGER NOT NULL DEFAULT 2,
+    extra_guest_rate INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CONSTRAINT rate_plans_rooms_id_fk
+        FOREIGN KEY (room_id) REFERENCES rooms (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX rate_plans_room_id_idx ON rate_plans (room_id);
+
+CREATE TABLE rate_seasons (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rate_plan_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    -- the nights from start_date through end_date
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    nightly_rate INTEGER NOT NULL,
+    weekend_rate INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CONSTRAINT rate_seasons_rate_plans_id_fk
+        FOREIGN KEY (rate_plan_id) REFERENCES rate_plans (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX rate_seasons_rate_plan_id_idx ON rate_seasons (rate_plan_id);
+
+INSERT INTO rate_plans (room_id, nightly_rate, weekend_rate, created_at, updated_at)
+    SELECT id, 15000, 18000, '2022-11-08 00:00:00', '2022-11-08 00:00:00'
+    FROM rooms WHERE slug = 'generals-quarters';
+
+INSERT INTO rate_plans (room_id, nightly_rate, weekend_rate, created_at, updated_at)
+    SELECT id, 9500, 11000, '2022-11-08 00:00:00', '2022-11-08 00:00:00'
+    FROM rooms WHERE slug = 'majors-suite';
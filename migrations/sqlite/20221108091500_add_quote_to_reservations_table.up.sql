@@ -0,0 +1,5 @@
+-- the price quoted at booking time, so later rate changes do not alter existing bookings
+ALTER TABLE reservations ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT '';
+ALTER TABLE reservations ADD COLUMN total_price INTEGER NOT NULL DEFAULT 0;
+-- the quote lines as JSON
+ALTER TABLE reservations ADD COLUMN quote TEXT NOT NULL DEFAULT '';
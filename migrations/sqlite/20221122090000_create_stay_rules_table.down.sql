@@ -0,0 +1 @@
+DROP TABLE stay_rules;
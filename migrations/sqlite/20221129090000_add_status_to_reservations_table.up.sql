@@ -0,0 +1,3 @@
+ALTER TABLE reservations ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'pending';
+UPDATE reservations SET status = 'confirmed' WHERE processed = 1;
+ALTER TABLE reservations DROP COLUMN processed;
@@ -0,0 +1 @@
+DROP TABLE reservation_status_changes;
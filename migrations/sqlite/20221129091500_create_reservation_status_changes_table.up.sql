@@ -0,0 +1,11 @@
+CREATE TABLE reservation_status_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reservation_id INTEGER NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT reservation_status_changes_reservations_id_fk
+        FOREIGN KEY (reservation_id) REFERENCES reservations (id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX reservation_status_changes_reservation_id_idx ON reservation_status_changes (reservation_id);
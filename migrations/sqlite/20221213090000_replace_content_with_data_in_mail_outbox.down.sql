@@ -0,0 +1 @@
+ALTER TABLE mail_outbox DROP COLUMN data;
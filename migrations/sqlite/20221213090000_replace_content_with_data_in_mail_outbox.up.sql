@@ -0,0 +1,3 @@
+-- emails are rendered from their template and data when sent, instead of being stored as HTML
+ALTER TABLE mail_outbox ADD COLUMN data TEXT NOT NULL DEFAULT '{}';
+-- content is kept for the emails queued as HTML before templates, they are sent as they are
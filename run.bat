@@ -1,2 +1,2 @@
 go build -o bookings.exe cmd/web/.
-bookings.exe
\ No newline at end of file
+bookings.exe -dbname=bookings -dbuser=postgres %*
\ No newline at end of file
@@ -1,3 +1,3 @@
 #!/bin/bash
 
-go build -o bookings cmd/web/*.go && ./bookings
\ No newline at end of file
+go build -o bookings cmd/web/*.go && ./bookings -dbname=bookings -dbuser=postgres "$@"